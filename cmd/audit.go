@@ -0,0 +1,135 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	defaultAuditMaxEntries = 100
+	auditRecordsKey        = "records"
+	auditTimeout           = 10 * time.Second
+)
+
+// auditRecord is a single lock operation entry stored in the audit ConfigMap
+type auditRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Release   string    `json:"release"`
+	Command   string    `json:"command"`
+	Holder    string    `json:"holder,omitempty"`
+	Rollback  bool      `json:"rollback"`
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+	Bypass    string    `json:"bypass,omitempty"`
+}
+
+// writeAuditRecord appends the record to the audit ConfigMap, keeping the last maxEntries records
+func writeAuditRecord(ctx context.Context, client kubernetes.Interface, namespace, name string, maxEntries int, record auditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	configMaps := client.CoreV1().ConfigMaps(namespace)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: namespace,
+				},
+				Data: map[string]string{
+					auditRecordsKey: string(line),
+				},
+			}
+
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(corev1.Resource("configmaps"), name, err)
+			}
+
+			return err
+		}
+
+		if err != nil {
+			return err
+		}
+
+		records := []string{}
+		if data := strings.TrimSpace(cm.Data[auditRecordsKey]); data != "" {
+			records = strings.Split(data, "\n")
+		}
+
+		records = append(records, string(line))
+		if maxEntries > 0 && len(records) > maxEntries {
+			records = records[len(records)-maxEntries:]
+		}
+
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+
+		cm.Data[auditRecordsKey] = strings.Join(records, "\n")
+
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+
+		return err
+	})
+}
+
+// auditOperation records the finished lock operation, the run result is not affected by audit failures
+func auditOperation(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace string, report *lockReport) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditTimeout)
+	defer cancel()
+
+	record := auditRecord{
+		Timestamp: time.Now().UTC(),
+		Release:   opts.releaseName,
+		Command:   opts.helmCommand,
+		Holder:    report.holder,
+		Rollback:  report.rollback,
+		Outcome:   "success",
+	}
+
+	if opts.noLock {
+		record.Bypass = opts.reason
+	}
+
+	if report.err != nil {
+		record.Outcome = "failure"
+		record.Error = report.err.Error()
+	}
+
+	if err := writeAuditRecord(ctx, client, namespace, opts.auditConfigMap, opts.auditMaxEntries, record); err != nil {
+		return fmt.Errorf("failed to write audit record to configmap '%s': %w", opts.auditConfigMap, err)
+	}
+
+	return nil
+}
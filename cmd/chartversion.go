@@ -0,0 +1,91 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// loadLocalChart loads the chart of the helm command when it is a local path, nil otherwise
+func loadLocalChart(opts *lockOptions) *chart.Chart {
+	ref := opts.chartRef()
+	if ref == "" {
+		return nil
+	}
+
+	c, err := loader.Load(ref)
+	if err != nil || c.Metadata == nil {
+		return nil
+	}
+
+	return c
+}
+
+// targetChartVersion returns the chart version to be deployed, from --version or the local chart
+func targetChartVersion(opts *lockOptions) string {
+	if version, ok := flagValue(opts.helmFlags, "--version"); ok && version != "" {
+		return version
+	}
+
+	c := loadLocalChart(opts)
+	if c == nil {
+		return ""
+	}
+
+	return c.Metadata.Version
+}
+
+// checkDowngrade refuses to deploy a chart version lower than the deployed one
+func checkDowngrade(actionConfig *action.Configuration, opts *lockOptions) error {
+	deployed, err := getDeployedChartVersion(actionConfig, opts.releaseName)
+	if err != nil {
+		return fmt.Errorf("failed to get deployed chart version: %w", err)
+	}
+
+	target := targetChartVersion(opts)
+	if deployed == "" || target == "" {
+		opts.logger.Printf("Cannot determine the deployed or target chart version, skipping downgrade check")
+
+		return nil
+	}
+
+	deployedVersion, err := semver.NewVersion(deployed)
+	if err != nil {
+		opts.logger.Printf("Deployed chart version '%s' is not semver, skipping downgrade check", deployed)
+
+		return nil
+	}
+
+	targetVersion, err := semver.NewVersion(target)
+	if err != nil {
+		opts.logger.Printf("Target chart version '%s' is not semver, skipping downgrade check", target)
+
+		return nil
+	}
+
+	if targetVersion.LessThan(deployedVersion) {
+		return fmt.Errorf("chart version %s is lower than the deployed version %s, refusing to downgrade", target, deployed)
+	}
+
+	return nil
+}
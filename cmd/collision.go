@@ -0,0 +1,81 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// helmFlagPattern matches a long flag at the start of a line of the helm help output,
+// like "  -i, --install" and "      --wait"
+var helmFlagPattern = regexp.MustCompile(`(?m)^\s+(?:-[a-zA-Z], )?--([a-z0-9][a-z0-9-]*)`)
+
+// helmCommandFlags returns the flags of the helm command, including the global flags,
+// parsed from the help output of the helm binary
+func helmCommandFlags(ctx context.Context, opts *lockOptions, command string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, helmVersionTimeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+
+	stderr := &tailBuffer{limit: execOutputLimit}
+
+	if err := execHelm(ctx, opts, []string{command, "--help"}, &stdout, stderr); err != nil {
+		return nil, fmt.Errorf("helm %s --help failed: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	flags := []string{}
+	for _, match := range helmFlagPattern.FindAllStringSubmatch(stdout.String(), -1) {
+		flags = append(flags, match[1])
+	}
+
+	return flags, nil
+}
+
+// flagCollisions returns the helm-lock own flags that are also helm flags
+func flagCollisions(own *pflag.FlagSet, helmFlags []string) []string {
+	collisions := []string{}
+
+	own.VisitAll(func(flag *pflag.Flag) {
+		if slices.Contains(helmFlags, flag.Name) {
+			collisions = append(collisions, flag.Name)
+		}
+	})
+
+	return collisions
+}
+
+// warnFlagCollisions warns about the helm-lock flags the helm command also accepts, they never reach helm
+func warnFlagCollisions(ctx context.Context, opts *lockOptions) {
+	helmFlags, err := helmCommandFlags(ctx, opts, opts.helmVerb())
+	if err != nil {
+		opts.logger.Printf("Warning: cannot check the helm-lock flags against the helm flags: %v", err)
+
+		return
+	}
+
+	for _, name := range flagCollisions(opts.lockFlags, helmFlags) {
+		opts.logger.Printf("Warning: helm-lock flag --%s is also a helm %s flag, it is not forwarded to helm", name, opts.helmVerb())
+	}
+}
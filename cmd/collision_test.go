@@ -0,0 +1,140 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+const helmUpgradeHelp = `Upgrade a release
+
+Usage:
+  helm upgrade [RELEASE] [CHART] [flags]
+
+Flags:
+      --atomic                  if set, upgrade process rolls back changes made in case of failed upgrade
+  -i, --install                 if a release by this name doesn't already exist, run an install
+      --timeout duration        time to wait for any individual Kubernetes operation (default 5m0s)
+      --wait                    if set, will wait until all resources are in a ready state
+
+Global Flags:
+      --kube-context string     name of the kubeconfig context to use
+  -n, --namespace string        namespace scope for this request
+`
+
+func TestHelmCommandFlags(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake helm is a shell script")
+	}
+
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+
+	script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\nprintf '%s' \"$FAKE_HELM_STDOUT\"\nexit \"${FAKE_HELM_EXIT:-0}\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "helm"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		name      string
+		help      string
+		exit      string
+		ownFlags  []string
+		wantFlags []string
+		wantLog   []string
+	}{
+		{
+			name:      "no collision",
+			help:      helmUpgradeHelp,
+			ownFlags:  []string{"lock-timeout", "lock-kube-context"},
+			wantFlags: []string{"atomic", "install", "timeout", "wait", "kube-context", "namespace"},
+		},
+		{
+			name:      "collisions",
+			help:      helmUpgradeHelp,
+			ownFlags:  []string{"lock-timeout", "timeout", "kube-context"},
+			wantFlags: []string{"atomic", "install", "timeout", "wait", "kube-context", "namespace"},
+			wantLog: []string{
+				"helm-lock flag --timeout is also a helm upgrade flag",
+				"helm-lock flag --kube-context is also a helm upgrade flag",
+			},
+		},
+		{
+			name:     "helm failure",
+			exit:     "1",
+			ownFlags: []string{"timeout"},
+			wantLog:  []string{"cannot check the helm-lock flags against the helm flags"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FAKE_HELM_STDOUT", tt.help)
+			t.Setenv("FAKE_HELM_EXIT", tt.exit)
+
+			var out bytes.Buffer
+
+			opts := newTestOptions(&out)
+			opts.lockFlags = pflag.NewFlagSet("lock", pflag.ContinueOnError)
+
+			for _, name := range tt.ownFlags {
+				opts.lockFlags.String(name, "", "")
+			}
+
+			flags, err := helmCommandFlags(context.Background(), opts, "upgrade")
+			if (err != nil) != (tt.exit != "") {
+				t.Fatalf("helmCommandFlags() error = %v", err)
+			}
+
+			if !slices.Equal(flags, tt.wantFlags) {
+				t.Errorf("helmCommandFlags() = %q, want %q", flags, tt.wantFlags)
+			}
+
+			args, err := os.ReadFile(argsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.TrimSpace(string(args)) != "upgrade --help" {
+				t.Errorf("helm arguments = %q, want %q", strings.TrimSpace(string(args)), "upgrade --help")
+			}
+
+			warnFlagCollisions(context.Background(), opts)
+
+			if len(tt.wantLog) == 0 && out.Len() > 0 {
+				t.Errorf("warnFlagCollisions() logged:\n%s", out.String())
+			}
+
+			for _, want := range tt.wantLog {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("log has no %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	concurrencyConfigMap = lockPrefix + "concurrency"
+	slotTTL              = 15 * time.Second
+	slotRenewPeriod      = 5 * time.Second
+	slotPollInterval     = 2 * time.Second
+
+	// slotKeyNameLimit keeps the slot key with its hash suffix within the 253 characters of a ConfigMap key
+	slotKeyNameLimit = 200
+)
+
+var invalidSlotKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+
+// concurrencySlot is a namespace concurrency slot stored in the concurrency ConfigMap
+type concurrencySlot struct {
+	Holder  string    `json:"holder"`
+	Release string    `json:"release"`
+	Expires time.Time `json:"expires"`
+}
+
+// slotKey returns the ConfigMap data key of the holder slot, the readable part is the sanitized identity
+// and the hash of the raw identity keeps identities that sanitize the same apart
+func slotKey(identity string) string {
+	sum := sha256.Sum256([]byte(identity))
+
+	name := invalidSlotKeyChars.ReplaceAllString(identity, "_")
+	if len(name) > slotKeyNameLimit {
+		name = name[:slotKeyNameLimit]
+	}
+
+	return name + "." + hex.EncodeToString(sum[:8])
+}
+
+// tryAcquireSlot takes or renews the holder slot, it reports false when all slots are taken
+func tryAcquireSlot(ctx context.Context, client kubernetes.Interface, namespace string, limit int, slot concurrencySlot) (bool, error) {
+	value, err := json.Marshal(slot)
+	if err != nil {
+		return false, err
+	}
+
+	key := slotKey(slot.Holder)
+	configMaps := client.CoreV1().ConfigMaps(namespace)
+	acquired := false
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		acquired = false
+
+		cm, err := configMaps.Get(ctx, concurrencyConfigMap, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      concurrencyConfigMap,
+					Namespace: namespace,
+					Labels:    map[string]string{managedByLabel: managedByValue},
+				},
+				Data: map[string]string{
+					key: string(value),
+				},
+			}
+
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(corev1.Resource("configmaps"), concurrencyConfigMap, err)
+			}
+
+			acquired = err == nil
+
+			return err
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+
+		// reclaim the slots of crashed holders
+		now := time.Now()
+		for k, v := range cm.Data {
+			var s concurrencySlot
+			if err := json.Unmarshal([]byte(v), &s); err != nil || now.After(s.Expires) {
+				delete(cm.Data, k)
+			}
+		}
+
+		if _, found := cm.Data[key]; !found && len(cm.Data) >= limit {
+			return nil
+		}
+
+		cm.Data[key] = string(value)
+
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		acquired = err == nil
+
+		return err
+	})
+
+	return acquired, err
+}
+
+// releaseSlot removes the holder slot from the concurrency ConfigMap
+func releaseSlot(ctx context.Context, client kubernetes.Interface, namespace, identity string) error {
+	key := slotKey(identity)
+	configMaps := client.CoreV1().ConfigMaps(namespace)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, concurrencyConfigMap, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if _, found := cm.Data[key]; !found {
+			return nil
+		}
+
+		delete(cm.Data, key)
+
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+
+		return err
+	})
+}
+
+// withConcurrencySlot runs the operation once a namespace concurrency slot is acquired,
+// the slot is renewed while the operation runs and released afterwards
+func withConcurrencySlot(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, identity string, operation func(context.Context) error) error {
+	if opts.namespaceConcurrency <= 0 {
+		return operation(ctx)
+	}
+
+	slot := concurrencySlot{Holder: identity, Release: opts.releaseName}
+
+	ticker := time.NewTicker(slotPollInterval)
+	defer ticker.Stop()
+
+	for waiting := false; ; waiting = true {
+		slot.Expires = time.Now().Add(slotTTL)
+
+		acquired, err := tryAcquireSlot(ctx, client, namespace, opts.namespaceConcurrency, slot)
+		if err != nil {
+			return fmt.Errorf("failed to acquire namespace concurrency slot: %w", err)
+		}
+
+		if acquired {
+			break
+		}
+
+		if !waiting {
+			opts.logger.Printf("All %d concurrency slots in namespace '%s' are taken, waiting", opts.namespaceConcurrency, namespace)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for a namespace concurrency slot: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditTimeout)
+		defer cancel()
+
+		if err := releaseSlot(releaseCtx, client, namespace, identity); err != nil {
+			opts.logger.Printf("Warning: failed to release namespace concurrency slot: %v", err)
+		}
+	}()
+
+	renewCtx, stopRenew := context.WithCancel(ctx)
+	defer stopRenew()
+
+	go func() {
+		renew := time.NewTicker(slotRenewPeriod)
+		defer renew.Stop()
+
+		for {
+			select {
+			case <-renewCtx.Done():
+				return
+			case <-renew.C:
+				slot.Expires = time.Now().Add(slotTTL)
+
+				acquired, err := tryAcquireSlot(renewCtx, client, namespace, opts.namespaceConcurrency, slot)
+				if err != nil {
+					opts.logger.Printf("Warning: failed to renew namespace concurrency slot: %v", err)
+				} else if !acquired {
+					opts.logger.Printf("Warning: namespace concurrency slot was reclaimed by another run")
+				}
+			}
+		}
+	}()
+
+	return operation(ctx)
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSlotKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		first string
+		other string
+	}{
+		{name: "slash and underscore", first: "ci/deploy", other: "ci_deploy"},
+		{name: "colon and underscore", first: "runner:1", other: "runner_1"},
+		{name: "long identities", first: strings.Repeat("a", 300) + "1", other: strings.Repeat("a", 300) + "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, other := slotKey(tt.first), slotKey(tt.other)
+
+			if first == other {
+				t.Errorf("slotKey(%q) = slotKey(%q) = %q", tt.first, tt.other, first)
+			}
+
+			for _, key := range []string{first, other} {
+				if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+					t.Errorf("slotKey() = %q is not a ConfigMap key: %s", key, errs[0])
+				}
+			}
+
+			if slotKey(tt.first) != first {
+				t.Errorf("slotKey(%q) is not stable", tt.first)
+			}
+		})
+	}
+}
+
+func TestTryAcquireSlot(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int
+		wantOther bool
+		wantSlots int
+	}{
+		{name: "single slot", limit: 1, wantOther: false, wantSlots: 1},
+		{name: "two slots", limit: 2, wantOther: true, wantSlots: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset()
+			expires := time.Now().Add(slotTTL)
+
+			acquired, err := tryAcquireSlot(context.Background(), client, "default", tt.limit, concurrencySlot{Holder: "ci/deploy", Release: "app", Expires: expires})
+			if err != nil || !acquired {
+				t.Fatalf("tryAcquireSlot() of the first holder = %v, error = %v", acquired, err)
+			}
+
+			// the second identity sanitizes to the same characters, it must not share the slot
+			acquired, err = tryAcquireSlot(context.Background(), client, "default", tt.limit, concurrencySlot{Holder: "ci_deploy", Release: "api", Expires: expires})
+			if err != nil || acquired != tt.wantOther {
+				t.Errorf("tryAcquireSlot() of the second holder = %v, error = %v, want %v", acquired, err, tt.wantOther)
+			}
+
+			cm, err := client.CoreV1().ConfigMaps("default").Get(context.Background(), concurrencyConfigMap, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(cm.Data) != tt.wantSlots {
+				t.Errorf("concurrency slots = %v, want %d", cm.Data, tt.wantSlots)
+			}
+
+			if err := releaseSlot(context.Background(), client, "default", "ci_deploy"); err != nil {
+				t.Fatalf("releaseSlot() error = %v", err)
+			}
+
+			cm, err = client.CoreV1().ConfigMaps("default").Get(context.Background(), concurrencyConfigMap, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, found := cm.Data[slotKey("ci/deploy")]; !found {
+				t.Errorf("releasing the second holder removed the slot of the first: %v", cm.Data)
+			}
+		})
+	}
+}
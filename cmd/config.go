@@ -0,0 +1,215 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"go.yaml.in/yaml/v3"
+)
+
+const defaultConfigFile = ".helm-lock.yaml"
+
+// configKey returns the config file key of a flag, lock-timeout becomes lockTimeout
+func configKey(name string) string {
+	parts := strings.Split(name, "-")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+
+	return strings.Join(parts, "")
+}
+
+// isListFlag reports whether the flag accepts repeated values
+func isListFlag(flag *pflag.Flag) bool {
+	return strings.HasSuffix(flag.Value.Type(), "Slice") || strings.HasSuffix(flag.Value.Type(), "Array")
+}
+
+// configValues converts a YAML value node to the flag values
+func configValues(flag *pflag.Flag, node *yaml.Node) ([]string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return nil, fmt.Errorf("has no value")
+		}
+
+		return []string{node.Value}, nil
+	case yaml.SequenceNode:
+		if !isListFlag(flag) {
+			return nil, fmt.Errorf("expects a single %s value, got a list", flag.Value.Type())
+		}
+
+		values := []string{}
+
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("list items must be scalar values")
+			}
+
+			values = append(values, item.Value)
+		}
+
+		return values, nil
+	case yaml.MappingNode:
+		if flag.Value.Type() != "stringToString" {
+			return nil, fmt.Errorf("expects a %s value, got a mapping", flag.Value.Type())
+		}
+
+		values := []string{}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("mapping values must be scalar values")
+			}
+
+			values = append(values, key.Value+"="+value.Value)
+		}
+
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unsupported value")
+	}
+}
+
+// loadConfig validates the config file and sets the flags not given on the command line,
+// each error carries the file line of the offending key
+func loadConfig(path string, fs *pflag.FlagSet) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s:%d: config must be a mapping of options", path, root.Line)
+	}
+
+	flags := map[string]*pflag.Flag{}
+
+	fs.VisitAll(func(flag *pflag.Flag) {
+		if flag.Name != "config" {
+			flags[configKey(flag.Name)] = flag
+		}
+	})
+
+	errs := []error{}
+	seen := map[string]bool{}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+
+		flag, found := flags[key.Value]
+		if !found {
+			errs = append(errs, fmt.Errorf("%s:%d: unknown key '%s'", path, key.Line, key.Value))
+
+			continue
+		}
+
+		if seen[key.Value] {
+			errs = append(errs, fmt.Errorf("%s:%d: duplicate key '%s'", path, key.Line, key.Value))
+
+			continue
+		}
+
+		seen[key.Value] = true
+
+		values, err := configValues(flag, value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: key '%s' %w", path, value.Line, key.Value, err))
+
+			continue
+		}
+
+		// command line flags take precedence over the config file
+		if flag.Changed {
+			continue
+		}
+
+		for _, v := range values {
+			if err := fs.Set(flag.Name, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s:%d: key '%s': %w", path, value.Line, key.Value, err))
+
+				break
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// setupConfig loads the --config file, or .helm-lock.yaml when it exists
+func setupConfig(opts *lockOptions, fs *pflag.FlagSet) error {
+	path := opts.configFile
+	if path == "" {
+		if _, err := os.Stat(defaultConfigFile); err != nil {
+			return nil
+		}
+
+		path = defaultConfigFile
+	}
+
+	return loadConfig(path, fs)
+}
+
+func newConfigCommand(lf *pflag.FlagSet) *cobra.Command {
+	validate := ""
+
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Check a helm-lock config file",
+		Args:  cobra.NoArgs,
+		// the config file under check must not be loaded before the command runs
+		PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+			return nil
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if validate == "" {
+				return fmt.Errorf("flag --validate is required")
+			}
+
+			if err := loadConfig(validate, lf); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stdout, "Config file '%s' is valid\n", validate)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&validate, "validate", "", "Config file to validate without running anything")
+
+	return cmd
+}
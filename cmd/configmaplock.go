@@ -0,0 +1,157 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// ConfigMapLock stores the leader election record in a ConfigMap annotation,
+// the same layout the removed client-go configmaps lock used
+type ConfigMapLock struct {
+	ConfigMapMeta metav1.ObjectMeta
+	Client        corev1client.ConfigMapsGetter
+	LockConfig    resourcelock.ResourceLockConfig
+	Labels        map[string]string
+	Annotations   map[string]string
+	Owners        []metav1.OwnerReference
+	pending       pendingAnnotations
+	cm            *corev1.ConfigMap
+}
+
+var _ resourcelock.Interface = &ConfigMapLock{}
+
+// Get returns the election record from a ConfigMap annotation
+func (cml *ConfigMapLock) Get(ctx context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	cm, err := cml.Client.ConfigMaps(cml.ConfigMapMeta.Namespace).Get(ctx, cml.ConfigMapMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cml.cm = cm
+
+	return configMapRecord(cm)
+}
+
+// configMapRecord decodes the election record from the ConfigMap annotation
+func configMapRecord(cm *corev1.ConfigMap) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	var record resourcelock.LeaderElectionRecord
+
+	recordStr, found := cm.Annotations[resourcelock.LeaderElectionRecordAnnotationKey]
+	if !found {
+		return &record, nil, nil
+	}
+
+	if err := json.Unmarshal([]byte(recordStr), &record); err != nil {
+		return nil, nil, err
+	}
+
+	return &record, []byte(recordStr), nil
+}
+
+// Create attempts to create a ConfigMap
+func (cml *ConfigMapLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	recordBytes, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+
+	annotations := maps.Clone(cml.Annotations)
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	maps.Copy(annotations, cml.pending.take())
+	annotations[resourcelock.LeaderElectionRecordAnnotationKey] = string(recordBytes)
+
+	cml.cm, err = cml.Client.ConfigMaps(cml.ConfigMapMeta.Namespace).Create(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            cml.ConfigMapMeta.Name,
+			Namespace:       cml.ConfigMapMeta.Namespace,
+			Labels:          cml.Labels,
+			Annotations:     annotations,
+			OwnerReferences: cml.Owners,
+		},
+	}, metav1.CreateOptions{})
+
+	return err
+}
+
+// Update will update an existing ConfigMap annotation, the holder also sets its owner references
+// on a reused ConfigMap
+func (cml *ConfigMapLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	if cml.cm == nil {
+		return errors.New("configmap not initialized, call get or create first")
+	}
+
+	recordBytes, err := json.Marshal(ler)
+	if err != nil {
+		return err
+	}
+
+	if cml.cm.Annotations == nil {
+		cml.cm.Annotations = make(map[string]string)
+	}
+
+	maps.Copy(cml.cm.Annotations, cml.pending.take())
+	cml.cm.Annotations[resourcelock.LeaderElectionRecordAnnotationKey] = string(recordBytes)
+
+	if ler.HolderIdentity != "" && ler.HolderIdentity == cml.Identity() {
+		cml.cm.OwnerReferences = cml.Owners
+	}
+
+	cm, err := cml.Client.ConfigMaps(cml.ConfigMapMeta.Namespace).Update(ctx, cml.cm, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	cml.cm = cm
+
+	return nil
+}
+
+// RecordEvent in leader election while adding meta-data
+func (cml *ConfigMapLock) RecordEvent(s string) {
+	if cml.LockConfig.EventRecorder == nil || cml.cm == nil {
+		return
+	}
+
+	subject := &corev1.ConfigMap{ObjectMeta: cml.cm.ObjectMeta}
+	subject.Kind = "ConfigMap"
+	subject.APIVersion = corev1.SchemeGroupVersion.String()
+	cml.LockConfig.EventRecorder.Eventf(subject, corev1.EventTypeNormal, "LeaderElection", fmt.Sprintf("%v %v", cml.LockConfig.Identity, s))
+}
+
+// Describe is used to convert details on current resource lock
+// into a string
+func (cml *ConfigMapLock) Describe() string {
+	return fmt.Sprintf("%v/%v", cml.ConfigMapMeta.Namespace, cml.ConfigMapMeta.Name)
+}
+
+// Identity returns the Identity of the lock
+func (cml *ConfigMapLock) Identity() string {
+	return cml.LockConfig.Identity
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// waitingForAnnotation is set on the held locks while the holder waits for another lock
+const waitingForAnnotation = "helm-lock/waiting-for"
+
+// Backoff of the holder that breaks a deadlock, and the longest followed chain of waiting holders
+const (
+	deadlockBackoff    = time.Second
+	deadlockMaxBackoff = 30 * time.Second
+	maxDeadlockChain   = 32
+)
+
+// errDeadlock is returned when the waiting holder backs off to break a lock cycle
+var errDeadlock = errors.New("deadlock detected")
+
+// waitingFor is the waitingForAnnotation value
+type waitingFor struct {
+	Holder string `json:"holder"`
+	Lock   string `json:"lock"`
+}
+
+// waitingForValue returns the annotation value announcing that the holder waits for the lock
+func waitingForValue(holder, lockName string) string {
+	value, err := json.Marshal(waitingFor{Holder: holder, Lock: lockName})
+	if err != nil {
+		return ""
+	}
+
+	return string(value)
+}
+
+// findDeadlock follows the waiting-for annotations from the awaited lock, it returns the holders
+// of the cycle when the chain leads back to one of the held locks
+func findDeadlock(ctx context.Context, client kubernetes.Interface, namespace, lockName string, held []string) ([]string, bool) {
+	var holders []string
+
+	for lockName != "" && len(holders) <= maxDeadlockChain {
+		lease, err := client.CoordinationV1().Leases(namespace).Get(ctx, lockName, metav1.GetOptions{})
+		if err != nil {
+			return nil, false
+		}
+
+		info := leaseLockInfo(lease)
+		if info.State != lockStateHeld {
+			return nil, false
+		}
+
+		// the annotation is kept on the lease after a release, it only counts for the current holder
+		var waiting waitingFor
+		if err := json.Unmarshal([]byte(lease.Annotations[waitingForAnnotation]), &waiting); err != nil || waiting.Holder != info.Holder {
+			return nil, false
+		}
+
+		if slices.Contains(holders, info.Holder) {
+			return nil, false
+		}
+
+		holders = append(holders, info.Holder)
+
+		if slices.Contains(held, waiting.Lock) {
+			return holders, true
+		}
+
+		lockName = waiting.Lock
+	}
+
+	return nil, false
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// waitingLease returns a lease held by the holder that waits for the lock
+func waitingLease(name, holder, waitsFor string, renewedAgo time.Duration) *coordinationv1.Lease {
+	lease := testLease(name, holder, renewedAgo)
+	lease.Annotations = map[string]string{waitingForAnnotation: waitingForValue(holder, waitsFor)}
+
+	return lease
+}
+
+func TestFindDeadlock(t *testing.T) {
+	tests := []struct {
+		name   string
+		leases []*coordinationv1.Lease
+		want   []string
+		found  bool
+	}{
+		{
+			name:   "holder not waiting",
+			leases: []*coordinationv1.Lease{testLease("helm-lock-b", "other", 0)},
+		},
+		{
+			name:   "free lock",
+			leases: []*coordinationv1.Lease{waitingLease("helm-lock-b", "other", "helm-lock-a", time.Minute)},
+		},
+		{
+			name:   "two holders",
+			leases: []*coordinationv1.Lease{waitingLease("helm-lock-b", "other", "helm-lock-a", 0)},
+			want:   []string{"other"},
+			found:  true,
+		},
+		{
+			name: "three holders",
+			leases: []*coordinationv1.Lease{
+				waitingLease("helm-lock-b", "second", "helm-lock-c", 0),
+				waitingLease("helm-lock-c", "third", "helm-lock-a", 0),
+			},
+			want:  []string{"second", "third"},
+			found: true,
+		},
+		{
+			name: "chain without this run",
+			leases: []*coordinationv1.Lease{
+				waitingLease("helm-lock-b", "second", "helm-lock-c", 0),
+				testLease("helm-lock-c", "third", 0),
+			},
+		},
+		{
+			name: "cycle without this run",
+			leases: []*coordinationv1.Lease{
+				waitingLease("helm-lock-b", "second", "helm-lock-c", 0),
+				waitingLease("helm-lock-c", "third", "helm-lock-b", 0),
+			},
+		},
+		{
+			name: "annotation of an earlier holder",
+			leases: []*coordinationv1.Lease{
+				func() *coordinationv1.Lease {
+					lease := testLease("helm-lock-b", "other", 0)
+					lease.Annotations = map[string]string{waitingForAnnotation: waitingForValue("earlier", "helm-lock-a")}
+
+					return lease
+				}(),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := make([]runtime.Object, 0, len(tt.leases))
+			for _, lease := range tt.leases {
+				objects = append(objects, lease)
+			}
+
+			client := fake.NewClientset(objects...)
+
+			holders, found := findDeadlock(context.Background(), client, "default", "helm-lock-b", []string{"helm-lock-a"})
+			if found != tt.found || !slices.Equal(holders, tt.want) {
+				t.Errorf("findDeadlock() = %v, %v, want %v, %v", holders, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+// barrierWriter blocks the first "Acquired lock" log line until all runs reached theirs
+type barrierWriter struct {
+	out     io.Writer
+	once    sync.Once
+	barrier *sync.WaitGroup
+}
+
+func (w *barrierWriter) Write(p []byte) (int, error) {
+	if strings.HasPrefix(string(p), "Acquired lock ") {
+		w.once.Do(func() {
+			w.barrier.Done()
+			w.barrier.Wait()
+		})
+	}
+
+	return w.out.Write(p)
+}
+
+// TestUmbrellaDeadlock runs two umbrella charts that depend on each other, each run holds the
+// dependency lock the other one waits for as its release lock
+func TestUmbrellaDeadlock(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	charts := map[string]string{"a": "b", "b": "a"}
+
+	for name, dependency := range charts {
+		chart := fmt.Sprintf("apiVersion: v2\nname: %s\nversion: 0.1.0\ndependencies:\n- name: %s\n  version: 0.1.0\n  repository: file://../%s\n", name, dependency, dependency)
+
+		if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, name, "Chart.yaml"), []byte(chart), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := fake.NewClientset()
+	done := make(chan error, len(charts))
+	outs := map[string]*syncBuffer{}
+
+	// both runs hold their dependency lock before they wait for the release lock
+	var barrier sync.WaitGroup
+	barrier.Add(len(charts))
+
+	for name := range charts {
+		_, actionConfig, err := loadFixture(writeFixture(t, deployedReleaseFixture), "default")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		outs[name] = &syncBuffer{}
+
+		opts := newTestOptions(&barrierWriter{out: outs[name], barrier: &barrier})
+		opts.identity = "runner-" + name
+		opts.releaseName = name
+		opts.helmArgs = []string{name, filepath.Join(dir, name)}
+		opts.lockDependencies = true
+		opts.dependencyReleaseName = defaultDependencyReleaseName
+
+		go func() {
+			done <- lockDependenciesAndExecute(context.Background(), client, actionConfig, opts, lockPrefix+name, &lockReport{started: time.Now()})
+		}()
+	}
+
+	for range charts {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("lockDependenciesAndExecute() error = %v", err)
+			}
+		case <-time.After(50 * time.Second):
+			t.Fatal("the umbrella runs did not break the deadlock")
+		}
+	}
+
+	// only the greater identity backs off
+	if want := "held by runner-a waiting for a dependency lock of this run: " + errDeadlock.Error(); !strings.Contains(outs["b"].String(), want) {
+		t.Errorf("runner-b output = %q, want %q", outs["b"].String(), want)
+	}
+
+	if strings.Contains(outs["a"].String(), errDeadlock.Error()) {
+		t.Errorf("runner-a output = %q, want no back off", outs["a"].String())
+	}
+}
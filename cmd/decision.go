@@ -0,0 +1,96 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// Policies that decide whether a release is rolled back
+const (
+	policyDeployed           = "deployed"
+	policyMissing            = "missing"
+	policyNoPreviousRevision = "failed-install-action"
+	policyDryRun             = "dry-run"
+	policyNoRollbackMatch    = "no-rollback-match"
+	policyRollbackLimit      = "rollback-limit"
+	policyRollbackWebhook    = "rollback-webhook"
+	policyPreviousRevision   = "previous-revision"
+	policyAnnotated          = "rollback-to-annotated"
+	policyLastGood           = "rollback-to-last-good"
+)
+
+// rollbackDecision is why a release checked under the lock was or was not rolled back,
+// it is logged as one line and kept in the --summary-json artifact
+type rollbackDecision struct {
+	Status    string `json:"status"`
+	Revisions int    `json:"revisions"`
+	Rollback  bool   `json:"rollback"`
+	Target    int    `json:"targetRevision,omitempty"`
+	Policy    string `json:"policy"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// String returns the decision in the key=value format of the summary line, the format is stable
+func (d *rollbackDecision) String() string {
+	target := "-"
+	if d.Target > 0 {
+		target = strconv.Itoa(d.Target)
+	}
+
+	line := fmt.Sprintf("helm-lock: rollback-decision status=%s revisions=%d rollback=%t target=%s policy=%s",
+		d.Status, d.Revisions, d.Rollback, target, d.Policy)
+	if d.Detail != "" {
+		line += " detail=" + strconv.Quote(d.Detail)
+	}
+
+	return line
+}
+
+// recordDecision logs the rollback decision and keeps it for the run summary
+func recordDecision(opts *lockOptions, report *lockReport, decision rollbackDecision) {
+	report.decision = &decision
+
+	opts.logger.Print(decision.String())
+}
+
+// statusDecision is the decision for a release that needs no rollback check
+func statusDecision(releaseStatus release.Status) rollbackDecision {
+	if releaseStatus == release.StatusUnknown {
+		return rollbackDecision{Status: statusMissing, Policy: policyMissing}
+	}
+
+	return rollbackDecision{Status: releaseStatus.String(), Policy: policyDeployed}
+}
+
+// rollbackTarget returns the revision a rollback to the version goes to, 0 is the previous revision
+func rollbackTarget(actionConfig *action.Configuration, releaseName string, version int) int {
+	if version != 0 {
+		return version
+	}
+
+	current, err := actionConfig.Releases.Last(releaseName)
+	if err != nil {
+		return 0
+	}
+
+	return current.Version - 1
+}
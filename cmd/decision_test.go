@@ -0,0 +1,173 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestRollbackDecisionString(t *testing.T) {
+	tests := []struct {
+		name     string
+		decision rollbackDecision
+		want     string
+	}{
+		{
+			name:     "deployed release",
+			decision: rollbackDecision{Status: "deployed", Policy: policyDeployed},
+			want:     "helm-lock: rollback-decision status=deployed revisions=0 rollback=false target=- policy=deployed",
+		},
+		{
+			name:     "rollback",
+			decision: rollbackDecision{Status: "failed", Revisions: 3, Rollback: true, Target: 2, Policy: policyPreviousRevision},
+			want:     "helm-lock: rollback-decision status=failed revisions=3 rollback=true target=2 policy=previous-revision",
+		},
+		{
+			name:     "detail",
+			decision: rollbackDecision{Status: "failed", Revisions: 2, Target: 1, Policy: policyRollbackWebhook, Detail: `webhook returned 403 Forbidden: "frozen"`},
+			want:     `helm-lock: rollback-decision status=failed revisions=2 rollback=false target=1 policy=rollback-webhook detail="webhook returned 403 Forbidden: \"frozen\""`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.decision.String(); got != tt.want {
+				t.Errorf("String() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollbackDecisionJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		decision rollbackDecision
+		want     string
+	}{
+		{
+			name:     "no rollback",
+			decision: rollbackDecision{Status: "deployed", Policy: policyDeployed},
+			want:     `{"status":"deployed","revisions":0,"rollback":false,"policy":"deployed"}`,
+		},
+		{
+			name:     "rollback",
+			decision: rollbackDecision{Status: "failed", Revisions: 2, Rollback: true, Target: 1, Policy: policyAnnotated, Detail: "stable"},
+			want:     `{"status":"failed","revisions":2,"rollback":true,"targetRevision":1,"policy":"rollback-to-annotated","detail":"stable"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.decision)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != tt.want {
+				t.Errorf("json = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollbackDecisionFields(t *testing.T) {
+	failedTwice := failedReleaseFixture + `- name: app
+  revision: 3
+  status: failed
+  chart: app
+  chartVersion: 1.0.2
+`
+	failedInstall := `releases:
+- name: app
+  revision: 1
+  status: failed
+`
+
+	tests := []struct {
+		name    string
+		fixture string
+		args    []string
+		want    rollbackDecision
+	}{
+		{
+			name:    "deployed release",
+			fixture: deployedReleaseFixture,
+			want:    rollbackDecision{Status: "deployed", Policy: policyDeployed},
+		},
+		{
+			name:    "missing release",
+			fixture: "releases: []\n",
+			want:    rollbackDecision{Status: statusMissing, Policy: policyMissing},
+		},
+		{
+			name:    "failed release",
+			fixture: failedReleaseFixture,
+			want:    rollbackDecision{Status: "failed", Revisions: 2, Rollback: true, Target: 1, Policy: policyPreviousRevision},
+		},
+		{
+			name:    "failed twice",
+			fixture: failedTwice,
+			want:    rollbackDecision{Status: "failed", Revisions: 3, Rollback: true, Target: 2, Policy: policyPreviousRevision},
+		},
+		{
+			name:    "failed twice with --rollback-to-last-good",
+			fixture: failedTwice,
+			args:    []string{"--rollback-to-last-good"},
+			want:    rollbackDecision{Status: "failed", Revisions: 3, Rollback: true, Target: 1, Policy: policyLastGood},
+		},
+		{
+			name:    "failed install",
+			fixture: failedInstall,
+			want:    rollbackDecision{Status: "failed", Revisions: 1, Policy: policyNoPreviousRevision, Detail: failedInstallSkip},
+		},
+		{
+			name:    "dry run",
+			fixture: failedReleaseFixture,
+			args:    []string{"--dry-run"},
+			want:    rollbackDecision{Status: "failed", Revisions: 2, Policy: policyDryRun},
+		},
+		{
+			name:    "no rollback match",
+			fixture: failedReleaseFixture,
+			args:    []string{"--no-rollback-match", "ap*"},
+			want:    rollbackDecision{Status: "failed", Revisions: 2, Policy: policyNoRollbackMatch, Detail: "ap*"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summaryPath := filepath.Join(t.TempDir(), "summary.json")
+			args := append([]string{"upgrade", "app", "./chart", "--fixture", writeFixture(t, tt.fixture), "--summary-json", summaryPath}, tt.args...)
+
+			if err := run(context.Background(), args); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			summary := readSummary(t, summaryPath)
+			if summary.Decision == nil || *summary.Decision != tt.want {
+				t.Errorf("decision = %+v, want %+v", summary.Decision, tt.want)
+			}
+
+			if summary.Decision != nil && summary.Rollback != tt.want.Rollback {
+				t.Errorf("summary rollback = %v, want %v", summary.Rollback, tt.want.Rollback)
+			}
+		})
+	}
+}
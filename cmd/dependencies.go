@@ -0,0 +1,233 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// defaultDependencyReleaseName is the release name of a dependency deployed on its own, the alias or the chart name
+const defaultDependencyReleaseName = "{{ .Name }}"
+
+// dependencyData is the context of the --dependency-release-name template
+type dependencyData struct {
+	Release string
+	Name    string
+	Chart   string
+}
+
+// dependencyReleases returns the sorted release names of the chart dependencies, a chart that is
+// not a local directory or archive has no known dependencies
+func dependencyReleases(opts *lockOptions) ([]string, error) {
+	ref := opts.chartRef()
+	if ref == "" {
+		return nil, nil
+	}
+
+	if _, err := os.Stat(ref); err != nil {
+		opts.logger.Printf("Warning: chart '%s' is not a local path, its dependencies are not locked", ref)
+
+		return nil, nil
+	}
+
+	chrt, err := loader.Load(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart '%s': %w", ref, err)
+	}
+
+	tmpl, err := template.New("dependency").Option("missingkey=error").Parse(opts.dependencyReleaseName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --dependency-release-name: %w", err)
+	}
+
+	var releases []string
+
+	for _, dep := range chrt.Metadata.Dependencies {
+		name := dep.Name
+		if dep.Alias != "" {
+			name = dep.Alias
+		}
+
+		var b strings.Builder
+		if err := tmpl.Execute(&b, dependencyData{Release: opts.releaseName, Name: name, Chart: dep.Name}); err != nil {
+			return nil, fmt.Errorf("failed to render --dependency-release-name: %w", err)
+		}
+
+		if releaseName := strings.TrimSpace(b.String()); releaseName != "" && releaseName != opts.releaseName {
+			releases = append(releases, releaseName)
+		}
+	}
+
+	slices.Sort(releases)
+
+	return slices.Compact(releases), nil
+}
+
+// lockDependenciesAndExecute locks the dependency releases and runs the command under the lock of the
+// release, a run waiting for the release lock in a cycle with another umbrella run releases the
+// dependency locks, backs off and retries like helm lock hold
+func lockDependenciesAndExecute(ctx context.Context, client kubernetes.Interface, actionConfig *action.Configuration, opts *lockOptions, lockName string, report *lockReport) error {
+	namespace := opts.lockNamespaceName()
+
+	releases, err := dependencyReleases(opts)
+	if err != nil {
+		return err
+	}
+
+	if len(releases) == 0 {
+		return acquireLockAndExecute(ctx, client, actionConfig, opts, lockName, namespace, report)
+	}
+
+	lockNames := make([]string, 0, len(releases))
+	for _, releaseName := range releases {
+		lockNames = append(lockNames, lockPrefix+releaseName)
+	}
+
+	if err := enterLocks(opts, namespace, lockNames...); err != nil {
+		return err
+	}
+
+	// the retries share the deadline of the first attempt
+	opts.deadline = opts.lockDeadline()
+
+	waitCtx, waitCancel := context.WithDeadline(ctx, opts.deadline)
+	defer waitCancel()
+
+	delay := deadlockBackoff
+
+	for {
+		err := func() error {
+			depCtx, holder, release, err := holdDependencyLocks(ctx, client, opts, releases)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			opts.dependencyLocks = holder
+			defer func() { opts.dependencyLocks = nil }()
+
+			return acquireLockAndExecute(depCtx, client, actionConfig, opts, lockName, namespace, report)
+		}()
+		if !errors.Is(err, errDeadlock) {
+			return err
+		}
+
+		backoff := delay/2 + rand.N(delay/2)
+		opts.logger.Printf("Warning: %v, released the dependency locks and retrying in %s", err, backoff.Round(time.Millisecond))
+
+		select {
+		case <-waitCtx.Done():
+			return fmt.Errorf("failed to acquire the locks: %w", ErrLockTimeout)
+		case <-time.After(backoff):
+		}
+
+		delay = min(delay*2, deadlockMaxBackoff)
+	}
+}
+
+// holdDependencyLocks acquires the locks of the dependency releases in sorted order before the lock of
+// the release, the returned context is canceled when one of them is lost and release frees them
+func holdDependencyLocks(ctx context.Context, client kubernetes.Interface, opts *lockOptions, releases []string) (context.Context, *lockHolder, func(), error) {
+	namespace := opts.lockNamespaceName()
+	identity := lockIdentity(opts, namespace)
+
+	holdCtx, cancel := context.WithCancel(klog.NewContext(ctx, opts.klogger.V(1)))
+	holder := &lockHolder{}
+
+	waitCtx, waitCancel := context.WithDeadline(ctx, opts.lockDeadline())
+	defer waitCancel()
+
+	opts.logger.Printf("Locking the dependency releases %s", strings.Join(releases, ", "))
+
+	locks := make([]heldLock, 0, len(releases))
+	for _, releaseName := range releases {
+		locks = append(locks, heldLock{release: releaseName, lock: lockPrefix + releaseName})
+	}
+
+	losts, err := holder.acquireAll(holdCtx, waitCtx, client, opts, namespace, locks, identity)
+	if err != nil {
+		cancel()
+		holder.wg.Wait()
+
+		return nil, nil, nil, err
+	}
+
+	opCtx, opCancel := context.WithCancel(ctx)
+
+	for _, lost := range losts {
+		go func() {
+			select {
+			case <-lost:
+				if opCtx.Err() == nil {
+					opts.logger.Printf("Warning: a dependency lock was lost, stopping the operation")
+				}
+
+				opCancel()
+			case <-opCtx.Done():
+			}
+		}()
+	}
+
+	release := func() {
+		opCancel()
+		cancel()
+		holder.wg.Wait()
+	}
+
+	return opCtx, holder, release, nil
+}
+
+// watchDependencyDeadlock announces on the dependency locks that the run waits for the release lock,
+// the wait is canceled with errDeadlock when the release lock is held in a cycle that this run breaks
+func watchDependencyDeadlock(ctx context.Context, cancel context.CancelCauseFunc, client kubernetes.Interface, holder *lockHolder, namespace, lockName, identity string, operationStarted <-chan struct{}) {
+	holder.announce(identity, lockName)
+	defer holder.announce(identity, "")
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-operationStarted:
+			return
+		case <-ticker.C:
+		}
+
+		// only the holder with the greatest identity in the cycle backs off, the others keep waiting
+		if holders, found := findDeadlock(ctx, client, namespace, lockName, holder.names); found && identity > slices.Max(holders) {
+			cancel(fmt.Errorf("lock '%s' is held by %s waiting for a dependency lock of this run: %w", lockName, strings.Join(holders, ", "), errDeadlock))
+
+			return
+		}
+	}
+}
@@ -16,9 +16,35 @@ limitations under the License.
 
 package cmd
 
+import "errors"
+
+// ErrLockTimeout is returned when the lock is not acquired within --lock-timeout
+var ErrLockTimeout = errors.New("timed out waiting for the lock")
+
+// ExitCodeRecovered is the exit code of a successful command that needed a rollback first
+const ExitCodeRecovered = 3
+
+// ExitCodeLockTimeout is the exit code when the lock was never acquired, the run can be retried later
+const ExitCodeLockTimeout = 4
+
+// ExitCodeNotHeld is the exit code of the release subcommand when there was no lock to release
+const ExitCodeNotHeld = 5
+
+// ExitCodeRollbackSubmitted is the exit code of a --rollback-async run that submitted a rollback
+// and did not run the helm command
+const ExitCodeRollbackSubmitted = 6
+
+// ExitCodeReleaseCheck is the exit code when the release check refused the operation: a missing release
+// with --on-missing-release fail, an unknown status with --strict-status, --require-deployed or --assert-status
+const ExitCodeReleaseCheck = 7
+
 // Error to report errors
 type Error struct {
 	error
 
 	Code int
 }
+
+func (e *Error) Unwrap() error {
+	return e.error
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const execOutputLimit = 64 * 1024
+
+// Values of --child-output
+const (
+	childOutputSeparate = "separate"
+	childOutputCombined = "combined"
+)
+
+// helmExecutor runs helm with the given arguments, the child stderr goes to stderr
+type helmExecutor func(ctx context.Context, opts *lockOptions, args []string, stderr io.Writer) error
+
+// tailBuffer keeps the last bytes written to it
+type tailBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.limit {
+		b.buf = b.buf[len(b.buf)-b.limit:]
+	}
+
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.buf)
+}
+
+// executeHelmCommand executes the original helm command
+func executeHelmCommand(ctx context.Context, opts *lockOptions) (err error) {
+	ctx, span := startSpan(ctx, opts, "helm")
+	defer func() { endSpan(span, err) }()
+
+	args := append([]string{opts.helmCommand}, opts.helmArgs...)
+	args = append(args, opts.helmFlags...)
+
+	executor := opts.executor
+	if executor == nil {
+		executor = runHelm
+	}
+
+	logArgs := args
+	if opts.auditFlags {
+		logArgs = append([]string{opts.helmCommand}, opts.helmArgs...)
+		logArgs = append(logArgs, redactFlags(opts.helmFlags)...)
+	}
+
+	// with combined output the helm stderr goes to stdout, the lock messages stay on stderr
+	var errOut io.Writer = os.Stderr
+	if opts.childOutput == childOutputCombined {
+		errOut = os.Stdout
+	}
+
+	for attempt := 0; ; attempt++ {
+		opts.logger.Printf("Executing: helm %s\n\n", strings.Join(logArgs, " "))
+
+		stderr := &tailBuffer{limit: execOutputLimit}
+
+		err = executor(ctx, opts, args, io.MultiWriter(errOut, stderr))
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= opts.execRetries || !retryableOutput(stderr.String(), opts.execRetryOn) || ctx.Err() != nil {
+			return classifyExit(err, stderr.String(), opts.exitCodeRules)
+		}
+
+		opts.logger.Printf("Helm command failed with a transient error, retrying (attempt %d of %d)", attempt+1, opts.execRetries)
+	}
+}
+
+// retryableOutput reports whether the helm output matches any retry pattern
+func retryableOutput(output string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern != "" && strings.Contains(output, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseSignal parses a signal name like SIGTERM or TERM
+func parseSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	sig := signalNum(name)
+	if sig == 0 {
+		return 0, fmt.Errorf("unknown signal '%s'", name)
+	}
+
+	return sig, nil
+}
+
+// runHelm runs the helm binary, on context expiry the child gets the timeout signal and is killed after the grace period
+func runHelm(ctx context.Context, opts *lockOptions, args []string, stderr io.Writer) error {
+	if opts.promptTimeout <= 0 {
+		return execHelm(ctx, opts, args, os.Stdout, stderr)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	watcher := &promptWatcher{last: time.Now()}
+
+	go func() {
+		ticker := time.NewTicker(promptPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if prompt, ok := watcher.prompt(opts.promptTimeout); ok {
+					cancel(fmt.Errorf("helm waited for input for more than %s after '%s': %w", opts.promptTimeout, prompt, errPromptTimeout))
+
+					return
+				}
+			}
+		}
+	}()
+
+	err := execHelm(ctx, opts, args, io.MultiWriter(os.Stdout, watcher), io.MultiWriter(stderr, watcher))
+	if cause := context.Cause(ctx); errors.Is(cause, errPromptTimeout) {
+		return cause
+	}
+
+	return err
+}
+
+// errPromptTimeout is returned when helm seems to wait for input longer than --prompt-timeout
+var errPromptTimeout = errors.New("helm appears to wait on an interactive prompt")
+
+const (
+	promptPollInterval = time.Second
+	promptLineLimit    = 256
+)
+
+// promptWatcher tracks the helm output, a last line without a newline followed by silence
+// looks like a prompt waiting for input
+type promptWatcher struct {
+	mu   sync.Mutex
+	last time.Time
+	line []byte
+}
+
+func (w *promptWatcher) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.last = time.Now()
+
+	if i := bytes.LastIndexByte(p, '\n'); i >= 0 {
+		w.line = append(w.line[:0], p[i+1:]...)
+	} else {
+		w.line = append(w.line, p...)
+	}
+
+	if len(w.line) > promptLineLimit {
+		w.line = w.line[len(w.line)-promptLineLimit:]
+	}
+
+	return len(p), nil
+}
+
+// prompt returns the unfinished last line when there was no output for the timeout
+func (w *promptWatcher) prompt(timeout time.Duration) (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	line := strings.TrimSpace(string(w.line))
+	if line == "" || time.Since(w.last) < timeout {
+		return "", false
+	}
+
+	return line, true
+}
+
+// execHelm runs the helm binary with the given stdout and stderr
+func execHelm(ctx context.Context, opts *lockOptions, args []string, stdout, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, "helm", args...)
+	cmd.Cancel = func() error {
+		switch cause := context.Cause(ctx); {
+		case errors.Is(cause, errPromptTimeout):
+			opts.logger.Printf("Helm waits for input, sending %s to helm", signalName(opts.timeoutSignal))
+		case errors.Is(cause, errParentExited):
+			opts.logger.Printf("Parent process exited, sending %s to helm", signalName(opts.timeoutSignal))
+		default:
+			opts.logger.Printf("Operation timed out, sending %s to helm", signalName(opts.timeoutSignal))
+		}
+
+		if opts.dieWithParent {
+			return signalProcessGroup(cmd, opts.timeoutSignal)
+		}
+
+		return cmd.Process.Signal(opts.timeoutSignal)
+	}
+
+	if opts.dieWithParent {
+		setDieWithParent(cmd, opts.timeoutSignal)
+	}
+	cmd.WaitDelay = opts.termGrace
+	cmd.Env = append(os.Environ(), activeLockEnv(opts.lockNamespaceName(), opts.activeLocks...))
+
+	// helm must talk to the cluster the lock is held in
+	if kubeconfig := opts.helmSettings.KubeConfig; kubeconfig != "" {
+		cmd.Env = append(cmd.Env, "KUBECONFIG="+kubeconfig)
+	}
+
+	// plugins like helm-secrets read the namespace from the environment
+	if opts.releaseNamespace != "" {
+		cmd.Env = append(cmd.Env, "HELM_NAMESPACE="+opts.releaseNamespace)
+	}
+
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Stdin = os.Stdin
+
+	// with --assume-yes a prompt reads end of file instead of waiting, the arguments and
+	// environment are the same
+	if opts.assumeYes {
+		cmd.Stdin = nil
+	}
+
+	return cmd.Run()
+}
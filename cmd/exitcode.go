@@ -0,0 +1,77 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// exitCodeSignatures are the built-in helm error categories and their stderr signatures
+var exitCodeSignatures = map[string][]string{
+	"release-not-found": {"release: not found", "has no deployed releases"},
+	"values-validation": {"values don't meet the specifications of the schema"},
+	"timeout":           {"timed out waiting for the condition", "context deadline exceeded"},
+}
+
+// exitCodeRule maps helm errors with any of the signatures to the exit code
+type exitCodeRule struct {
+	name       string
+	signatures []string
+	code       int
+}
+
+// parseExitCodeMap parses the --exit-code-map entries, a key is a built-in category or a literal
+// stderr substring, the rules are matched in the given order
+func parseExitCodeMap(entries []string) ([]exitCodeRule, error) {
+	rules := make([]exitCodeRule, 0, len(entries))
+
+	for _, entry := range entries {
+		key, value, found := strings.Cut(entry, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid --exit-code-map entry '%s', must be CATEGORY=CODE or SUBSTRING=CODE", entry)
+		}
+
+		code, err := strconv.Atoi(value)
+		if err != nil || code < 1 || code > 255 {
+			return nil, fmt.Errorf("invalid --exit-code-map code '%s', must be between 1 and 255", value)
+		}
+
+		signatures, builtin := exitCodeSignatures[key]
+		if !builtin {
+			signatures = []string{key}
+		}
+
+		rules = append(rules, exitCodeRule{name: key, signatures: signatures, code: code})
+	}
+
+	return rules, nil
+}
+
+// classifyExit maps a failed helm command to the exit code of the first matching rule,
+// the error is returned unchanged when nothing matches
+func classifyExit(err error, output string, rules []exitCodeRule) error {
+	for _, rule := range rules {
+		if slices.ContainsFunc(rule.signatures, func(signature string) bool { return strings.Contains(output, signature) }) {
+			return &Error{error: err, Code: rule.code}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+)
+
+// fixture describes a recorded cluster state used for offline runs
+type fixture struct {
+	Releases []fixtureRelease `json:"releases,omitempty"`
+	Leases   []fixtureLease   `json:"leases,omitempty"`
+}
+
+// fixtureRelease is a single release revision
+type fixtureRelease struct {
+	Name         string         `json:"name"`
+	Namespace    string         `json:"namespace,omitempty"`
+	Revision     int            `json:"revision"`
+	Status       string         `json:"status"`
+	Chart        string         `json:"chart,omitempty"`
+	ChartVersion string         `json:"chartVersion,omitempty"`
+	Values       map[string]any `json:"values,omitempty"`
+
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// fixtureLease is the lock state, the lease is never renewed during the run
+type fixtureLease struct {
+	Name                 string          `json:"name"`
+	Namespace            string          `json:"namespace,omitempty"`
+	HolderIdentity       string          `json:"holderIdentity"`
+	LeaseDurationSeconds int32           `json:"leaseDurationSeconds,omitempty"`
+	RenewedAgo           metav1.Duration `json:"renewedAgo,omitempty"`
+}
+
+// loadFixture builds a fake clientset and an in-memory Helm action config from the fixture file
+func loadFixture(path, namespace string) (kubernetes.Interface, *action.Configuration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+
+	var fx fixture
+	if err := yaml.UnmarshalStrict(data, &fx); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+
+	mem := driver.NewMemory()
+	mem.SetNamespace(namespace)
+
+	store := storage.Init(mem)
+
+	for _, r := range fx.Releases {
+		rel := &release.Release{
+			Name:      r.Name,
+			Namespace: r.Namespace,
+			Version:   r.Revision,
+			Info: &release.Info{
+				Status: release.Status(r.Status),
+			},
+			Chart: &chart.Chart{
+				Metadata: &chart.Metadata{
+					Name:        r.Chart,
+					Version:     r.ChartVersion,
+					APIVersion:  chart.APIVersionV2,
+					Annotations: r.Annotations,
+				},
+			},
+			Config: r.Values,
+			Labels: r.Labels,
+		}
+		if rel.Namespace == "" {
+			rel.Namespace = namespace
+		}
+
+		if err := store.Create(rel); err != nil {
+			return nil, nil, fmt.Errorf("failed to load fixture release %s: %w", r.Name, err)
+		}
+	}
+
+	clientset := fake.NewClientset()
+
+	// the fixture grants every permission
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		review.Status.Allowed = true
+
+		return true, review, nil
+	})
+
+	for _, l := range fx.Leases {
+		ns := l.Namespace
+		if ns == "" {
+			ns = namespace
+		}
+
+		duration := l.LeaseDurationSeconds
+		if duration == 0 {
+			duration = 15
+		}
+
+		renewTime := metav1.NewMicroTime(time.Now().Add(-l.RenewedAgo.Duration))
+		lease := &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      l.Name,
+				Namespace: ns,
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &l.HolderIdentity,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &renewTime,
+				RenewTime:            &renewTime,
+			},
+		}
+
+		if _, err := clientset.CoordinationV1().Leases(ns).Create(context.Background(), lease, metav1.CreateOptions{}); err != nil {
+			return nil, nil, fmt.Errorf("failed to load fixture lease %s: %w", l.Name, err)
+		}
+	}
+
+	actionConfig := &action.Configuration{
+		Releases:     store,
+		KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard, LogOutput: io.Discard},
+		Capabilities: chartutil.DefaultCapabilities,
+		Log:          func(_ string, _ ...any) {},
+	}
+
+	return clientset, actionConfig, nil
+}
+
+// echoHelmCommand prints the helm command instead of executing it
+func echoHelmCommand(_ context.Context, _ *lockOptions, args []string, _ io.Writer) error {
+	fmt.Fprintf(os.Stdout, "helm %s\n", strings.Join(args, " "))
+
+	return nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLoadFixture(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		namespace   string
+		wantStatus  string
+		wantHolders map[string]string
+		wantErr     bool
+	}{
+		{
+			name:       "failed release",
+			content:    failedReleaseFixture,
+			namespace:  "default",
+			wantStatus: "failed",
+		},
+		{
+			name:       "missing release",
+			content:    "releases: []\n",
+			namespace:  "default",
+			wantStatus: "unknown",
+		},
+		{
+			name: "leases",
+			content: `leases:
+- name: helm-lock-app
+  holderIdentity: runner
+- name: helm-lock-api
+  namespace: locks
+  holderIdentity: other
+  renewedAgo: 1m
+`,
+			namespace:   "production",
+			wantStatus:  "unknown",
+			wantHolders: map[string]string{"production/helm-lock-app": "runner", "locks/helm-lock-api": "other"},
+		},
+		{
+			name:    "unknown field",
+			content: "releases:\n- name: app\n  revison: 1\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate revision",
+			content: failedReleaseFixture + "- name: app\n  revision: 2\n  status: deployed\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, actionConfig, err := loadFixture(writeFixture(t, tt.content), tt.namespace)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadFixture() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			status, err := getReleaseStatus(actionConfig, "app")
+			if err != nil {
+				t.Fatalf("getReleaseStatus() error = %v", err)
+			}
+
+			if string(status) != tt.wantStatus {
+				t.Errorf("release status = %q, want %q", status, tt.wantStatus)
+			}
+
+			for key, holder := range tt.wantHolders {
+				namespace, name, _ := strings.Cut(key, "/")
+
+				lease, err := client.CoordinationV1().Leases(namespace).Get(context.Background(), name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("failed to get the lease %s: %v", key, err)
+				}
+
+				if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != holder {
+					t.Errorf("lease %s holder = %v, want %q", key, lease.Spec.HolderIdentity, holder)
+				}
+			}
+
+			review, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(context.Background(), &authorizationv1.SelfSubjectAccessReview{}, metav1.CreateOptions{})
+			if err != nil || !review.Status.Allowed {
+				t.Errorf("fixture access review = %+v, %v, want allowed", review, err)
+			}
+		})
+	}
+}
+
+func TestLoadFixtureMissingFile(t *testing.T) {
+	if _, _, err := loadFixture(filepath.Join(t.TempDir(), "missing.yaml"), "default"); err == nil {
+		t.Error("loadFixture() of a missing file succeeded")
+	}
+}
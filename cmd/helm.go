@@ -17,28 +17,108 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/mattn/go-shellwords"
+	"github.com/spf13/pflag"
+
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
-// getAllFlags extracts all flags from os.Args except for --lock-timeout
-func getAllFlags() []string {
+// helmValueFlags are the flags of the wrapped helm commands that always take a value
+var helmValueFlags = []string{
+	"--set", "--set-string", "--set-file", "--set-json", "--set-literal", "--values", "-f",
+	"--description", "--version", "--timeout", "--history-max", "--post-renderer", "--post-renderer-args",
+	"--output", "-o", "--name-template", "--repo", "--username", "--password", "--ca-file", "--cert-file",
+	"--key-file", "--keyring", "--labels", "-l", "--api-versions", "-a", "--kube-version", "--cascade",
+	"--max", "--revision", "--output-dir", "--show-only", "-s", "--release-name",
+}
+
+// takesValue reports whether the helm flag is known to take a value, and whether it is known at all
+func takesValue(name string, helmGlobal *pflag.FlagSet) (value, known bool) {
+	if slices.Contains(helmValueFlags, name) {
+		return true, true
+	}
+
+	if helmGlobal == nil {
+		return false, false
+	}
+
+	var flag *pflag.Flag
+	if long, ok := strings.CutPrefix(name, "--"); ok {
+		flag = helmGlobal.Lookup(long)
+	} else if short, ok := strings.CutPrefix(name, "-"); ok && len(short) == 1 {
+		flag = helmGlobal.ShorthandLookup(short)
+	}
+
+	if flag == nil {
+		return false, false
+	}
+
+	return flag.NoOptDefVal == "", true
+}
+
+// joinDashValues joins a flag of helmValueFlags and a value that starts with a dash into one
+// --flag=value argument, the flag parser would take such a value for a flag of its own.
+// The arguments after the -- separator are not parsed and are kept as they are
+func joinDashValues(args []string) []string {
+	result := make([]string, 0, len(args))
+
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			return append(result, args[i:]...)
+		}
+
+		if slices.Contains(helmValueFlags, args[i]) && i+1 < len(args) && strings.HasPrefix(args[i+1], "-") {
+			result = append(result, args[i]+"="+args[i+1])
+			i++
+
+			continue
+		}
+
+		result = append(result, args[i])
+	}
+
+	return result
+}
+
+// getAllFlags extracts all flags from args except for the helm-lock own flags. The arguments are
+// already split by the shell and are kept verbatim, the value of a flag known to take one is taken
+// as is even when it starts with a dash
+func getAllFlags(args []string, own, helmGlobal *pflag.FlagSet) []string {
 	flags := []string{}
 
-	args := os.Args[1:]
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
-		if strings.HasPrefix(arg, "--lock-timeout") {
+
+		if name, ok := ownFlag(arg, own); ok {
+			if !strings.Contains(arg, "=") && own.Lookup(name).NoOptDefVal == "" {
+				i++
+			}
+
 			continue
 		}
 
 		if strings.HasPrefix(arg, "-") {
 			if strings.Contains(arg, "=") {
 				flags = append(flags, arg)
+			} else if value, known := takesValue(arg, helmGlobal); known {
+				if value && i+1 < len(args) {
+					flags = append(flags, arg, args[i+1])
+					i++
+				} else {
+					flags = append(flags, arg)
+				}
 			} else {
 				if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
 					flags = append(flags, arg, args[i+1])
@@ -53,27 +133,301 @@ func getAllFlags() []string {
 	return flags
 }
 
-// getReleaseStatus returns the current release status
+// splitHelmArgs takes the helm command after the -- separator verbatim, the command, release
+// and chart are the leading arguments up to the first flag, so no heuristic is needed
+func splitHelmArgs(opts *lockOptions, argv, flags []string) error {
+	positional := len(argv)
+	for i, arg := range argv {
+		if strings.HasPrefix(arg, "-") {
+			positional = i
+
+			break
+		}
+	}
+
+	opts.helmCommand = argv[0]
+	opts.helmArgs = argv[1:positional]
+	opts.helmFlags = append(slices.Clone(argv[positional:]), flags...)
+
+	releaseName, err := ResolveReleaseName(opts.helmCommand, argv[1:])
+	if err != nil {
+		return err
+	}
+
+	opts.releaseName = releaseName
+
+	return nil
+}
+
+// extraArgs splits the HELM_LOCK_EXTRA_ARGS value into shell words, quotes are respected
+// and nothing is expanded
+func extraArgs() ([]string, error) {
+	value := os.Getenv(extraArgsEnv)
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	args, err := shellwords.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", extraArgsEnv, err)
+	}
+
+	return args, nil
+}
+
+// ownFlag reports whether arg is one of the helm-lock own flags
+func ownFlag(arg string, own *pflag.FlagSet) (string, bool) {
+	if own == nil || !strings.HasPrefix(arg, "--") {
+		return "", false
+	}
+
+	name, _, _ := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+
+	return name, own.Lookup(name) != nil
+}
+
+// hasFlag reports whether any of the flag names is present in the helm flags
+func hasFlag(flags []string, names ...string) bool {
+	for _, flag := range flags {
+		name, _, _ := strings.Cut(flag, "=")
+		if slices.Contains(names, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setsValue reports whether a --set style flag in the helm flags sets the key
+func setsValue(flags []string, key string) bool {
+	for i, flag := range flags {
+		name, value, found := strings.Cut(flag, "=")
+		if !slices.Contains(setFlags, name) && name != "--set-file" {
+			continue
+		}
+
+		if !found {
+			if i+1 >= len(flags) {
+				continue
+			}
+
+			value = flags[i+1]
+		}
+
+		for entry := range strings.SplitSeq(value, ",") {
+			if k, _, _ := strings.Cut(entry, "="); strings.TrimSpace(k) == key {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// holderValueFlags returns the --set-string flag recording the holder, commas and backslashes are
+// escaped for the helm value parser
+func holderValueFlags(key, identity string) []string {
+	value := strings.NewReplacer(`\`, `\\`, ",", `\,`).Replace(identity)
+
+	return []string{"--set-string", key + "=" + value}
+}
+
+// withoutNamespaceFlags returns the helm flags without -n and --namespace
+func withoutNamespaceFlags(flags []string) []string {
+	result := make([]string, 0, len(flags))
+
+	for i := 0; i < len(flags); i++ {
+		name, _, found := strings.Cut(flags[i], "=")
+
+		switch {
+		case name == "-n" || name == "--namespace":
+			if !found {
+				i++
+			}
+		case strings.HasPrefix(name, "-n") && !strings.HasPrefix(name, "--"):
+			// -nNAMESPACE
+		default:
+			result = append(result, flags[i])
+		}
+	}
+
+	return result
+}
+
+// extraArgsEnv holds helm arguments appended to the forwarded ones
+const extraArgsEnv = "HELM_LOCK_EXTRA_ARGS"
+
+// errStatusUndetermined is returned for an existing release without a known status
+var errStatusUndetermined = errors.New("release status cannot be determined")
+
+// getReleaseStatus returns the current release status, StatusUnknown for a missing release
 func getReleaseStatus(actionConfig *action.Configuration, releaseName string) (release.Status, error) {
 	getAction := action.NewGet(actionConfig)
 
 	rel, err := getAction.Run(releaseName)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, driver.ErrReleaseNotFound) {
 			return release.StatusUnknown, nil
 		}
 
 		return release.StatusUnknown, err
 	}
 
+	if rel.Info == nil || rel.Info.Status == "" || rel.Info.Status == release.StatusUnknown {
+		return release.StatusUnknown, errStatusUndetermined
+	}
+
 	return rel.Info.Status, nil
 }
 
+// flagValue returns the value of the first matching flag in the helm flags
+func flagValue(flags []string, names ...string) (string, bool) {
+	for i, flag := range flags {
+		name, value, found := strings.Cut(flag, "=")
+		if !slices.Contains(names, name) {
+			continue
+		}
+
+		if found {
+			return value, true
+		}
+
+		if i+1 < len(flags) && !strings.HasPrefix(flags[i+1], "-") {
+			return flags[i+1], true
+		}
+
+		return "", true
+	}
+
+	return "", false
+}
+
+// getDeployedChartVersion returns the chart version of the last deployed revision
+func getDeployedChartVersion(actionConfig *action.Configuration, releaseName string) (string, error) {
+	historyAction := action.NewHistory(actionConfig)
+
+	history, err := historyAction.Run(releaseName)
+	if err != nil {
+		return "", err
+	}
+
+	releaseutil.Reverse(history, releaseutil.SortByRevision)
+
+	for _, rel := range history {
+		if rel.Info != nil && rel.Info.Status == release.StatusDeployed && rel.Chart != nil && rel.Chart.Metadata != nil {
+			return rel.Chart.Metadata.Version, nil
+		}
+	}
+
+	return "", nil
+}
+
+// getChartAnnotation returns the chart annotation of the latest release revision
+func getChartAnnotation(actionConfig *action.Configuration, releaseName, key string) (string, error) {
+	getAction := action.NewGet(actionConfig)
+
+	rel, err := getAction.Run(releaseName)
+	if err != nil {
+		return "", err
+	}
+
+	if rel.Chart == nil || rel.Chart.Metadata == nil {
+		return "", nil
+	}
+
+	return rel.Chart.Metadata.Annotations[key], nil
+}
+
+// getReleaseRevisions returns the number of revisions in the release history
+func getReleaseRevisions(actionConfig *action.Configuration, releaseName string) (int, error) {
+	historyAction := action.NewHistory(actionConfig)
+
+	history, err := historyAction.Run(releaseName)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(history), nil
+}
+
+// findAnnotatedRevision returns the most recent previous revision carrying the key, or key=value,
+// in its release labels or chart annotations, 0 when there is none
+func findAnnotatedRevision(actionConfig *action.Configuration, releaseName, selector string) (int, error) {
+	historyAction := action.NewHistory(actionConfig)
+
+	history, err := historyAction.Run(releaseName)
+	if err != nil {
+		return 0, err
+	}
+
+	key, value, withValue := strings.Cut(selector, "=")
+
+	matches := func(m map[string]string) bool {
+		v, found := m[key]
+
+		return found && (!withValue || v == value)
+	}
+
+	latest, found := 0, 0
+
+	for _, rel := range history {
+		latest = max(latest, rel.Version)
+	}
+
+	for _, rel := range history {
+		if rel.Version == latest || rel.Version < found {
+			continue
+		}
+
+		annotations := map[string]string{}
+		if rel.Chart != nil && rel.Chart.Metadata != nil {
+			annotations = rel.Chart.Metadata.Annotations
+		}
+
+		if matches(rel.Labels) || matches(annotations) {
+			found = rel.Version
+		}
+	}
+
+	return found, nil
+}
+
+// findLastGoodRevision returns the most recent deployed revision before the latest one and the number
+// of failed revisions after it, 0 when there is none
+func findLastGoodRevision(actionConfig *action.Configuration, releaseName string) (int, int, error) {
+	historyAction := action.NewHistory(actionConfig)
+
+	history, err := historyAction.Run(releaseName)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	releaseutil.Reverse(history, releaseutil.SortByRevision)
+
+	failed := 0
+
+	for i, rel := range history {
+		if rel.Info == nil {
+			continue
+		}
+
+		if i > 0 && rel.Info.Status == release.StatusDeployed {
+			return rel.Version, failed, nil
+		}
+
+		if rel.Info.Status == release.StatusFailed {
+			failed++
+		}
+	}
+
+	return 0, failed, nil
+}
+
 // performRollback performs a Helm rollback operation using Helm client
-func performRollback(actionConfig *action.Configuration, releaseName string) error {
+func performRollback(actionConfig *action.Configuration, releaseName string, version int, wait bool) error {
 	rollbackAction := action.NewRollback(actionConfig)
-	rollbackAction.Version = 0 // 0 means rollback to previous version
-	rollbackAction.Wait = true
+	rollbackAction.Version = version // 0 means rollback to previous version
+	rollbackAction.Wait = wait
 	rollbackAction.Timeout = 300 * time.Second
 
 	if err := rollbackAction.Run(releaseName); err != nil {
@@ -82,3 +436,53 @@ func performRollback(actionConfig *action.Configuration, releaseName string) err
 
 	return nil
 }
+
+// isStaleRollbackError reports whether the rollback failed because the release history changed
+// after the status was read, for example a revision written by another process
+func isStaleRollbackError(err error) bool {
+	if errors.Is(err, driver.ErrReleaseExists) || errors.Is(err, driver.ErrReleaseNotFound) || apierrors.IsConflict(err) {
+		return true
+	}
+
+	return strings.Contains(err.Error(), "release has no") && strings.HasSuffix(err.Error(), "version")
+}
+
+// pruneHistory deletes the oldest release revisions until at most maxHistory are left,
+// the deployed revision is always kept
+func pruneHistory(actionConfig *action.Configuration, releaseName string, maxHistory int) (int, error) {
+	history, err := actionConfig.Releases.History(releaseName)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(history) <= maxHistory {
+		return 0, nil
+	}
+
+	deployed, err := actionConfig.Releases.Deployed(releaseName)
+	if err != nil && !errors.Is(err, driver.ErrNoDeployedReleases) {
+		return 0, err
+	}
+
+	releaseutil.SortByRevision(history)
+
+	pruned := 0
+
+	for _, rel := range history {
+		if len(history)-pruned <= maxHistory {
+			break
+		}
+
+		if deployed != nil && rel.Version == deployed.Version {
+			continue
+		}
+
+		if _, err := actionConfig.Releases.Delete(releaseName, rel.Version); err != nil {
+			return pruned, fmt.Errorf("failed to delete revision %d: %w", rel.Version, err)
+		}
+
+		pruned++
+	}
+
+	return pruned, nil
+}
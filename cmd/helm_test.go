@@ -0,0 +1,266 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/spf13/pflag"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// failingDriver is a release storage driver that fails every read with the error
+type failingDriver struct {
+	driver.Driver
+	err error
+}
+
+func (d *failingDriver) Get(string) (*release.Release, error) {
+	return nil, d.err
+}
+
+func (d *failingDriver) Query(map[string]string) ([]*release.Release, error) {
+	return nil, d.err
+}
+
+// storageActionConfig returns a Helm action config that reads releases from the driver
+func storageActionConfig(d driver.Driver) *action.Configuration {
+	return &action.Configuration{
+		Releases:     storage.Init(d),
+		KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard, LogOutput: io.Discard},
+		Capabilities: chartutil.DefaultCapabilities,
+		Log:          func(_ string, _ ...any) {},
+	}
+}
+
+func TestGetReleaseStatus(t *testing.T) {
+	errStorage := errors.New("connection refused")
+
+	tests := []struct {
+		name    string
+		err     error
+		want    release.Status
+		wantErr error
+	}{
+		{name: "not found", err: driver.ErrReleaseNotFound, want: release.StatusUnknown},
+		{name: "wrapped not found", err: fmt.Errorf("query: %w", driver.ErrReleaseNotFound), want: release.StatusUnknown},
+		{name: "not found message", err: errors.New("release: not found"), want: release.StatusUnknown, wantErr: errors.New("release: not found")},
+		{name: "storage error", err: errStorage, want: release.StatusUnknown, wantErr: errStorage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actionConfig := storageActionConfig(&failingDriver{Driver: driver.NewMemory(), err: tt.err})
+
+			got, err := getReleaseStatus(actionConfig, "app")
+			if got != tt.want {
+				t.Errorf("getReleaseStatus() = %q, want %q", got, tt.want)
+			}
+
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && (err == nil || err.Error() != tt.wantErr.Error()) {
+				t.Errorf("getReleaseStatus() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckReleaseStatus(t *testing.T) {
+	undetermined := `releases:
+- name: app
+  revision: 1
+  status: unknown
+`
+
+	tests := []struct {
+		name         string
+		fixture      string
+		err          error
+		strictStatus bool
+		want         release.Status
+		wantErr      error
+	}{
+		{name: "missing release", fixture: "releases: []\n", want: release.StatusUnknown},
+		{name: "undetermined status", fixture: undetermined, want: release.StatusUnknown},
+		{name: "undetermined status with --strict-status", fixture: undetermined, strictStatus: true, wantErr: errStatusUndetermined},
+		{name: "storage error", err: errors.New("connection refused"), wantErr: errors.New("failed to check release status: connection refused")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var actionConfig *action.Configuration
+
+			if tt.err != nil {
+				actionConfig = storageActionConfig(&failingDriver{Driver: driver.NewMemory(), err: tt.err})
+			} else {
+				var err error
+				if _, actionConfig, err = loadFixture(writeFixture(t, tt.fixture), "default"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			opts := newTestOptions(io.Discard)
+			opts.strictStatus = tt.strictStatus
+
+			got, err := checkReleaseStatus(actionConfig, opts)
+
+			switch {
+			case tt.wantErr == nil:
+				if err != nil {
+					t.Fatalf("checkReleaseStatus() error = %v", err)
+				}
+
+				if got != tt.want {
+					t.Errorf("checkReleaseStatus() = %q, want %q", got, tt.want)
+				}
+			case errors.Is(err, tt.wantErr):
+			case err == nil || err.Error() != tt.wantErr.Error():
+				t.Errorf("checkReleaseStatus() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtraArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "whitespace", value: " \t\n"},
+		{name: "plain words", value: "--set a=1 --set b=2", want: []string{"--set", "a=1", "--set", "b=2"}},
+		{name: "double quotes", value: `--set msg="hello world"`, want: []string{"--set", "msg=hello world"}},
+		{name: "single quotes", value: `--set-json '{"a": [1, 2]}'`, want: []string{"--set-json", `{"a": [1, 2]}`}},
+		{name: "escaped quote", value: `--set msg="say \"hi\""`, want: []string{"--set", `msg=say "hi"`}},
+		{name: "escaped space", value: `--set path=a\ b`, want: []string{"--set", "path=a b"}},
+		{name: "value with leading dash", value: `--set msg="-n test"`, want: []string{"--set", "msg=-n test"}},
+		{name: "empty quoted value", value: `--set msg=""`, want: []string{"--set", "msg="}},
+		{name: "newlines", value: "--set a=1\n--set b=2\n", want: []string{"--set", "a=1", "--set", "b=2"}},
+		{name: "no expansion", value: "--set home=$HOME --set cmd=`id`", want: []string{"--set", "home=$HOME", "--set", "cmd=`id`"}},
+		{name: "unterminated quote", value: `--set msg="hello`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(extraArgsEnv, tt.value)
+
+			got, err := extraArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extraArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("extraArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithoutNamespaceFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags []string
+		want  []string
+	}{
+		{name: "no namespace", flags: []string{"--wait", "--set", "a=1"}, want: []string{"--wait", "--set", "a=1"}},
+		{name: "long flag", flags: []string{"--namespace", "prod", "--wait"}, want: []string{"--wait"}},
+		{name: "long flag with value", flags: []string{"--namespace=prod", "--wait"}, want: []string{"--wait"}},
+		{name: "short flag", flags: []string{"--wait", "-n", "prod"}, want: []string{"--wait"}},
+		{name: "short flag with value", flags: []string{"-n=prod", "--wait"}, want: []string{"--wait"}},
+		{name: "short flag joined", flags: []string{"-nprod", "--wait"}, want: []string{"--wait"}},
+		{name: "several flags", flags: []string{"-n", "prod", "--set", "a=1", "--namespace", "stage"}, want: []string{"--set", "a=1"}},
+		{name: "similar flags", flags: []string{"--namespaces", "--no-hooks", "--set", "ns=-n"}, want: []string{"--namespaces", "--no-hooks", "--set", "ns=-n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withoutNamespaceFlags(tt.flags); !slices.Equal(got, tt.want) {
+				t.Errorf("withoutNamespaceFlags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinDashValues(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "plain values", args: []string{"upgrade", "app", "./chart", "--set", "a=1"}, want: []string{"upgrade", "app", "./chart", "--set", "a=1"}},
+		{name: "value with spaces", args: []string{"upgrade", "app", "./chart", "--set", "msg=hello world"}, want: []string{"upgrade", "app", "./chart", "--set", "msg=hello world"}},
+		{name: "value with a leading dash", args: []string{"upgrade", "app", "./chart", "--description", "-n test"}, want: []string{"upgrade", "app", "./chart", "--description=-n test"}},
+		{name: "value like a flag", args: []string{"--set-string", "--lock-timeout", "--wait"}, want: []string{"--set-string=--lock-timeout", "--wait"}},
+		{name: "short flag", args: []string{"-f", "-", "--wait"}, want: []string{"-f=-", "--wait"}},
+		{name: "boolean flag", args: []string{"--wait", "-n", "prod"}, want: []string{"--wait", "-n", "prod"}},
+		{name: "value flag at the end", args: []string{"upgrade", "--set"}, want: []string{"upgrade", "--set"}},
+		{name: "after the separator", args: []string{"--lock-timeout", "5m", "--", "upgrade", "--set", "-x"}, want: []string{"--lock-timeout", "5m", "--", "upgrade", "--set", "-x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := joinDashValues(tt.args); !slices.Equal(got, tt.want) {
+				t.Errorf("joinDashValues() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllFlags(t *testing.T) {
+	own := pflag.NewFlagSet("lock", pflag.ContinueOnError)
+	own.Duration("lock-timeout", 0, "")
+	own.Bool("lock-diff", false, "")
+
+	helmGlobal := pflag.NewFlagSet("helm", pflag.ContinueOnError)
+	cli.New().AddFlags(helmGlobal)
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "value with spaces", args: []string{"upgrade", "app", "./chart", "--set", "msg=hello world"}, want: []string{"--set", "msg=hello world"}},
+		{name: "value with a newline", args: []string{"--set", "msg=a\nb"}, want: []string{"--set", "msg=a\nb"}},
+		{name: "value with quotes", args: []string{"--set", `msg="-n test"`}, want: []string{"--set", `msg="-n test"`}},
+		{name: "value with a leading dash", args: []string{"--description", "-n test", "--wait"}, want: []string{"--description", "-n test", "--wait"}},
+		{name: "joined value with a leading dash", args: []string{"--description=-n test", "--wait"}, want: []string{"--description=-n test", "--wait"}},
+		{name: "helm global flag", args: []string{"-n", "prod", "--kube-context", "-ctx"}, want: []string{"-n", "prod", "--kube-context", "-ctx"}},
+		{name: "helm global boolean flag", args: []string{"--debug", "app"}, want: []string{"--debug"}},
+		{name: "unknown flag", args: []string{"--atomic", "--custom", "value"}, want: []string{"--atomic", "--custom", "value"}},
+		{name: "own flags", args: []string{"--lock-timeout", "5m", "--lock-diff", "--set", "a=1", "--lock-timeout=1m"}, want: []string{"--set", "a=1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getAllFlags(tt.args, own, helmGlobal); !slices.Equal(got, tt.want) {
+				t.Errorf("getAllFlags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
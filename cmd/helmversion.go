@@ -0,0 +1,137 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// The helm binary versions compatible with the helm v3 libraries used for the status and the rollback
+var (
+	minHelmVersion = version.MustParseGeneric("v3.0.0")
+	maxHelmVersion = version.MustParseGeneric("v4.0.0")
+)
+
+const helmVersionTimeout = 10 * time.Second
+
+// helmVersionCache is the cached helm version, valid while the binary is not replaced
+type helmVersionCache struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Version string    `json:"version"`
+}
+
+// helmVersionCacheFile returns the file caching the helm version in the user cache directory
+func helmVersionCacheFile() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "helm-lock", "helm-version.json"), nil
+}
+
+// helmBinaryVersion returns the version of the helm binary helm-lock runs, from the cache when
+// the binary has the same path, size and modification time
+func helmBinaryVersion(ctx context.Context, opts *lockOptions) (string, error) {
+	path, err := exec.LookPath("helm")
+	if err != nil {
+		return "", err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	current := helmVersionCache{Path: path, Size: stat.Size(), ModTime: stat.ModTime().UTC()}
+
+	cacheFile, cacheErr := helmVersionCacheFile()
+	if cacheErr == nil {
+		var cached helmVersionCache
+		if data, err := os.ReadFile(cacheFile); err == nil && json.Unmarshal(data, &cached) == nil {
+			if cached.Path == current.Path && cached.Size == current.Size && cached.ModTime.Equal(current.ModTime) && cached.Version != "" {
+				return cached.Version, nil
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, helmVersionTimeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+
+	stderr := &tailBuffer{limit: execOutputLimit}
+
+	if err := execHelm(ctx, opts, []string{"version", "--short"}, &stdout, stderr); err != nil {
+		return "", fmt.Errorf("helm version failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	current.Version = strings.TrimSpace(stdout.String())
+
+	if cacheErr == nil {
+		if data, err := json.Marshal(current); err == nil {
+			if err := os.MkdirAll(filepath.Dir(cacheFile), 0o755); err == nil {
+				os.WriteFile(cacheFile, data, 0o644) //nolint:errcheck
+			}
+		}
+	}
+
+	return current.Version, nil
+}
+
+// checkHelmVersion warns when the helm binary is outside of the supported range, with
+// --strict-helm-version it fails instead
+func checkHelmVersion(ctx context.Context, opts *lockOptions) error {
+	report := func(err error) error {
+		if opts.strictHelmVersion {
+			return err
+		}
+
+		opts.logger.Printf("Warning: %v", err)
+
+		return nil
+	}
+
+	// v3.20.2+g8fb76d6 is parsed without the build metadata
+	value, err := helmBinaryVersion(ctx, opts)
+	if err != nil {
+		return report(fmt.Errorf("cannot determine the helm version: %w", err))
+	}
+
+	current, err := version.ParseGeneric(strings.SplitN(value, "+", 2)[0])
+	if err != nil {
+		return report(fmt.Errorf("cannot parse the helm version '%s': %w", value, err))
+	}
+
+	if current.LessThan(minHelmVersion) || !current.LessThan(maxHelmVersion) {
+		return report(fmt.Errorf("helm %s is not supported, helm-lock works with helm >= %s and < %s", value, minHelmVersion, maxHelmVersion))
+	}
+
+	return nil
+}
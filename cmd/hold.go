@@ -0,0 +1,391 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+// readReleasesFile reads one release name per line, empty lines and # comments are skipped,
+// the names are sorted so that concurrent runs acquire the locks in the same order
+func readReleasesFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read releases file: %w", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	var releases []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+
+		releases = append(releases, name)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read releases file: %w", err)
+	}
+
+	if len(releases) == 0 {
+		return nil, fmt.Errorf("releases file %s has no releases", path)
+	}
+
+	slices.Sort(releases)
+
+	return slices.Compact(releases), nil
+}
+
+// heldLock is a lock to hold and the release it is taken for
+type heldLock struct {
+	release string
+	lock    string
+}
+
+// heldLocks returns the locks of the releases sorted by lock name, like helm lock upgrade resolves
+// them, releases that share a lock take it once
+func heldLocks(opts *lockOptions, releases []string) ([]heldLock, error) {
+	locks := make([]heldLock, 0, len(releases))
+
+	for _, releaseName := range releases {
+		lockName, err := releaseLockName(opts, releaseName)
+		if err != nil {
+			return nil, err
+		}
+
+		if !slices.ContainsFunc(locks, func(l heldLock) bool { return l.lock == lockName }) {
+			locks = append(locks, heldLock{release: releaseName, lock: lockName})
+		}
+	}
+
+	slices.SortFunc(locks, func(a, b heldLock) int { return strings.Compare(a.lock, b.lock) })
+
+	return locks, nil
+}
+
+// lockHolder holds the locks of several releases until its context is canceled
+type lockHolder struct {
+	wg    sync.WaitGroup
+	names []string
+	locks []resourcelock.Interface
+}
+
+// announce sets the waiting-for annotation on the held locks, an empty lock name clears it
+func (h *lockHolder) announce(identity, lockName string) {
+	value := ""
+	if lockName != "" {
+		value = waitingForValue(identity, lockName)
+	}
+
+	for _, lock := range h.locks {
+		setLockAnnotation(lock, waitingForAnnotation, value)
+	}
+}
+
+// acquire waits until the lock is acquired or waitCtx is done, the lock is held until ctx is canceled
+// and the returned channel is closed when it is lost or released,
+// errDeadlock is returned when this holder backs off from a lock cycle
+func (h *lockHolder) acquire(ctx, waitCtx context.Context, client kubernetes.Interface, opts *lockOptions, namespace string, target heldLock, identity string) (<-chan struct{}, error) {
+	lockName := target.lock
+
+	lock, err := newResourceLock(client, opts, namespace, lockName, identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource lock: %w", err)
+	}
+
+	if err := setHolderAnnotations(lock, opts, namespace, target.release, identity); err != nil {
+		return nil, err
+	}
+
+	// the lock is held as long as the command runs, a value of an earlier holder must not apply
+	setLockAnnotation(lock, maxLifetimeAnnotation, "")
+
+	h.announce(identity, lockName)
+
+	retryPeriod := 2 * time.Second
+
+	acquired := make(chan struct{})
+	lost := make(chan struct{})
+
+	config := leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     retryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(_ context.Context) {
+				close(acquired)
+			},
+			OnStoppedLeading: func() {},
+		},
+	}
+	jitterRenewal(&config, opts.renewJitter)
+
+	elector, err := leaderelection.NewLeaderElector(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create leader elector: %w", err)
+	}
+
+	h.wg.Go(func() {
+		defer close(lost)
+
+		elector.Run(ctx)
+	})
+
+	ticker := time.NewTicker(retryPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-acquired:
+			opts.logger.Printf("Acquired lock '%s'", lockName)
+
+			h.names = append(h.names, lockName)
+			h.locks = append(h.locks, lock)
+
+			return lost, nil
+		case <-lost:
+			return nil, fmt.Errorf("failed to acquire lock '%s': %w", lockName, ctx.Err())
+		case <-waitCtx.Done():
+			return nil, fmt.Errorf("lock '%s' is held by '%s': %w", lockName, elector.GetLeader(), ErrLockTimeout)
+		case <-ticker.C:
+		}
+
+		if len(h.names) == 0 {
+			continue
+		}
+
+		// only the holder with the greatest identity in the cycle backs off, the others keep waiting
+		if holders, found := findDeadlock(ctx, client, namespace, lockName, h.names); found && identity > slices.Max(holders) {
+			return nil, fmt.Errorf("lock '%s' is held by %s waiting for a lock of this run: %w", lockName, strings.Join(holders, ", "), errDeadlock)
+		}
+	}
+}
+
+// acquireAll acquires the locks in order, the locks are held until ctx is canceled
+func (h *lockHolder) acquireAll(ctx, waitCtx context.Context, client kubernetes.Interface, opts *lockOptions, namespace string, locks []heldLock, identity string) ([]<-chan struct{}, error) {
+	var losts []<-chan struct{}
+
+	for _, target := range locks {
+		lost, err := h.acquire(ctx, waitCtx, client, opts, namespace, target, identity)
+		if err != nil {
+			return nil, err
+		}
+
+		losts = append(losts, lost)
+	}
+
+	h.announce(identity, "")
+
+	return losts, nil
+}
+
+// holdLocks acquires the locks of all releases, runs the command and releases the locks,
+// the command gets SIGTERM when a lock is lost or ctx is canceled
+func holdLocks(ctx context.Context, client kubernetes.Interface, opts *lockOptions, releases, command []string, timeout time.Duration) error {
+	namespace := opts.lockNamespaceName()
+	identity := lockIdentity(opts, namespace)
+
+	locks, err := heldLocks(opts, releases)
+	if err != nil {
+		return err
+	}
+
+	lockNames := make([]string, 0, len(locks))
+	for _, target := range locks {
+		lockNames = append(lockNames, target.lock)
+	}
+
+	if err := enterLocks(opts, namespace, lockNames...); err != nil {
+		return err
+	}
+
+	acquireCtx, acquireCancel := context.WithTimeout(ctx, timeout)
+	defer acquireCancel()
+
+	var (
+		holdCtx context.Context
+		cancel  context.CancelFunc
+		holder  *lockHolder
+		losts   []<-chan struct{}
+	)
+
+	delay := deadlockBackoff
+
+	for {
+		holdCtx, cancel = context.WithCancel(klog.NewContext(ctx, opts.klogger.V(1)))
+		holder = &lockHolder{}
+
+		losts, err = holder.acquireAll(holdCtx, acquireCtx, client, opts, namespace, locks, identity)
+		if err == nil {
+			break
+		}
+
+		cancel()
+		holder.wg.Wait()
+
+		if !errors.Is(err, errDeadlock) {
+			return err
+		}
+
+		backoff := delay/2 + rand.N(delay/2)
+		opts.logger.Printf("Warning: %v, released the held locks and retrying in %s", err, backoff.Round(time.Millisecond))
+
+		select {
+		case <-acquireCtx.Done():
+			return fmt.Errorf("failed to acquire the locks: %w", ErrLockTimeout)
+		case <-time.After(backoff):
+		}
+
+		delay = min(delay*2, deadlockMaxBackoff)
+	}
+
+	defer func() {
+		cancel()
+		holder.wg.Wait()
+	}()
+
+	cmdCtx, cmdCancel := context.WithCancel(holdCtx)
+	defer cmdCancel()
+
+	for _, lost := range losts {
+		go func() {
+			select {
+			case <-lost:
+				cmdCancel()
+			case <-cmdCtx.Done():
+			}
+		}()
+	}
+
+	opts.logger.Printf("Holding the locks of %s, executing: %s\n\n", strings.Join(releases, ", "), strings.Join(command, " "))
+
+	cmd := exec.CommandContext(cmdCtx, command[0], command[1:]...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = opts.termGrace
+	cmd.Env = append(os.Environ(),
+		"HELM_LOCK_HOLDER="+identity,
+		"HELM_LOCK_NAMESPACE="+namespace,
+		"HELM_LOCK_RELEASES="+strings.Join(releases, ","),
+		activeLockEnv(namespace, opts.activeLocks...),
+	)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	if cmdCtx.Err() != nil && ctx.Err() == nil {
+		return errors.Join(errors.New("a lock was lost while the command was running"), err)
+	}
+
+	return err
+}
+
+func newHoldCommand(opts *lockOptions) *cobra.Command {
+	timeout := defaultLockTimeout
+
+	var releasesFile string
+
+	cmd := &cobra.Command{
+		Use:   "hold --releases-file FILE -- COMMAND [ARGS...]",
+		Short: "Hold the locks of several releases while a command runs",
+		Example: strings.Join([]string{
+			"  helm lock hold --releases-file releases.txt -- helmfile sync",
+		}, "\n"),
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			releases, err := readReleasesFile(releasesFile)
+			if err != nil {
+				return err
+			}
+
+			clientset, _, err := newClients(opts)
+			if err != nil {
+				return err
+			}
+
+			opts.helmCommand = "hold"
+
+			return holdLocks(cmd.Context(), clientset, opts, releases, args, timeout)
+		},
+	}
+
+	cmd.Flags().StringVar(&releasesFile, "releases-file", "", "File with one release name per line")
+	cmd.Flags().DurationVar(&timeout, "lock-timeout", defaultLockTimeout, "Maximum time to acquire all the locks")
+	cmd.MarkFlagRequired("releases-file") //nolint:errcheck
+
+	return cmd
+}
+
+func newShellCommand(opts *lockOptions) *cobra.Command {
+	timeout := defaultLockTimeout
+
+	cmd := &cobra.Command{
+		Use:   "shell RELEASE",
+		Short: "Hold the lock of the release while an interactive shell runs",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			clientset, _, err := newClients(opts)
+			if err != nil {
+				return err
+			}
+
+			shell := os.Getenv("SHELL")
+			if shell == "" {
+				shell = "/bin/sh"
+			}
+
+			// Ctrl-C belongs to the shell, only SIGTERM and SIGHUP end the maintenance window
+			ctx, stop := signal.NotifyContext(context.WithoutCancel(cmd.Context()), syscall.SIGTERM, syscall.SIGHUP)
+			defer stop()
+
+			opts.helmCommand = "shell"
+
+			return holdLocks(ctx, clientset, opts, args, []string{shell}, timeout)
+		},
+	}
+
+	cmd.Flags().DurationVar(&timeout, "lock-timeout", defaultLockTimeout, "Maximum time to acquire the lock")
+
+	return cmd
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/klog/v2"
+)
+
+func TestReadReleasesFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{name: "sorted order", content: "web\napp\n  db  \n", want: []string{"app", "db", "web"}},
+		{name: "duplicates", content: "app\nweb\napp\n", want: []string{"app", "web"}},
+		{name: "comments and empty lines", content: "# platform\n\napp\n# web\n", want: []string{"app"}},
+		{name: "no releases", content: "# none\n\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "releases")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readReleasesFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readReleasesFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("readReleasesFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeldLocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		releases []string
+		lockName string
+		want     []heldLock
+		wantErr  bool
+	}{
+		{
+			name:     "release locks",
+			releases: []string{"app", "web"},
+			want:     []heldLock{{release: "app", lock: "helm-lock-app"}, {release: "web", lock: "helm-lock-web"}},
+		},
+		{
+			name:     "shared lock",
+			releases: []string{"app", "web"},
+			lockName: "platform",
+			want:     []heldLock{{release: "app", lock: "helm-lock-platform"}},
+		},
+		{
+			name:     "invalid lock name",
+			releases: []string{"app"},
+			lockName: "Platform_1",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := newTestOptions(io.Discard)
+			opts.lockName = tt.lockName
+
+			got, err := heldLocks(opts, tt.releases)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("heldLocks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("heldLocks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestHoldDeadlock simulates a run holding the lock of a that waits for b, while the holder of b
+// announced that it waits for a
+func TestHoldDeadlock(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity string
+		wantErr  error
+	}{
+		{name: "greater identity backs off", identity: "runner-z", wantErr: errDeadlock},
+		{name: "smaller identity keeps waiting", identity: "runner-a", wantErr: ErrLockTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := fake.NewClientset(waitingLease("helm-lock-b", "runner-m", "helm-lock-a", 0))
+
+			opts := newTestOptions(io.Discard)
+			opts.identity = tt.identity
+
+			ctx, cancel := context.WithCancel(klog.NewContext(context.Background(), logr.Discard()))
+			defer cancel()
+
+			// the deadlock check runs every retry period while waiting
+			waitCtx, waitCancel := context.WithTimeout(ctx, 3*time.Second)
+			defer waitCancel()
+
+			holder := &lockHolder{}
+
+			_, err := holder.acquireAll(ctx, waitCtx, client, opts, "default", []heldLock{{release: "a", lock: "helm-lock-a"}, {release: "b", lock: "helm-lock-b"}}, tt.identity)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("acquireAll() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if !slices.Equal(holder.names, []string{"helm-lock-a"}) {
+				t.Errorf("held locks = %v, want helm-lock-a", holder.names)
+			}
+
+			cancel()
+			holder.wg.Wait()
+		})
+	}
+}
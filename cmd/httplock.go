@@ -0,0 +1,279 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The http backend uses the timings of the Kubernetes leader election
+const (
+	httpLockTTL            = 15 * time.Second
+	httpLockRenewDeadline  = 10 * time.Second
+	httpLockRetryPeriod    = 2 * time.Second
+	httpLockRequestTimeout = 5 * time.Second
+	httpLockMessageLimit   = 1024
+)
+
+// errHTTPLockHeld is returned by a lock request when another holder has the lock
+var errHTTPLockHeld = errors.New("lock is held by another holder")
+
+// httpLockRequest is the body of the PUT request, it acquires a free or expired lock and renews a held one
+type httpLockRequest struct {
+	Holder     string `json:"holder"`
+	TTLSeconds int    `json:"ttlSeconds"`
+}
+
+// httpLockResponse is the body of a 409 Conflict response
+type httpLockResponse struct {
+	Holder string `json:"holder"`
+}
+
+// httpLocker is a lock held on a remote lock service, the protocol is:
+//
+//	PUT    <endpoint>/locks/<name> {"holder": ..., "ttlSeconds": ...}  2xx acquired or renewed, 409 held by another holder
+//	DELETE <endpoint>/locks/<name>?holder=<holder>                      2xx or 404 released, 409 held by another holder
+//
+// The service expires a lock that is not renewed within its TTL.
+type httpLocker struct {
+	endpoint string
+	name     string
+	holder   string
+	logger   func(format string, v ...any)
+	client   *http.Client
+
+	mu         sync.Mutex
+	lastHolder string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	lost   chan struct{}
+	once   sync.Once
+}
+
+var _ locker = &httpLocker{}
+
+// lockURL returns the URL of the lock on the service
+func (l *httpLocker) lockURL() string {
+	return strings.TrimSuffix(l.endpoint, "/") + "/locks/" + url.PathEscape(l.name)
+}
+
+// do sends one request with the request timeout and returns the holder of a held lock
+func (l *httpLocker) do(ctx context.Context, method, target string, body any) (string, error) {
+	var reader io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return "", err
+		}
+
+		reader = bytes.NewReader(data)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, httpLockRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return "", err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, httpLockMessageLimit))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return "", nil
+	case resp.StatusCode == http.StatusNotFound && method == http.MethodDelete:
+		return "", nil
+	case resp.StatusCode == http.StatusConflict:
+		var held httpLockResponse
+		if err := json.Unmarshal(msg, &held); err != nil || held.Holder == "" {
+			held.Holder = "unknown"
+		}
+
+		return held.Holder, errHTTPLockHeld
+	}
+
+	if m := strings.TrimSpace(string(msg)); m != "" {
+		return "", fmt.Errorf("lock service returned %s: %s", resp.Status, m)
+	}
+
+	return "", fmt.Errorf("lock service returned %s", resp.Status)
+}
+
+// put acquires or renews the lock
+func (l *httpLocker) put(ctx context.Context) (string, error) {
+	return l.do(ctx, http.MethodPut, l.lockURL(), httpLockRequest{
+		Holder:     l.holder,
+		TTLSeconds: int(httpLockTTL / time.Second),
+	})
+}
+
+// Lock retries the acquisition every retry period, a held lock and a failing service are both retried
+// until the context is done, then the lock is renewed in the background
+func (l *httpLocker) Lock(ctx context.Context) error {
+	ticker := time.NewTicker(httpLockRetryPeriod)
+	defer ticker.Stop()
+
+	var lastHolder, lastErr string
+
+	for {
+		holder, err := l.put(ctx)
+		if err == nil {
+			break
+		}
+
+		switch {
+		case errors.Is(err, errHTTPLockHeld):
+			l.mu.Lock()
+			l.lastHolder = holder
+			l.mu.Unlock()
+
+			if holder != lastHolder {
+				l.logger("Lock '%s' is held by '%s', waiting", l.name, holder)
+			}
+
+			lastHolder, lastErr = holder, ""
+		case ctx.Err() == nil:
+			if err.Error() != lastErr {
+				l.logger("Warning: failed to acquire lock '%s', retrying: %v", l.name, err)
+			}
+
+			lastHolder, lastErr = "", err.Error()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	renewCtx, cancel := context.WithCancel(context.Background())
+
+	l.cancel = cancel
+	l.done = make(chan struct{})
+	l.lost = make(chan struct{})
+	l.once = sync.Once{}
+
+	go l.renew(renewCtx)
+
+	return nil
+}
+
+// renew renews the lock every retry period, the lock is lost when no renewal succeeds within the renew deadline
+// or the service gives it to another holder
+func (l *httpLocker) renew(ctx context.Context) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(httpLockRetryPeriod)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		holder, err := l.put(ctx)
+
+		switch {
+		case err == nil:
+			renewed = time.Now()
+
+			continue
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, errHTTPLockHeld):
+			l.logger("Warning: lock '%s' was taken over by '%s'", l.name, holder)
+		case time.Since(renewed) < httpLockRenewDeadline:
+			l.logger("Warning: failed to renew lock '%s', retrying: %v", l.name, err)
+
+			continue
+		default:
+			l.logger("Warning: failed to renew lock '%s' within %s: %v", l.name, httpLockRenewDeadline, err)
+		}
+
+		l.once.Do(func() { close(l.lost) })
+
+		return
+	}
+}
+
+// Holder returns the holder of the last conflict response
+func (l *httpLocker) Holder() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.lastHolder
+}
+
+// Lost returns a channel closed when the held lock is lost
+func (l *httpLocker) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Unlock stops the renewal and deletes the lock on the service
+func (l *httpLocker) Unlock() error {
+	if l.cancel == nil {
+		return nil
+	}
+
+	l.cancel()
+	<-l.done
+
+	l.cancel = nil
+
+	select {
+	case <-l.lost:
+		return nil
+	default:
+	}
+
+	target := l.lockURL() + "?" + url.Values{"holder": {l.holder}}.Encode()
+
+	holder, err := l.do(context.Background(), http.MethodDelete, target, nil)
+	if errors.Is(err, errHTTPLockHeld) {
+		return fmt.Errorf("lock '%s' is held by '%s'", l.name, holder)
+	}
+
+	return err
+}
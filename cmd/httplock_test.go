@@ -0,0 +1,248 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/cli"
+
+	"k8s.io/klog/v2"
+
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// testLockService is an in-memory lock service of the http backend protocol
+type testLockService struct {
+	mu      sync.Mutex
+	holders map[string]string
+}
+
+func newTestLockService(t *testing.T) (*testLockService, *httptest.Server) {
+	t.Helper()
+
+	svc := &testLockService{holders: map[string]string{}}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/locks/")
+
+		svc.mu.Lock()
+		defer svc.mu.Unlock()
+
+		holder := svc.holders[name]
+
+		switch r.Method {
+		case http.MethodPut:
+			var req httpLockRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+
+				return
+			}
+
+			if holder != "" && holder != req.Holder {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(httpLockResponse{Holder: holder}) //nolint:errcheck
+
+				return
+			}
+
+			svc.holders[name] = req.Holder
+		case http.MethodDelete:
+			switch holder {
+			case "":
+				w.WriteHeader(http.StatusNotFound)
+			case r.URL.Query().Get("holder"):
+				delete(svc.holders, name)
+			default:
+				w.WriteHeader(http.StatusConflict)
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return svc, srv
+}
+
+// holder returns the holder of the lock
+func (s *testLockService) holder(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.holders[name]
+}
+
+// takeOver gives the lock to another holder, like the service does after an expired TTL
+func (s *testLockService) takeOver(name, holder string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.holders[name] = holder
+}
+
+// syncBuffer is a log output safe for concurrent writers
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+// newTestOptions returns the options of an upgrade of the release app with the flag defaults
+func newTestOptions(out io.Writer) *lockOptions {
+	return &lockOptions{
+		timeout:             time.Minute,
+		termGrace:           defaultTermGrace,
+		helmSettings:        cli.New(),
+		logger:              log.New(out, "", 0),
+		klogger:             klog.Background(),
+		tracer:              noop.NewTracerProvider().Tracer(tracerName),
+		lockBackend:         lockBackendKubernetes,
+		lockTypes:           []string{lockTypeLease},
+		onMissingRelease:    missingReleaseProceed,
+		failedInstallAction: failedInstallSkip,
+		childOutput:         childOutputSeparate,
+		helmCommand:         "upgrade",
+		helmArgs:            []string{"app", "./chart"},
+		releaseName:         "app",
+		executor:            echoHelmCommand,
+	}
+}
+
+func TestHTTPLockerContention(t *testing.T) {
+	svc, srv := newTestLockService(t)
+	logger := func(string, ...any) {}
+
+	first := &httpLocker{endpoint: srv.URL, name: "default-helm-lock-app", holder: "first", logger: logger, client: srv.Client()}
+	second := &httpLocker{endpoint: srv.URL, name: "default-helm-lock-app", holder: "second", logger: logger, client: srv.Client()}
+
+	if err := first.Lock(context.Background()); err != nil {
+		t.Fatalf("first Lock() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	if err := second.Lock(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second Lock() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if holder := second.Holder(); holder != "first" {
+		t.Errorf("Holder() = %q, want %q", holder, "first")
+	}
+
+	if err := second.Unlock(); err != nil {
+		t.Errorf("Unlock() of a lock that is not held error = %v", err)
+	}
+
+	if err := first.Unlock(); err != nil {
+		t.Fatalf("first Unlock() error = %v", err)
+	}
+
+	if holder := svc.holder("default-helm-lock-app"); holder != "" {
+		t.Fatalf("lock is held by %q after Unlock()", holder)
+	}
+
+	if err := second.Lock(context.Background()); err != nil {
+		t.Fatalf("second Lock() after release error = %v", err)
+	}
+
+	if err := second.Unlock(); err != nil {
+		t.Fatalf("second Unlock() error = %v", err)
+	}
+}
+
+func TestHTTPLockLostStopsHelm(t *testing.T) {
+	svc, srv := newTestLockService(t)
+
+	client, actionConfig, err := loadFixture(writeFixture(t, failedReleaseFixture), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &syncBuffer{}
+	opts := newTestOptions(out)
+	opts.lockBackend = lockBackendHTTP
+	opts.lockEndpoint = srv.URL
+	opts.identity = "runner"
+
+	stopped := make(chan error, 1)
+
+	// helm runs until it is stopped, the service gives the lock away meanwhile
+	opts.executor = func(ctx context.Context, _ *lockOptions, _ []string, _ io.Writer) error {
+		svc.takeOver("default-helm-lock-app", "other")
+
+		<-ctx.Done()
+		stopped <- ctx.Err()
+
+		return ctx.Err()
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- acquireLockAndExecute(context.Background(), client, actionConfig, opts, "helm-lock-app", "default", &lockReport{started: time.Now()})
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("acquireLockAndExecute() succeeded after the lock was lost")
+		}
+
+		if errors.Is(err, ErrLockTimeout) {
+			t.Fatalf("acquireLockAndExecute() error = %v, want a lost lock", err)
+		}
+	case <-time.After(httpLockRenewDeadline):
+		t.Fatal("helm was not stopped after the lock was lost")
+	}
+
+	if err := <-stopped; !errors.Is(err, context.Canceled) {
+		t.Errorf("helm context error = %v, want %v", err, context.Canceled)
+	}
+
+	if !strings.Contains(out.String(), "the lock was lost") {
+		t.Errorf("log does not report the lost lock:\n%s", out.String())
+	}
+
+	if holder := svc.holder("default-helm-lock-app"); holder != "other" {
+		t.Errorf("lock holder = %q, the new holder %q must keep the lock", holder, "other")
+	}
+}
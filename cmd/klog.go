@@ -0,0 +1,48 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-logr/logr"
+
+	"k8s.io/klog/v2/textlogger"
+)
+
+// setupKlog redirects the leader election klog output to a file or discards it
+func setupKlog(opts *lockOptions) error {
+	switch {
+	case opts.klogFile != "":
+		f, err := os.OpenFile(opts.klogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open klog file: %w", err)
+		}
+
+		verbosity := 0
+		if opts.helmSettings.Debug {
+			verbosity = 4
+		}
+
+		opts.klogger = textlogger.NewLogger(textlogger.NewConfig(textlogger.Output(f), textlogger.Verbosity(verbosity)))
+	case opts.silenceKlog:
+		opts.klogger = logr.Discard()
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// livenessAnnotation holds the host and the process of the lease holder
+const livenessAnnotation = "helm-lock/holder-process"
+
+// holderProcess is the value of the liveness annotation
+type holderProcess struct {
+	Holder string `json:"holder"`
+	Host   string `json:"host"`
+	PID    int    `json:"pid"`
+}
+
+// localHolderProcess returns the liveness annotation of this process
+func localHolderProcess(identity string) (string, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+
+	value, err := json.Marshal(holderProcess{Holder: identity, Host: host, PID: os.Getpid()})
+	if err != nil {
+		return "", err
+	}
+
+	return string(value), nil
+}
+
+// breakDeadHolder clears the lease when its holder runs on this host and its process is gone.
+// It is best effort, any doubt about the holder leaves the lease alone.
+func breakDeadHolder(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, lockName string) bool {
+	leases := client.CoordinationV1().Leases(namespace)
+
+	lease, err := leases.Get(ctx, lockName, metav1.GetOptions{})
+	if err != nil {
+		return false
+	}
+
+	info := leaseLockInfo(lease)
+	if info.State != lockStateHeld {
+		return false
+	}
+
+	var process holderProcess
+	if err := json.Unmarshal([]byte(lease.Annotations[livenessAnnotation]), &process); err != nil {
+		return false
+	}
+
+	host, err := os.Hostname()
+	if err != nil || process.Holder != info.Holder || process.Host != host || !processGone(process.PID) {
+		return false
+	}
+
+	duration := int32(1)
+	now := metav1.NewMicroTime(time.Now())
+
+	lease.Spec.HolderIdentity = nil
+	lease.Spec.LeaseDurationSeconds = &duration
+	lease.Spec.RenewTime = &now
+
+	// the update fails on a conflict when the lease changed since the check
+	if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		return false
+	}
+
+	opts.logger.Printf("Lock '%s' holder '%s' process %d is gone from this host, released the lock", lockName, info.Holder, process.PID)
+
+	return true
+}
+
+// watchDeadHolder checks the lease holder on every retry until the lock is acquired
+func watchDeadHolder(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, lockName string, acquired <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if breakDeadHolder(ctx, client, opts, namespace, lockName) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-acquired:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -18,18 +18,35 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand/v2"
+	"net/url"
 	"os"
-	"os/exec"
+	"path"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"text/template"
 	"time"
 
+	"github.com/spf13/pflag"
+
+	"go.opentelemetry.io/otel/trace"
+
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/release"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/version"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/klog/v2"
@@ -37,13 +54,248 @@ import (
 
 const (
 	defaultLockTimeout = 10 * time.Minute
+	defaultTermGrace   = 10 * time.Second
 	lockPrefix         = "helm-lock-"
+
+	connectRetryDelay    = time.Second
+	connectRetryMaxDelay = 30 * time.Second
+
+	timeoutAnnotation    = "helm-lock/timeout"
+	rollbackAnnotation   = "helm-lock/rollback"
+	sharedLockAnnotation = "helm-lock/shared-lock"
+)
+
+// Actions for a failed release without a previous revision
+const (
+	failedInstallSkip = "skip"
+	failedInstallFail = "fail"
+)
+
+// Lock object types, in the order they are acquired
+const (
+	lockTypeLease     = "lease"
+	lockTypeConfigMap = "configmap"
+)
+
+var lockTypes = []string{lockTypeLease, lockTypeConfigMap}
+
+// readOnlyCommands are plugin prefixes whose commands never change the release, like helm-diff
+var readOnlyCommands = []string{"diff"}
+
+// sharedReadCommands take the lock as shared readers with --shared-reads
+var sharedReadCommands = []string{"diff", "get", "template"}
+
+// Policies for a release that does not exist yet
+const (
+	missingReleaseProceed = "proceed"
+	missingReleaseFail    = "fail"
 )
 
+// lockReport collects the outcome of a single lock operation
+type lockReport struct {
+	holder   string
+	rollback bool
+	started  time.Time
+	err      error
+
+	// decision is the rollback decision of the release status check, nil when it was not reached
+	decision *rollbackDecision
+
+	// acquisition and execution timings, zero when the stage was not reached
+	waitStarted time.Time
+	acquired    time.Time
+	finished    time.Time
+
+	// phase is the current operationPhase, set by the operation goroutine
+	phase atomic.Int32
+}
+
+// operationPhase is the stage of a run, reported when the lock timeout expires
+type operationPhase int32
+
+const (
+	phaseAcquire operationPhase = iota
+	phaseReaders
+	phaseWindow
+	phaseCheck
+	phaseRollback
+	phaseHelm
+)
+
+func (p operationPhase) String() string {
+	switch p {
+	case phaseReaders:
+		return "while waiting for the readers to finish"
+	case phaseWindow:
+		return "while waiting for the deploy window"
+	case phaseCheck:
+		return "while checking the release"
+	case phaseRollback:
+		return "during rollback"
+	case phaseHelm:
+		return "during helm execution"
+	default:
+		return "while waiting to acquire the lock"
+	}
+}
+
+// setPhase records the stage the run entered
+func (r *lockReport) setPhase(phase operationPhase) {
+	r.phase.Store(int32(phase))
+}
+
+// currentPhase returns the stage of the run
+func (r *lockReport) currentPhase() operationPhase {
+	return operationPhase(r.phase.Load())
+}
+
 // lockOptions holds the configuration for the lock command
 type lockOptions struct {
-	releaseName string
-	timeout     time.Duration
+	releaseName      string
+	timeout          time.Duration
+	timeoutSet       bool
+	onMissingRelease string
+	fixture          string
+	auditConfigMap   string
+	auditMaxEntries  int
+
+	failedInstallAction string
+
+	timeoutSignalName string
+	timeoutSignal     syscall.Signal
+	termGrace         time.Duration
+
+	acquireWebhook        string
+	acquireWebhookTimeout time.Duration
+
+	rollbackWebhook        string
+	rollbackWebhookTimeout time.Duration
+	onRelease              string
+
+	noDowngrade bool
+	lockTypes   []string
+
+	successMessage string
+	failureMessage string
+
+	execRetries int
+	execRetryOn []string
+	childOutput string
+
+	preRenderCheck bool
+
+	injectHolderLabel string
+
+	lockDependencies      bool
+	dependencyReleaseName string
+	// dependencyLocks holds the dependency locks while the run waits for the release lock
+	dependencyLocks *lockHolder
+	mergeStderr     bool
+
+	exitCodeMap   []string
+	exitCodeRules []exitCodeRule
+
+	auditFlags bool
+	identity   string
+
+	silenceKlog bool
+	klogFile    string
+
+	// logger and klogger are per run, the global loggers are never changed
+	logger  *log.Logger
+	tracer  trace.Tracer
+	klogger klog.Logger
+
+	lockAndExit   time.Duration
+	skipNoOp      bool
+	onlyIfChanged string
+
+	lockLabels      map[string]string
+	lockAnnotations map[string]string
+
+	holderAnnotationTemplate string
+	rollbackAsync            bool
+
+	rollbackToAnnotated string
+	rollbackToLastGood  bool
+	noRollbackMatch     []string
+	postRollbackDelay   time.Duration
+	rollbackMaxHistory  int
+	rollbackProgress    bool
+	pollInterval        time.Duration
+	lockDiff            bool
+	recordLastOperation bool
+	planOutput          string
+	planInput           string
+	allowPlanDrift      bool
+	plan                *lockPlan
+
+	namespaceConcurrency int
+
+	configFile   string
+	strictStatus bool
+
+	// lockFlags are the helm-lock own flags, checked against the helm command flags
+	lockFlags *pflag.FlagSet
+
+	kubeQPS   float32
+	kubeBurst int
+	watchLock bool
+
+	lockKubeContext string
+	minKubeVersion  string
+
+	window            string
+	windowFailOutside bool
+	deployWindow      deployWindow
+	deadlineValue     string
+	deadline          time.Time
+	noLock            bool
+	reason            string
+	connectRetries    int
+	lockBackend       string
+	lockDir           string
+	lockEndpoint      string
+
+	lockName            string
+	breakDeadHolder     bool
+	skipPermissionCheck bool
+	ownerRef            string
+	ownerReference      *metav1.OwnerReference
+	allowIdentityReuse  bool
+	emitSummaryLine     bool
+	renewJitter         time.Duration
+	summaryJSON         string
+	releaseNamespace    string
+	strictSerialize     bool
+	verifyTarget        bool
+	assertStatus        []string
+	assumeYes           bool
+	sharedReads         bool
+	dumpLease           bool
+	promptTimeout       time.Duration
+	dieWithParent       bool
+	// activeLocks are the names of the locks this process holds, passed on to helm in HELM_LOCK_ACTIVE
+	activeLocks []string
+
+	strictHelmVersion    bool
+	skipHelmVersionCheck bool
+
+	rollbackLimit          int
+	rollbackLimitWindow    time.Duration
+	rollbackLimitNamespace string
+
+	lockNamespace string
+
+	createLockNamespace      bool
+	lockNamespaceLabels      map[string]string
+	lockNamespaceAnnotations map[string]string
+	allowCrossNamespaceLock  bool
+	requireDeployed          bool
+	failAfterRollback        bool
+
+	// executor runs the helm binary, replaced in fixture mode
+	executor helmExecutor
 
 	helmSettings *cli.EnvSettings
 	helmCommand  string
@@ -51,132 +303,1491 @@ type lockOptions struct {
 	helmArgs     []string
 }
 
-func runLockCommand(ctx context.Context, opts *lockOptions) error {
-	log.SetFlags(0)
+// validate checks the flag values and resolves the derived options
+func (o *lockOptions) validate() error {
+	switch o.onMissingRelease {
+	case "", missingReleaseProceed, missingReleaseFail:
+	default:
+		return fmt.Errorf("invalid --on-missing-release value '%s', must be one of: %s, %s", o.onMissingRelease, missingReleaseProceed, missingReleaseFail)
+	}
 
-	if opts.releaseName == "" {
-		return fmt.Errorf("release name is required")
+	switch o.failedInstallAction {
+	case failedInstallSkip, failedInstallFail:
+	default:
+		return fmt.Errorf("invalid --failed-install-action value '%s', must be one of: %s, %s", o.failedInstallAction, failedInstallSkip, failedInstallFail)
 	}
 
-	config, err := opts.helmSettings.RESTClientGetter().ToRESTConfig()
-	if err != nil {
-		return fmt.Errorf("failed to get kubernetes config: %w", err)
+	for _, lockType := range o.lockTypes {
+		if !slices.Contains(lockTypes, lockType) {
+			return fmt.Errorf("invalid --lock-type value '%s', must be one of: %s", lockType, strings.Join(lockTypes, ", "))
+		}
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	if o.requireDeployed && (o.rollbackAsync || o.rollbackToAnnotated != "" || o.rollbackToLastGood) {
+		return fmt.Errorf("--require-deployed never rolls back, it cannot be used with --rollback-async, --rollback-to-annotated or --rollback-to-last-good")
 	}
 
-	actionConfig := new(action.Configuration)
-	if err := actionConfig.Init(opts.helmSettings.RESTClientGetter(), opts.helmSettings.Namespace(), os.Getenv("HELM_DRIVER"), func(_ string, _ ...any) {}); err != nil {
-		return fmt.Errorf("failed to initialize Helm action config: %w", err)
+	if o.renewJitter < 0 || o.renewJitter > maxRenewJitter {
+		return fmt.Errorf("invalid --renew-jitter %s, must be between 0 and %s", o.renewJitter, maxRenewJitter)
 	}
 
-	log.Printf("Checking release '%s' in namespace '%s'", opts.releaseName, opts.helmSettings.Namespace())
+	if o.rollbackToAnnotated != "" && o.rollbackToLastGood {
+		return fmt.Errorf("--rollback-to-annotated and --rollback-to-last-good cannot be used together")
+	}
 
-	releaseStatus, err := getReleaseStatus(actionConfig, opts.releaseName)
+	if !slices.Contains(lockBackends, o.lockBackend) {
+		return fmt.Errorf("invalid --lock-backend value '%s', must be one of: %s", o.lockBackend, strings.Join(lockBackends, ", "))
+	}
+
+	if o.lockBackend == lockBackendHTTP {
+		if u, err := url.Parse(o.lockEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("--lock-backend http requires an http or https --lock-endpoint URL")
+		}
+	}
+
+	if o.lockBackend != lockBackendKubernetes {
+		// these flags work on the lock objects in the cluster
+		for _, flag := range []struct {
+			name string
+			set  bool
+		}{
+			{"--lock-and-exit", o.lockAndExit > 0},
+			{"--lock-dependencies", o.lockDependencies},
+			{"--owner-ref", o.ownerRef != ""},
+			{"--break-dead-holder", o.breakDeadHolder},
+			{"--watch-lock", o.watchLock},
+			{"--record-last-operation", o.recordLastOperation},
+			{"--dump-lease", o.dumpLease},
+			{"--strict-serialize", o.strictSerialize},
+			{"--create-lock-namespace", o.createLockNamespace},
+		} {
+			if flag.set {
+				return fmt.Errorf("%s works with the kubernetes lock backend only", flag.name)
+			}
+		}
+	}
+
+	if o.mergeStderr {
+		o.childOutput = childOutputCombined
+	}
+
+	switch o.childOutput {
+	case "", childOutputSeparate, childOutputCombined:
+	default:
+		return fmt.Errorf("invalid --child-output value '%s', must be one of: %s, %s", o.childOutput, childOutputSeparate, childOutputCombined)
+	}
+
+	if o.window != "" {
+		window, err := parseWindow(o.window)
+		if err != nil {
+			return err
+		}
+
+		o.deployWindow = window
+	}
+
+	if o.sharedReads && (o.lockBackend != lockBackendKubernetes || !slices.Contains(o.lockTypes, lockTypeLease)) {
+		return fmt.Errorf("--shared-reads works with the kubernetes lock backend and the lease lock type only")
+	}
+
+	for _, status := range o.assertStatus {
+		if !slices.Contains(assertStatuses, status) {
+			return fmt.Errorf("invalid --assert-status value '%s', must be one of: %s", status, strings.Join(assertStatuses, ", "))
+		}
+	}
+
+	if o.deadlineValue != "" {
+		deadline, err := time.Parse(time.RFC3339, o.deadlineValue)
+		if err != nil {
+			return fmt.Errorf("invalid --deadline value '%s', must be an RFC3339 time like 2026-01-02T02:00:00Z", o.deadlineValue)
+		}
+
+		if !deadline.After(time.Now()) {
+			return fmt.Errorf("--deadline %s is not in the future", deadline.UTC().Format(time.RFC3339))
+		}
+
+		o.deadline = deadline
+	}
+
+	if o.minKubeVersion != "" {
+		if _, err := version.ParseGeneric(o.minKubeVersion); err != nil {
+			return fmt.Errorf("invalid --min-kube-version value '%s': %w", o.minKubeVersion, err)
+		}
+	}
+
+	rules, err := parseExitCodeMap(o.exitCodeMap)
 	if err != nil {
-		return fmt.Errorf("failed to check release status: %w", err)
+		return err
+	}
+
+	o.exitCodeRules = rules
+
+	if o.onlyIfChanged != "" && slices.Contains(strings.Split(o.onlyIfChanged, "."), "") {
+		return fmt.Errorf("invalid --only-if-changed path '%s', must be dotted keys like image.tag", o.onlyIfChanged)
+	}
+
+	if o.rollbackMaxHistory < 0 {
+		return fmt.Errorf("invalid --rollback-max-history value %d, must be 0 or greater", o.rollbackMaxHistory)
+	}
+
+	if o.noLock && strings.TrimSpace(o.reason) == "" {
+		return fmt.Errorf("--no-lock requires a --reason for the audit trail")
+	}
+
+	if o.planOutput != "" && o.planInput != "" {
+		return fmt.Errorf("--plan-output and --plan-input cannot be used together")
+	}
+
+	for _, pattern := range o.noRollbackMatch {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --no-rollback-match pattern '%s': %w", pattern, err)
+		}
 	}
 
-	lockName := lockPrefix + opts.releaseName
-	if err := acquireLockAndExecute(ctx, clientset, actionConfig, opts, lockName, opts.helmSettings.Namespace(), releaseStatus); err != nil {
+	if err := validateLockMeta(o.lockLabels, o.lockAnnotations); err != nil {
 		return err
 	}
 
+	for key, value := range o.lockNamespaceLabels {
+		if errs := append(validation.IsQualifiedName(key), validation.IsValidLabelValue(value)...); len(errs) > 0 {
+			return fmt.Errorf("invalid --lock-namespace-label '%s=%s': %s", key, value, errs[0])
+		}
+	}
+
+	for key := range o.lockNamespaceAnnotations {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid --lock-namespace-annotation key '%s': %s", key, errs[0])
+		}
+	}
+
+	if _, err := template.New("dependency").Parse(o.dependencyReleaseName); err != nil {
+		return fmt.Errorf("invalid --dependency-release-name: %w", err)
+	}
+
+	if o.holderAnnotationTemplate != "" {
+		if _, err := template.New("holder").Parse(o.holderAnnotationTemplate); err != nil {
+			return fmt.Errorf("invalid --holder-annotation-template: %w", err)
+		}
+	}
+
+	sig, err := parseSignal(o.timeoutSignalName)
+	if err != nil {
+		return fmt.Errorf("invalid --timeout-signal value: %w", err)
+	}
+
+	o.timeoutSignal = sig
+
+	if _, err := parseMessage(o.successMessage); err != nil {
+		return fmt.Errorf("invalid --success-message template: %w", err)
+	}
+
+	if _, err := parseMessage(o.failureMessage); err != nil {
+		return fmt.Errorf("invalid --failure-message template: %w", err)
+	}
+
 	return nil
 }
 
-// acquireLockAndExecute acquires a lock, performs rollback if needed, executes helm command, then releases lock
-func acquireLockAndExecute(ctx context.Context, client kubernetes.Interface, actionConfig *action.Configuration, opts *lockOptions, lockName, namespace string, releaseStatus release.Status) error {
-	lockCtx, cancel := context.WithTimeout(ctx, opts.timeout)
-	defer cancel()
+func runLockCommand(ctx context.Context, opts *lockOptions) (err error) {
+	report := &lockReport{
+		started: time.Now(),
+	}
 
-	if !opts.helmSettings.Debug {
-		lockCtx = klog.NewContext(lockCtx, klog.TODO().V(1))
+	defer func() {
+		report.err = err
+
+		printMessage(opts, report)
+
+		if opts.emitSummaryLine {
+			printSummaryLine(opts, report)
+		}
+
+		if opts.summaryJSON != "" {
+			writeSummaryJSON(opts, report)
+		}
+	}()
+
+	if opts.releaseName == "" {
+		return fmt.Errorf("release name is required")
 	}
 
-	identity := fmt.Sprintf("helm-lock-%s-%d", opts.helmCommand, time.Now().Unix())
+	if opts.dieWithParent {
+		var stop context.CancelFunc
 
-	lock, err := resourcelock.New(
-		resourcelock.LeasesResourceLock,
-		namespace,
-		lockName,
-		client.CoreV1(),
-		client.CoordinationV1(),
-		resourcelock.ResourceLockConfig{
-			Identity: identity,
-		},
-	)
+		ctx, stop = watchParent(ctx, opts)
+		defer stop()
+
+		defer func() {
+			if err != nil && errors.Is(context.Cause(ctx), errParentExited) {
+				err = errors.Join(errParentExited, err)
+			}
+		}()
+	}
+
+	// a plan already has the extra arguments of the run that wrote it
+	if opts.planInput == "" {
+		extra, err := extraArgs()
+		if err != nil {
+			return err
+		}
+
+		opts.helmFlags = append(opts.helmFlags, extra...)
+	}
+
+	// the namespace flags of the command line and of the extra arguments are replaced
+	if opts.releaseNamespace != "" {
+		opts.helmFlags = append(withoutNamespaceFlags(opts.helmFlags), "--namespace", opts.releaseNamespace)
+	}
+
+	if opts.injectHolderLabel != "" && setsValue(opts.helmFlags, opts.injectHolderLabel) {
+		return fmt.Errorf("--inject-holder-label '%s' is already set by a helm --set flag", opts.injectHolderLabel)
+	}
+
+	if namespace := opts.lockNamespaceName(); namespace != opts.helmSettings.Namespace() {
+		if !opts.allowCrossNamespaceLock {
+			return fmt.Errorf("lock namespace '%s' differs from the release namespace '%s', use --allow-cross-namespace-lock if this is intended", namespace, opts.helmSettings.Namespace())
+		}
+
+		opts.logger.Printf("Locking in namespace '%s' for release namespace '%s'", namespace, opts.helmSettings.Namespace())
+	}
+
+	ctx, shutdownTracing, err := setupTracing(ctx, opts)
 	if err != nil {
-		return fmt.Errorf("failed to create resource lock: %w", err)
+		return err
 	}
+	defer shutdownTracing()
 
-	operationCompleted := make(chan error, 1)
+	ctx, span := startSpan(ctx, opts, "helm-lock")
+	defer func() { endSpan(span, err) }()
 
-	leaderElectionConfig := leaderelection.LeaderElectionConfig{
-		Lock:            lock,
-		ReleaseOnCancel: true,
-		LeaseDuration:   15 * time.Second,
-		RenewDeadline:   10 * time.Second,
-		RetryPeriod:     2 * time.Second,
-		Callbacks: leaderelection.LeaderCallbacks{
-			OnStartedLeading: func(ctx context.Context) {
-				log.Printf("Acquired lock '%s' for %s operation", lockName, opts.helmCommand)
+	if opts.fixture == "" && !opts.skipHelmVersionCheck {
+		if err := checkHelmVersion(ctx, opts); err != nil {
+			return err
+		}
+	}
 
-				if releaseStatus != release.StatusDeployed && releaseStatus != release.StatusUnknown {
-					log.Printf("Release status is '%s', performing rollback first", releaseStatus)
+	if opts.fixture == "" && opts.lockFlags != nil {
+		warnFlagCollisions(ctx, opts)
+	}
 
-					if err := performRollback(actionConfig, opts.releaseName); err != nil {
-						operationCompleted <- fmt.Errorf("rollback failed: %w", err)
+	if opts.isSharedRead() {
+		return runSharedRead(ctx, opts, report)
+	}
 
-						return
-					}
-				}
+	if opts.isReadOnly() {
+		opts.logger.Printf("helm %s does not change the release, running it without the lock", opts.helmCommand)
 
-				if err := executeHelmCommand(ctx, opts); err != nil {
-					operationCompleted <- err
+		if opts.fixture != "" {
+			opts.executor = echoHelmCommand
+		}
 
-					return
-				}
+		report.setPhase(phaseHelm)
 
-				operationCompleted <- nil
-			},
-			OnStoppedLeading: func() {},
-		},
+		return executeHelmCommand(ctx, opts)
 	}
 
-	go func() {
-		leaderelection.RunOrDie(lockCtx, leaderElectionConfig)
-	}()
+	if opts.preRenderCheck {
+		if err := preRenderCheck(ctx, opts); err != nil {
+			return err
+		}
+	}
 
-	select {
-	case err := <-operationCompleted:
-		cancel()
+	clientset, actionConfig, err := connectClients(ctx, opts)
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
+	if opts.minKubeVersion != "" {
+		if err := checkKubeVersion(clientset, opts.minKubeVersion); err != nil {
 			return err
 		}
+	}
 
-		return nil
-	case <-lockCtx.Done():
-		return fmt.Errorf("failed to acquire lock or operation timed out: %w", lockCtx.Err())
+	lockName, err := resolveLockName(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.noLock {
+		return runWithoutLock(ctx, clientset, opts, lockName, report)
+	}
+
+	if err := enterLocks(opts, opts.lockNamespaceName(), lockName); err != nil {
+		return err
+	}
+
+	if opts.ownerRef != "" {
+		if opts.ownerReference, err = resolveOwnerRef(ctx, clientset, opts, opts.lockNamespaceName()); err != nil {
+			return err
+		}
+	}
+
+	if opts.planOutput != "" {
+		return writePlan(actionConfig, opts, lockName)
+	}
+
+	if opts.createLockNamespace {
+		if err := ensureLockNamespace(ctx, clientset, opts, opts.lockNamespaceName()); err != nil {
+			return err
+		}
+	}
+
+	if !opts.skipPermissionCheck && opts.lockBackend == lockBackendKubernetes {
+		if err := checkLockPermissions(ctx, clientset, opts, opts.lockNamespaceName(), lockName); err != nil {
+			return err
+		}
+	}
+
+	if opts.lockAndExit > 0 {
+		return acquireAndExit(ctx, clientset, opts, lockName, opts.lockNamespaceName())
+	}
+
+	if opts.auditFlags {
+		opts.logger.Printf("Forwarded helm flags: %s", strings.Join(redactFlags(opts.helmFlags), " "))
+	}
+
+	// the timeout is needed to acquire the lock, so the release annotation is read before it,
+	// the release status is checked under the lock
+	if opts.timeoutSet {
+		opts.logger.Printf("Using lock timeout %s from --lock-timeout", opts.timeout)
+	} else {
+		resolveReleaseTimeout(actionConfig, opts)
+	}
+
+	if !opts.deadline.IsZero() && time.Until(opts.deadline) < opts.timeout {
+		opts.logger.Printf("Using --deadline %s, it ends the run before the lock timeout", opts.deadline.UTC().Format(time.RFC3339))
+	}
+
+	if opts.lockDependencies {
+		report.err = lockDependenciesAndExecute(ctx, clientset, actionConfig, opts, lockName, report)
+	} else {
+		report.err = acquireLockAndExecute(ctx, clientset, actionConfig, opts, lockName, opts.lockNamespaceName(), report)
+	}
+
+	if opts.auditConfigMap != "" {
+		if err := auditOperation(ctx, clientset, opts, opts.lockNamespaceName(), report); err != nil {
+			opts.logger.Printf("Warning: %v", err)
+		}
+	}
+
+	if report.err == nil && report.rollback && opts.failAfterRollback {
+		return &Error{
+			error: fmt.Errorf("release '%s' was rolled back before the command succeeded", opts.releaseName),
+			Code:  ExitCodeRecovered,
+		}
 	}
+
+	return report.err
 }
 
-// executeHelmCommand executes the original helm command
-func executeHelmCommand(ctx context.Context, opts *lockOptions) error {
-	args := append([]string{opts.helmCommand}, opts.helmArgs...)
-	args = append(args, opts.helmFlags...)
+// printLease prints the acquired lease as YAML to stderr, from the client that holds it
+func printLease(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, lockName string) {
+	lease, err := client.CoordinationV1().Leases(namespace).Get(ctx, lockName, metav1.GetOptions{})
+	if err != nil {
+		opts.logger.Printf("Warning: failed to get lease for --dump-lease: %v", err)
+
+		return
+	}
+
+	data, err := leaseYAML(lease)
+	if err != nil {
+		opts.logger.Printf("Warning: %v", err)
+
+		return
+	}
+
+	opts.logger.Printf("Lease '%s' after acquisition:\n%s", lockName, data)
+}
 
-	log.Printf("Executing: helm %s\n\n", strings.Join(args, " "))
+// runSharedRead runs a read only helm command as a reader of the lock
+func runSharedRead(ctx context.Context, opts *lockOptions, report *lockReport) error {
+	clientset, _, err := connectClients(ctx, opts)
+	if err != nil {
+		return err
+	}
 
-	cmd := exec.CommandContext(ctx, "helm", args...)
-	cmd.Env = os.Environ()
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	lockName, err := resolveLockName(opts)
+	if err != nil {
+		return err
+	}
+
+	if err := enterLocks(opts, opts.lockNamespaceName(), lockName); err != nil {
+		return err
+	}
+
+	if opts.fixture != "" {
+		opts.executor = echoHelmCommand
+	}
+
+	lockCtx, cancel := context.WithDeadline(ctx, opts.lockDeadline())
+	defer cancel()
+
+	namespace := opts.lockNamespaceName()
+	report.holder = lockIdentity(opts, namespace)
+	report.waitStarted = time.Now()
+
+	return withSharedLock(lockCtx, clientset, opts, namespace, lockName, report.holder, func(ctx context.Context) error {
+		report.acquired = time.Now()
+		defer func() { report.finished = time.Now() }()
+
+		report.setPhase(phaseHelm)
+
+		return executeHelmCommand(ctx, opts)
+	})
+}
+
+// resolveLockName returns the lock name from --lock-name, the helm-lock/shared-lock chart annotation
+// or the release name, in this order
+func resolveLockName(opts *lockOptions) (string, error) {
+	name := opts.releaseName
+
+	if opts.lockName != "" {
+		name = opts.lockName
+
+		opts.logger.Printf("Using lock name '%s' from --lock-name", name)
+	} else if c := loadLocalChart(opts); c != nil && c.Metadata.Annotations[sharedLockAnnotation] != "" {
+		name = c.Metadata.Annotations[sharedLockAnnotation]
+
+		opts.logger.Printf("Using shared lock name '%s' from chart annotation '%s'", name, sharedLockAnnotation)
+	}
+
+	lockName := lockPrefix + name
+	if errs := validation.IsDNS1123Subdomain(lockName); len(errs) > 0 {
+		return "", fmt.Errorf("invalid lock name '%s': %s", lockName, errs[0])
+	}
+
+	return lockName, nil
+}
+
+// checkReleaseStatus returns the release status and applies the missing release and --require-deployed policies
+func checkReleaseStatus(actionConfig *action.Configuration, opts *lockOptions) (release.Status, error) {
+	opts.logger.Printf("Checking release '%s' in namespace '%s'", opts.releaseName, opts.helmSettings.Namespace())
+
+	releaseStatus, err := getReleaseStatus(actionConfig, opts.releaseName)
+	if err != nil {
+		if !errors.Is(err, errStatusUndetermined) || opts.strictStatus || opts.requiresDeployed() || len(opts.assertStatus) > 0 {
+			return releaseStatus, releaseCheckError(fmt.Errorf("failed to check release status: %w", err))
+		}
+
+		opts.logger.Printf("Warning: status of release '%s' cannot be determined, proceeding without rollback", opts.releaseName)
+	}
+
+	if releaseStatus == release.StatusUnknown && opts.onMissingRelease == missingReleaseFail && !opts.isInstall() {
+		return releaseStatus, releaseCheckError(fmt.Errorf("release '%s' not found in namespace '%s'", opts.releaseName, opts.helmSettings.Namespace()))
+	}
+
+	if opts.requiresDeployed() && releaseStatus != release.StatusDeployed && releaseStatus != release.StatusUnknown {
+		return releaseStatus, releaseCheckError(fmt.Errorf("release '%s' status is '%s', --require-deployed allows upgrades of deployed releases only", opts.releaseName, releaseStatus))
+	}
+
+	return releaseStatus, nil
+}
+
+// statusMissing is the --assert-status value of a release that does not exist
+const statusMissing = "missing"
+
+// assertStatuses are the values accepted by --assert-status
+var assertStatuses = []string{
+	statusMissing, release.StatusDeployed.String(), release.StatusFailed.String(), release.StatusSuperseded.String(),
+	release.StatusUninstalled.String(), release.StatusUninstalling.String(), release.StatusPendingInstall.String(),
+	release.StatusPendingUpgrade.String(), release.StatusPendingRollback.String(),
+}
+
+// assertReleaseStatus fails when the release status checked under the lock is not one of --assert-status
+func assertReleaseStatus(opts *lockOptions, releaseStatus release.Status) error {
+	current := releaseStatus.String()
+	if releaseStatus == release.StatusUnknown {
+		current = statusMissing
+	}
+
+	if !slices.Contains(opts.assertStatus, current) {
+		return releaseCheckError(fmt.Errorf("release '%s' status is '%s', --assert-status expects %s", opts.releaseName, current, strings.Join(opts.assertStatus, " or ")))
+	}
+
+	return nil
+}
+
+// releaseCheckError gives an error of the release check the ExitCodeReleaseCheck exit code
+func releaseCheckError(err error) error {
+	return &Error{error: err, Code: ExitCodeReleaseCheck}
+}
+
+// resolveReleaseTimeout takes the lock timeout from the chart annotation of the deployed release
+func resolveReleaseTimeout(actionConfig *action.Configuration, opts *lockOptions) {
+	value, err := getChartAnnotation(actionConfig, opts.releaseName, timeoutAnnotation)
+	if err != nil || value == "" {
+		opts.logger.Printf("Using default lock timeout %s", opts.timeout)
+
+		return
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		opts.logger.Printf("Warning: invalid '%s' annotation value '%s', using default lock timeout %s", timeoutAnnotation, value, opts.timeout)
+
+		return
+	}
+
+	opts.logger.Printf("Using lock timeout %s from release annotation '%s'", timeout, timeoutAnnotation)
+
+	opts.timeout = timeout
+}
+
+// newClients creates the kubernetes client and the Helm action config, or loads them from the fixture
+func newClients(opts *lockOptions) (kubernetes.Interface, *action.Configuration, error) {
+	if opts.fixture != "" {
+		opts.executor = echoHelmCommand
+
+		return loadFixture(opts.fixture, opts.helmSettings.Namespace())
+	}
+
+	// the REST client getter applies the settings to both the clientset and the action config
+	if opts.kubeQPS > 0 {
+		opts.helmSettings.QPS = opts.kubeQPS
+	}
+
+	if opts.kubeBurst > 0 {
+		opts.helmSettings.BurstLimit = opts.kubeBurst
+	}
+
+	config, err := opts.helmSettings.RESTClientGetter().ToRESTConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get kubernetes config: %w", err)
+	}
+
+	if opts.lockKubeContext != "" {
+		if err := checkReachable(config, "release"); err != nil {
+			return nil, nil, err
+		}
+
+		if config, err = lockClusterConfig(opts); err != nil {
+			return nil, nil, err
+		}
+
+		if err := checkReachable(config, "lock"); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	actionConfig := new(action.Configuration)
+	if err := actionConfig.Init(opts.helmSettings.RESTClientGetter(), opts.helmSettings.Namespace(), os.Getenv("HELM_DRIVER"), func(_ string, _ ...any) {}); err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize Helm action config: %w", err)
+	}
+
+	return clientset, actionConfig, nil
+}
+
+// connectClients creates the clients and, with --connect-retries, checks that the cluster responds,
+// retrying connectivity errors with an exponential backoff. Authentication and authorization errors
+// are not retried.
+func connectClients(ctx context.Context, opts *lockOptions) (kubernetes.Interface, *action.Configuration, error) {
+	if opts.connectRetries <= 0 {
+		return newClients(opts)
+	}
+
+	delay := connectRetryDelay
+
+	for attempt := 0; ; attempt++ {
+		clientset, actionConfig, err := newClients(opts)
+		if err == nil {
+			if _, err = clientset.Discovery().ServerVersion(); err == nil {
+				return clientset, actionConfig, nil
+			}
+
+			err = fmt.Errorf("cluster is not reachable: %w", err)
+		}
+
+		if attempt >= opts.connectRetries || apierrors.IsUnauthorized(err) || apierrors.IsForbidden(err) {
+			return nil, nil, err
+		}
+
+		opts.logger.Printf("Warning: %v, retrying in %s (attempt %d of %d)", err, delay, attempt+1, opts.connectRetries)
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, connectRetryMaxDelay)
+	}
+}
+
+// lockClusterConfig returns the config of the --lock-kube-context cluster, the kubeconfig and the
+// client rate limits are the same as for the release cluster
+func lockClusterConfig(opts *lockOptions) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = opts.helmSettings.KubeConfig
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{
+		CurrentContext: opts.lockKubeContext,
+	}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kubernetes config of lock context '%s': %w", opts.lockKubeContext, err)
+	}
+
+	config.QPS = opts.helmSettings.QPS
+	config.Burst = opts.helmSettings.BurstLimit
+
+	return config, nil
+}
+
+// checkReachable fails when the API server of the config does not respond
+func checkReachable(config *rest.Config, cluster string) error {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client of the %s cluster: %w", cluster, err)
+	}
+
+	if _, err := client.Discovery().ServerVersion(); err != nil {
+		return fmt.Errorf("%s cluster is not reachable: %w", cluster, err)
+	}
+
+	return nil
+}
+
+// helmVerb returns the helm command, unwrapping known plugin prefixes
+func (o *lockOptions) helmVerb() string {
+	command, _ := unwrapPlugin(o.helmCommand, o.helmArgs)
+
+	return command
+}
+
+// chartRef returns the chart argument that follows the release name
+func (o *lockOptions) chartRef() string {
+	if i := slices.Index(o.helmArgs, o.releaseName); i >= 0 && i+1 < len(o.helmArgs) {
+		return o.helmArgs[i+1]
+	}
+
+	return ""
+}
+
+// lockDeadline returns the end of the run, the earlier of the lock timeout from now and --deadline
+func (o *lockOptions) lockDeadline() time.Time {
+	deadline := time.Now().Add(o.timeout)
+	if !o.deadline.IsZero() && o.deadline.Before(deadline) {
+		return o.deadline
+	}
+
+	return deadline
+}
+
+// lockNamespaceName returns the namespace of the lock objects, the release namespace by default
+func (o *lockOptions) lockNamespaceName() string {
+	if o.lockNamespace != "" {
+		return o.lockNamespace
+	}
+
+	return o.helmSettings.Namespace()
+}
+
+// rollbackLimitNamespaceName returns the namespace of the rollback counter, the lock namespace
+// with --lock-kube-context as the counter lives in the lock cluster, the release namespace otherwise
+func (o *lockOptions) rollbackLimitNamespaceName() string {
+	if o.rollbackLimitNamespace != "" {
+		return o.rollbackLimitNamespace
+	}
+
+	if o.lockKubeContext != "" {
+		return o.lockNamespaceName()
+	}
+
+	return o.helmSettings.Namespace()
+}
+
+// requiresDeployed reports whether the --require-deployed guard applies to the command
+func (o *lockOptions) requiresDeployed() bool {
+	return o.requireDeployed && o.helmVerb() == "upgrade"
+}
+
+// isReadOnly reports whether the helm command is a read-only plugin command that runs without the lock
+func (o *lockOptions) isReadOnly() bool {
+	return slices.Contains(readOnlyCommands, o.helmCommand) && !o.lockDiff
+}
+
+// isSharedRead reports whether the command runs as a shared reader of the lock
+func (o *lockOptions) isSharedRead() bool {
+	return o.sharedReads && (slices.Contains(sharedReadCommands, o.helmCommand) || slices.Contains(sharedReadCommands, o.helmVerb()))
+}
+
+// isDryRun reports whether the helm command runs with --dry-run
+func (o *lockOptions) isDryRun() bool {
+	value, found := flagValue(o.helmFlags, "--dry-run")
+	if !found {
+		return false
+	}
+
+	return value != "none" && value != "false"
+}
+
+// noRollbackPattern returns the first --no-rollback-match pattern matching the release name
+func (o *lockOptions) noRollbackPattern() string {
+	for _, pattern := range o.noRollbackMatch {
+		if ok, _ := path.Match(pattern, o.releaseName); ok {
+			return pattern
+		}
+	}
+
+	return ""
+}
+
+// isInstall reports whether the helm command may create the release
+func (o *lockOptions) isInstall() bool {
+	switch o.helmVerb() {
+	case "install":
+		return true
+	case "upgrade":
+		return hasFlag(o.helmFlags, "--install", "-i")
+	}
+
+	return false
+}
+
+// acquireAndExit acquires the lock with the TTL as lease duration and exits without renewing it
+func acquireAndExit(ctx context.Context, client kubernetes.Interface, opts *lockOptions, lockName, namespace string) error {
+	lockCtx, cancel := context.WithDeadline(ctx, opts.lockDeadline())
+	defer cancel()
+
+	if !opts.helmSettings.Debug {
+		lockCtx = klog.NewContext(lockCtx, opts.klogger.V(1))
+	} else {
+		lockCtx = klog.NewContext(lockCtx, opts.klogger)
+	}
+
+	identity := lockIdentity(opts, namespace)
+
+	lock, err := newResourceLock(client, opts, namespace, lockName, identity)
+	if err != nil {
+		return fmt.Errorf("failed to create resource lock: %w", err)
+	}
+
+	if err := setHolderAnnotations(lock, opts, namespace, opts.releaseName, identity); err != nil {
+		return err
+	}
+
+	setMaxLifetime(lock, opts.lockAndExit)
+
+	acquired := make(chan struct{})
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: opts.lockAndExit,
+		RenewDeadline: opts.lockAndExit * 2 / 3,
+		RetryPeriod:   2 * time.Second,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(_ context.Context) {
+				close(acquired)
+			},
+			OnStoppedLeading: func() {},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("invalid lock TTL: %w", err)
+	}
+
+	go elector.Run(lockCtx)
+
+	select {
+	case <-acquired:
+		cancel()
+
+		opts.logger.Printf("Acquired lock '%s' for %s, it expires without renewal", lockName, opts.lockAndExit)
+
+		return nil
+	case <-lockCtx.Done():
+		if errors.Is(lockCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("lock '%s' is held by '%s': %w", lockName, elector.GetLeader(), ErrLockTimeout)
+		}
+
+		return fmt.Errorf("failed to acquire lock: %w", lockCtx.Err())
+	}
+}
+
+// checkIdentityReuse detects a lease held by another process with the same explicit --identity,
+// the leader election would treat it as its own lock and renew it
+func checkIdentityReuse(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, lockName string) error {
+	if opts.identity == "" || !slices.Contains(opts.lockTypes, lockTypeLease) {
+		return nil
+	}
+
+	info, err := getLockInfo(ctx, client, lockTypeLease, namespace, lockName)
+	if err != nil {
+		return fmt.Errorf("failed to get lock: %w", err)
+	}
+
+	if info.State != lockStateHeld || info.Holder != opts.identity {
+		return nil
+	}
+
+	if !opts.allowIdentityReuse {
+		return fmt.Errorf("lock '%s' is already held by identity '%s', another run may use the same --identity (use --allow-identity-reuse to take it over)", lockName, opts.identity)
+	}
+
+	opts.logger.Printf("Warning: lock '%s' is already held by identity '%s', taking it over", lockName, opts.identity)
+
+	return nil
+}
+
+// acquireLockAndExecute acquires a lock, performs rollback if needed, executes helm command, then releases lock
+func acquireLockAndExecute(ctx context.Context, client kubernetes.Interface, actionConfig *action.Configuration, opts *lockOptions, lockName, namespace string, report *lockReport) error {
+	lockCtx, cancel := context.WithDeadline(ctx, opts.lockDeadline())
+	defer cancel()
+
+	if !opts.helmSettings.Debug {
+		lockCtx = klog.NewContext(lockCtx, opts.klogger.V(1))
+	} else {
+		lockCtx = klog.NewContext(lockCtx, opts.klogger)
+	}
+
+	identity := lockIdentity(opts, namespace)
+	report.holder = identity
+
+	var lock resourcelock.Interface
+
+	if opts.lockBackend == lockBackendKubernetes {
+		if err := checkIdentityReuse(lockCtx, client, opts, namespace, lockName); err != nil {
+			return err
+		}
+
+		var err error
+
+		lock, err = newResourceLock(client, opts, namespace, lockName, identity)
+		if err != nil {
+			return fmt.Errorf("failed to create resource lock: %w", err)
+		}
+
+		if err := setHolderAnnotations(lock, opts, namespace, opts.releaseName, identity); err != nil {
+			return err
+		}
+
+		// the lock timeout bounds the whole run, helm gets the grace period on top
+		setMaxLifetime(lock, time.Until(opts.lockDeadline())+opts.termGrace)
+	}
+
+	operationCompleted := make(chan error, 1)
+	operationStarted := make(chan struct{})
+
+	_, acquireSpan := startSpan(lockCtx, opts, "acquire")
+	defer acquireSpan.End()
+
+	report.waitStarted = time.Now()
+
+	var operationFinished atomic.Bool
+
+	callbacks := leaderelection.LeaderCallbacks{
+		OnStartedLeading: func(ctx context.Context) {
+			opts.logger.Printf("Acquired lock '%s' for %s operation", lockName, opts.helmCommand)
+			acquireSpan.End()
+			report.acquired = time.Now()
+			close(operationStarted)
+
+			err := withConcurrencySlot(ctx, client, opts, namespace, identity, func(ctx context.Context) error {
+				return runLockedOperation(ctx, client, actionConfig, lock, opts, identity, namespace, lockName, report)
+			})
+			report.finished = time.Now()
+			operationFinished.Store(true)
+
+			operationCompleted <- err
+		},
+		OnStoppedLeading: func() {
+			select {
+			case <-operationStarted:
+			default:
+				return
+			}
+
+			reason := releaseReasonReleased
+			if !operationFinished.Load() {
+				reason = releaseReasonLost
+			}
+
+			runOnRelease(opts, namespace, lockName, identity, reason)
+		},
+	}
+
+	if opts.dependencyLocks != nil && opts.lockBackend == lockBackendKubernetes {
+		var cancelCause context.CancelCauseFunc
+
+		lockCtx, cancelCause = context.WithCancelCause(lockCtx)
+		defer cancelCause(nil)
+
+		go watchDependencyDeadlock(lockCtx, cancelCause, client, opts.dependencyLocks, namespace, lockName, identity, operationStarted)
+	}
+
+	elector, err := newLockElector(lockCtx, client, opts, lock, namespace, lockName, identity, callbacks, operationStarted, operationCompleted)
+	if err != nil {
+		return err
+	}
+
+	electionDone := make(chan struct{})
+
+	go func() {
+		defer close(electionDone)
+
+		elector.Run(lockCtx)
+	}()
+
+	select {
+	case err := <-operationCompleted:
+		cancel()
+		<-electionDone
+
+		if opts.recordLastOperation {
+			recordLastOperation(ctx, client, opts, namespace, lockName, identity, err)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return nil
+	case <-lockCtx.Done():
+		// the phase is read before waiting, the operation may still move on meanwhile
+		phase := report.currentPhase()
+
+		select {
+		case <-operationStarted:
+			// give helm the grace period to handle the timeout signal
+			select {
+			case <-operationCompleted:
+			case <-time.After(opts.termGrace + time.Second):
+			}
+
+			<-electionDone
+
+			if opts.recordLastOperation {
+				recordLastOperation(ctx, client, opts, namespace, lockName, identity, fmt.Errorf("operation timed out %s: %w", phase, lockCtx.Err()))
+			}
+		default:
+			// the main lock was never acquired, the dependency locks are released by the caller
+			if err := context.Cause(lockCtx); errors.Is(err, errDeadlock) {
+				<-electionDone
+
+				return err
+			}
+
+			if errors.Is(lockCtx.Err(), context.DeadlineExceeded) {
+				printLockTimeout(opts, lockName, namespace, elector.GetLeader(), report.waitStarted)
+
+				return fmt.Errorf("lock '%s' is held by '%s': %w", lockName, elector.GetLeader(), ErrLockTimeout)
+			}
+		}
+
+		if errors.Is(lockCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("timed out %s: %w", phase, lockCtx.Err())
+		}
+
+		return fmt.Errorf("interrupted %s: %w", phase, lockCtx.Err())
+	}
+}
+
+// newLockElector returns the leader elector of the kubernetes lock objects, or a lockerElector of
+// the --lock-backend, a locker that fails to acquire the lock completes the operation with the error
+func newLockElector(ctx context.Context, client kubernetes.Interface, opts *lockOptions, lock resourcelock.Interface, namespace, lockName, identity string, callbacks leaderelection.LeaderCallbacks, operationStarted <-chan struct{}, operationCompleted chan<- error) (lockElector, error) {
+	if opts.lockBackend != lockBackendKubernetes {
+		l, err := newLocker(opts, namespace, lockName, identity)
+		if err != nil {
+			return nil, err
+		}
+
+		return &lockerElector{
+			locker:    l,
+			callbacks: callbacks,
+			logger:    opts.logger.Printf,
+			failed: func(err error) {
+				operationCompleted <- fmt.Errorf("failed to acquire lock: %w", err)
+			},
+		}, nil
+	}
+
+	leaderElectionConfig := leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		Callbacks:       callbacks,
+	}
+
+	jitterRenewal(&leaderElectionConfig, opts.renewJitter)
+
+	if opts.breakDeadHolder && slices.Contains(opts.lockTypes, lockTypeLease) {
+		if value, err := localHolderProcess(identity); err == nil {
+			setLockAnnotation(lock, livenessAnnotation, value)
+		}
+
+		go watchDeadHolder(ctx, client, opts, namespace, lockName, operationStarted, leaderElectionConfig.RetryPeriod)
+	}
+
+	if opts.watchLock && slices.Contains(opts.lockTypes, lockTypeLease) {
+		waitForLockRelease(ctx, client, opts, namespace, lockName, identity)
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderElectionConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create leader elector: %w", err)
+	}
+
+	return elector, nil
+}
+
+// lockIdentity returns the lock holder identity: the --identity flag, the pod from the downward API, or a generated one
+func lockIdentity(opts *lockOptions, namespace string) string {
+	if opts.identity != "" {
+		return opts.identity
+	}
+
+	if pod := os.Getenv("POD_NAME"); pod != "" {
+		if podNamespace := os.Getenv("POD_NAMESPACE"); podNamespace != "" && podNamespace != namespace {
+			return fmt.Sprintf("%s/%s/%s", podNamespace, pod, opts.helmCommand)
+		}
+
+		return fmt.Sprintf("%s/%s", pod, opts.helmCommand)
+	}
+
+	return fmt.Sprintf("helm-lock-%s-%d", opts.helmCommand, time.Now().Unix())
+}
+
+// newResourceLock creates the lock object, two lock types are held together for a backend migration
+func newResourceLock(client kubernetes.Interface, opts *lockOptions, namespace, lockName, identity string) (resourcelock.Interface, error) {
+	locks := []resourcelock.Interface{}
+
+	for _, lockType := range lockTypes {
+		if !slices.Contains(opts.lockTypes, lockType) {
+			continue
+		}
+
+		meta := metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        lockName,
+			Labels:      lockLabels(opts),
+			Annotations: opts.lockAnnotations,
+		}
+
+		if opts.ownerReference != nil {
+			meta.OwnerReferences = []metav1.OwnerReference{*opts.ownerReference}
+		}
+
+		locks = append(locks, newTypedLock(client, lockType, meta, identity))
+	}
+
+	switch len(locks) {
+	case 0:
+		return nil, fmt.Errorf("no lock type selected")
+	case 1:
+		return locks[0], nil
+	default:
+		return &resourcelock.MultiLock{Primary: locks[0], Secondary: locks[1]}, nil
+	}
+}
+
+// newTypedLock creates a single lock object of the type, the labels and annotations are set on creation
+func newTypedLock(client kubernetes.Interface, lockType string, meta metav1.ObjectMeta, identity string) resourcelock.Interface {
+	config := resourcelock.ResourceLockConfig{
+		Identity: identity,
+	}
+
+	if lockType == lockTypeConfigMap {
+		return &ConfigMapLock{
+			ConfigMapMeta: metav1.ObjectMeta{Namespace: meta.Namespace, Name: meta.Name},
+			Client:        client.CoreV1(),
+			LockConfig:    config,
+			Labels:        meta.Labels,
+			Annotations:   meta.Annotations,
+			Owners:        meta.OwnerReferences,
+		}
+	}
+
+	return &annotatedLeaseLock{
+		LeaseLock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: meta.Namespace, Name: meta.Name},
+			Client:     client.CoordinationV1(),
+			LockConfig: config,
+			Labels:     meta.Labels,
+		},
+		Annotations: meta.Annotations,
+		Owners:      meta.OwnerReferences,
+	}
+}
+
+// runLockedOperation runs the checks, the rollback and the helm command while the lock is held
+func runLockedOperation(ctx context.Context, client kubernetes.Interface, actionConfig *action.Configuration, lock resourcelock.Interface, opts *lockOptions, identity, namespace, lockName string, report *lockReport) error {
+	if opts.dumpLease && slices.Contains(opts.lockTypes, lockTypeLease) {
+		printLease(ctx, client, opts, namespace, lockName)
+	}
+
+	// readers of --shared-reads that were in before the writer finish first
+	if opts.lockBackend == lockBackendKubernetes && slices.Contains(opts.lockTypes, lockTypeLease) {
+		report.setPhase(phaseReaders)
+
+		if err := waitForReaders(ctx, client, opts, namespace, lockName); err != nil {
+			return err
+		}
+	}
+
+	if opts.deployWindow != nil {
+		report.setPhase(phaseWindow)
+
+		if err := waitForWindow(ctx, opts); err != nil {
+			return err
+		}
+	}
+
+	report.setPhase(phaseCheck)
+
+	if opts.lockBackend == lockBackendKubernetes {
+		updateAsyncRollback(ctx, client, actionConfig, lock, opts, namespace, lockName)
+	}
+
+	releaseStatus, err := checkReleaseStatus(actionConfig, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(opts.assertStatus) > 0 {
+		if err := assertReleaseStatus(opts, releaseStatus); err != nil {
+			return err
+		}
+	}
+
+	if opts.strictSerialize {
+		if err := beginSerializedOperation(ctx, client, opts, namespace, lockName, identity, releaseStatus); err != nil {
+			return err
+		}
+
+		defer finishSerializedOperation(ctx, client, actionConfig, opts, namespace, lockName, identity)
+	}
+
+	if opts.plan != nil {
+		if err := checkPlanDrift(actionConfig, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.acquireWebhook != "" {
+		payload := acquireWebhookPayload{
+			Release:   opts.releaseName,
+			Command:   opts.helmCommand,
+			Holder:    identity,
+			Namespace: namespace,
+		}
+
+		if err := postWebhook(ctx, opts.acquireWebhook, opts.acquireWebhookTimeout, payload); err != nil {
+			return fmt.Errorf("acquire webhook rejected the operation: %w", err)
+		}
+	}
+
+	if opts.noDowngrade && releaseStatus != release.StatusUnknown {
+		if err := checkDowngrade(actionConfig, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.skipNoOp && releaseStatus == release.StatusDeployed && opts.helmVerb() == "upgrade" {
+		noOp, err := isNoOpUpgrade(actionConfig, opts)
+		if err != nil {
+			return err
+		}
+
+		if noOp {
+			opts.logger.Printf("Values and chart version match the deployed release, skipping helm %s", opts.helmCommand)
+
+			return nil
+		}
+	}
+
+	if opts.onlyIfChanged != "" && releaseStatus == release.StatusDeployed && opts.helmVerb() == "upgrade" {
+		changed, err := valueChanged(actionConfig, opts)
+		if err != nil {
+			return err
+		}
+
+		if !changed {
+			opts.logger.Printf("Value '%s' matches the deployed release, skipping helm %s", opts.onlyIfChanged, opts.helmCommand)
+
+			return nil
+		}
+	}
+
+	if releaseStatus == release.StatusDeployed || releaseStatus == release.StatusUnknown {
+		recordDecision(opts, report, statusDecision(releaseStatus))
+	} else {
+		report.setPhase(phaseRollback)
+
+		rollback, err := rollbackFailedRelease(ctx, client, actionConfig, lock, opts, releaseStatus, report)
+		report.rollback = rollback
+
+		if err != nil {
+			return err
+		}
+
+		if rollback && opts.rollbackAsync {
+			opts.logger.Printf("Rollback submitted, releasing the lock without running helm %s", opts.helmCommand)
+
+			return &Error{
+				error: fmt.Errorf("rollback of release '%s' was submitted, helm %s did not run", opts.releaseName, opts.helmCommand),
+				Code:  ExitCodeRollbackSubmitted,
+			}
+		}
+
+		if rollback && opts.postRollbackDelay > 0 {
+			opts.logger.Printf("Waiting %s after the rollback before running helm %s", opts.postRollbackDelay, opts.helmCommand)
+
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("interrupted while waiting after the rollback: %w", ctx.Err())
+			case <-time.After(opts.postRollbackDelay):
+			}
+		}
+	}
+
+	report.setPhase(phaseHelm)
+
+	if verb := opts.helmVerb(); opts.injectHolderLabel != "" && (verb == "install" || verb == "upgrade") {
+		opts.helmFlags = append(opts.helmFlags, holderValueFlags(opts.injectHolderLabel, identity)...)
+	}
+
+	if opts.verifyTarget {
+		verifyTarget(ctx, opts, releaseStatus)
+	}
+
+	return executeHelmCommand(ctx, opts)
+}
+
+// approveRollback asks the rollback webhook for an approval of the rollback to the version,
+// 0 is the previous revision
+func approveRollback(ctx context.Context, actionConfig *action.Configuration, opts *lockOptions, identity string, releaseStatus release.Status, version int) error {
+	current, err := actionConfig.Releases.Last(opts.releaseName)
+	if err != nil {
+		return fmt.Errorf("failed to get the current revision: %w", err)
+	}
+
+	target := version
+	if target == 0 {
+		target = current.Version - 1
+	}
+
+	payload := rollbackWebhookPayload{
+		Release:         opts.releaseName,
+		Namespace:       opts.helmSettings.Namespace(),
+		Holder:          identity,
+		Status:          releaseStatus.String(),
+		CurrentRevision: current.Version,
+		TargetRevision:  target,
+	}
+
+	if err := postWebhook(ctx, opts.rollbackWebhook, opts.rollbackWebhookTimeout, payload); err != nil {
+		return fmt.Errorf("rollback webhook rejected the rollback from revision %d to %d: %w", current.Version, target, err)
+	}
+
+	opts.logger.Printf("Rollback from revision %d to %d approved by the rollback webhook", current.Version, target)
+
+	return nil
+}
+
+// maxRenewJitter keeps the jittered renew deadline above JitterFactor times the jittered retry period
+const maxRenewJitter = 3 * time.Second
+
+// jitterRenewal lowers the renew deadline and raises the retry period by random amounts below the
+// jitter, so the renewals of many holders do not fire at the same instant
+func jitterRenewal(config *leaderelection.LeaderElectionConfig, jitter time.Duration) {
+	if jitter <= 0 {
+		return
+	}
+
+	jitter = min(jitter, maxRenewJitter)
+
+	config.RenewDeadline -= rand.N(jitter)
+	config.RetryPeriod += rand.N(jitter)
+}
+
+// staleRollbackRetries is how many times a rollback failed on a stale release state is re-evaluated
+const staleRollbackRetries = 2
+
+// rollbackFailedRelease rolls back a release that is not deployed, it reports whether the rollback was performed
+func rollbackFailedRelease(ctx context.Context, client kubernetes.Interface, actionConfig *action.Configuration, lock resourcelock.Interface, opts *lockOptions, releaseStatus release.Status, report *lockReport) (rollback bool, err error) {
+	revisions, err := getReleaseRevisions(actionConfig, opts.releaseName)
+	if err != nil {
+		return false, fmt.Errorf("failed to get release history: %w", err)
+	}
+
+	decide := func(rollback bool, target int, policy, detail string) {
+		recordDecision(opts, report, rollbackDecision{
+			Status:    releaseStatus.String(),
+			Revisions: revisions,
+			Rollback:  rollback,
+			Target:    target,
+			Policy:    policy,
+			Detail:    detail,
+		})
+	}
+
+	if revisions <= 1 {
+		decide(false, 0, policyNoPreviousRevision, opts.failedInstallAction)
+
+		if opts.failedInstallAction == failedInstallFail {
+			return false, fmt.Errorf("release status is '%s' and there is no previous revision to roll back to", releaseStatus)
+		}
+
+		opts.logger.Printf("Release status is '%s' but it has no previous revision, skipping rollback", releaseStatus)
+
+		return false, nil
+	}
+
+	if opts.isDryRun() {
+		decide(false, 0, policyDryRun, "")
+
+		opts.logger.Printf("Release status is '%s', skipping rollback because helm runs with --dry-run", releaseStatus)
+
+		return false, nil
+	}
+
+	if pattern := opts.noRollbackPattern(); pattern != "" {
+		decide(false, 0, policyNoRollbackMatch, pattern)
+
+		opts.logger.Printf("Release status is '%s', skipping rollback because the release matches --no-rollback-match '%s'", releaseStatus, pattern)
+
+		return false, nil
+	}
+
+	opts.logger.Printf("Release status is '%s', performing rollback first", releaseStatus)
+
+	_, span := startSpan(ctx, opts, "rollback")
+	defer func() { endSpan(span, err) }()
+
+	version := 0
+
+	if opts.rollbackToAnnotated != "" {
+		version, err = findAnnotatedRevision(actionConfig, opts.releaseName, opts.rollbackToAnnotated)
+		if err != nil {
+			return false, fmt.Errorf("failed to find annotated revision: %w", err)
+		}
+
+		if version == 0 {
+			opts.logger.Printf("No previous revision is annotated with '%s', rolling back to the previous revision", opts.rollbackToAnnotated)
+		} else {
+			opts.logger.Printf("Rolling back to revision %d annotated with '%s'", version, opts.rollbackToAnnotated)
+		}
+	}
+
+	if opts.rollbackToLastGood {
+		var skipped int
+
+		version, skipped, err = findLastGoodRevision(actionConfig, opts.releaseName)
+		if err != nil {
+			return false, fmt.Errorf("failed to find the last deployed revision: %w", err)
+		}
+
+		if version == 0 {
+			decide(false, 0, policyLastGood, "no previous revision was deployed")
+
+			return false, fmt.Errorf("release status is '%s' and no previous revision was deployed", releaseStatus)
+		}
+
+		opts.logger.Printf("Rolling back to the last deployed revision %d, skipping %d failed revision(s)", version, skipped)
+	}
+
+	policy, detail := policyPreviousRevision, ""
+
+	switch {
+	case opts.rollbackToAnnotated != "":
+		policy, detail = policyAnnotated, opts.rollbackToAnnotated
+	case opts.rollbackToLastGood:
+		policy = policyLastGood
+	}
+
+	target := rollbackTarget(actionConfig, opts.releaseName, version)
+
+	if opts.rollbackWebhook != "" {
+		if err := approveRollback(ctx, actionConfig, opts, report.holder, releaseStatus, version); err != nil {
+			decide(false, target, policyRollbackWebhook, err.Error())
+
+			return false, err
+		}
+	}
+
+	// the slot is taken only for a rollback that runs, a rejected or impossible one keeps it free
+	if opts.rollbackLimit > 0 {
+		record := rollbackRecord{
+			Timestamp: time.Now().UTC(),
+			Release:   opts.releaseName,
+			Namespace: opts.helmSettings.Namespace(),
+		}
+
+		if err := reserveRollback(ctx, client, opts, record); err != nil {
+			decide(false, target, policyRollbackLimit, err.Error())
+
+			return false, fmt.Errorf("release status is '%s', refusing to roll back: %w", releaseStatus, err)
+		}
+	}
+
+	decide(true, target, policy, detail)
+
+	if opts.rollbackProgress && !opts.rollbackAsync {
+		progressCtx, stopProgress := context.WithCancel(ctx)
+		progressDone := make(chan struct{})
+
+		go func() {
+			defer close(progressDone)
+
+			rollbackProgress(progressCtx, client, actionConfig, opts, opts.pollInterval)
+		}()
+
+		defer func() {
+			stopProgress()
+			<-progressDone
+		}()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = performRollback(actionConfig, opts.releaseName, version, !opts.rollbackAsync)
+		if err == nil {
+			break
+		}
+
+		if attempt > staleRollbackRetries || !isStaleRollbackError(err) {
+			return true, fmt.Errorf("rollback failed: %w", err)
+		}
+
+		status, statusErr := getReleaseStatus(actionConfig, opts.releaseName)
+		if statusErr != nil {
+			return true, fmt.Errorf("rollback failed: %w, and the release status cannot be refetched: %w", err, statusErr)
+		}
+
+		opts.logger.Printf("Rollback failed on a stale release state (attempt %d/%d): %v, release status is now '%s'", attempt, staleRollbackRetries+1, err, status)
+
+		switch {
+		case status == release.StatusDeployed || status == release.StatusUnknown:
+			opts.logger.Printf("Release status is '%s', the rollback is no longer needed", status)
+
+			return false, nil
+		case status.IsPending():
+			return true, fmt.Errorf("rollback failed: release status changed to '%s' while the lock was held", status)
+		}
+	}
+
+	if opts.rollbackMaxHistory > 0 {
+		pruned, err := pruneHistory(actionConfig, opts.releaseName, opts.rollbackMaxHistory)
+		if err != nil {
+			opts.logger.Printf("Warning: failed to prune release history: %v", err)
+		} else if pruned > 0 {
+			opts.logger.Printf("Pruned %d old revision(s) of release '%s', keeping %d", pruned, opts.releaseName, opts.rollbackMaxHistory)
+		}
+	}
+
+	if opts.rollbackAsync {
+		submitted := asyncRollback{Target: target, State: asyncRollbackPending, Submitted: formatTime(time.Now())}
+		if rel, err := actionConfig.Releases.Last(opts.releaseName); err == nil {
+			submitted.Revision = rel.Version
+		}
+
+		setAsyncRollback(lock, checkAsyncRollback(ctx, client, actionConfig, opts.releaseName, submitted))
+	}
 
-	return cmd.Run()
+	return true, nil
 }
@@ -0,0 +1,591 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"helm.sh/helm/v3/pkg/cli"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// writeKubeconfig writes a kubeconfig with a context per API server, the first one is the current context
+func writeKubeconfig(t *testing.T, dir, name string, servers ...string) string {
+	t.Helper()
+
+	var clusters, contexts strings.Builder
+
+	for i, server := range servers {
+		fmt.Fprintf(&clusters, "- name: cluster-%d\n  cluster:\n    server: %s\n", i, server)
+		fmt.Fprintf(&contexts, "- name: context-%d\n  context:\n    cluster: cluster-%d\n    user: user\n", i, i)
+	}
+
+	content := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+%scontexts:
+%scurrent-context: context-0
+users:
+- name: user
+  user:
+    token: token
+`, clusters.String(), contexts.String())
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestKubeconfig(t *testing.T) {
+	dir := t.TempDir()
+	kubeconfig := writeKubeconfig(t, dir, "release", "https://release.example.test:6443")
+
+	// the flag wins over the environment
+	t.Setenv("KUBECONFIG", writeKubeconfig(t, dir, "env", "https://env.example.test:6443"))
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "separate value", args: []string{"upgrade", "app", "./chart", "--kubeconfig", kubeconfig}},
+		{name: "inline value", args: []string{"upgrade", "app", "./chart", "--kubeconfig=" + kubeconfig}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := newTestOptions(io.Discard)
+			opts.helmSettings = cli.New()
+
+			hf := pflag.NewFlagSet("helm", pflag.ContinueOnError)
+			hf.ParseErrorsAllowlist.UnknownFlags = true
+			opts.helmSettings.AddFlags(hf)
+
+			if err := hf.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			opts.helmFlags = getAllFlags(tt.args, pflag.NewFlagSet("lock", pflag.ContinueOnError), hf)
+
+			if value, ok := flagValue(opts.helmFlags, "--kubeconfig"); !ok || value != kubeconfig {
+				t.Errorf("forwarded flags %v, want --kubeconfig %s", opts.helmFlags, kubeconfig)
+			}
+
+			clientset, actionConfig, err := newClients(opts)
+			if err != nil {
+				t.Fatalf("newClients() error = %v", err)
+			}
+
+			if host := clientset.(*kubernetes.Clientset).CoordinationV1().RESTClient().Get().URL().Host; host != "release.example.test:6443" {
+				t.Errorf("lock client host = %s, want release.example.test:6443", host)
+			}
+
+			config, err := actionConfig.RESTClientGetter.ToRESTConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if u, err := url.Parse(config.Host); err != nil || u.Host != "release.example.test:6443" {
+				t.Errorf("action config host = %s, want release.example.test:6443", config.Host)
+			}
+		})
+	}
+}
+
+func TestExecHelmKubeconfig(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake helm is a shell script")
+	}
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "kubeconfig")
+
+	script := "#!/bin/sh\nprintf '%s' \"$KUBECONFIG\" > " + out + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "helm"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("KUBECONFIG", filepath.Join(dir, "env"))
+
+	opts := newTestOptions(io.Discard)
+	opts.helmSettings.KubeConfig = filepath.Join(dir, "release")
+
+	if err := execHelm(context.Background(), opts, []string{"upgrade", "app", "./chart"}, io.Discard, io.Discard); err != nil {
+		t.Fatalf("execHelm() error = %v", err)
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != opts.helmSettings.KubeConfig {
+		t.Errorf("KUBECONFIG of helm = %q, want %q", got, opts.helmSettings.KubeConfig)
+	}
+}
+
+func TestCheckIdentityReuse(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity string
+		allow    bool
+		holder   string
+		expired  bool
+		lockType string
+		wantErr  bool
+		wantLog  string
+	}{
+		{name: "generated identity", holder: "helm-lock-upgrade-1"},
+		{name: "free lock", identity: "runner"},
+		{name: "lock held by another identity", identity: "runner", holder: "other"},
+		{name: "expired lock of the identity", identity: "runner", holder: "runner", expired: true},
+		{name: "lock held by the identity", identity: "runner", holder: "runner", wantErr: true},
+		{name: "lock held by the identity with --allow-identity-reuse", identity: "runner", holder: "runner", allow: true, wantLog: "taking it over"},
+		{name: "configmap lock", identity: "runner", holder: "runner", lockType: lockTypeConfigMap},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset()
+
+			if tt.holder != "" {
+				renewedAgo := time.Duration(0)
+				if tt.expired {
+					renewedAgo = time.Minute
+				}
+
+				client = fake.NewClientset(testLease("helm-lock-app", tt.holder, renewedAgo))
+			}
+
+			var out bytes.Buffer
+
+			opts := newTestOptions(&out)
+			opts.identity = tt.identity
+			opts.allowIdentityReuse = tt.allow
+
+			if tt.lockType != "" {
+				opts.lockTypes = []string{tt.lockType}
+			}
+
+			err := checkIdentityReuse(context.Background(), client, opts, "default", "helm-lock-app")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkIdentityReuse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !strings.Contains(out.String(), tt.wantLog) {
+				t.Errorf("log has no %q:\n%s", tt.wantLog, out.String())
+			}
+		})
+	}
+}
+
+func TestRunIdentityReuse(t *testing.T) {
+	fixture := writeFixture(t, failedReleaseFixture+`leases:
+- name: helm-lock-app
+  holderIdentity: runner
+`)
+
+	err := run(context.Background(), []string{"upgrade", "app", "./chart", "--fixture", fixture, "--identity", "runner", "--lock-timeout", "5s"})
+	if err == nil || !strings.Contains(err.Error(), "--allow-identity-reuse") {
+		t.Errorf("run() error = %v, want the identity reuse error", err)
+	}
+}
+
+func TestDiffUnwrapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		args     []string
+		lockDiff bool
+		verb     string
+		readOnly bool
+	}{
+		{name: "diff upgrade", command: "diff", args: []string{"upgrade", "app", "./chart"}, verb: "upgrade", readOnly: true},
+		{name: "diff rollback", command: "diff", args: []string{"rollback", "app", "1"}, verb: "rollback", readOnly: true},
+		{name: "diff upgrade with --lock-diff", command: "diff", args: []string{"upgrade", "app", "./chart"}, lockDiff: true, verb: "upgrade"},
+		{name: "upgrade", command: "upgrade", args: []string{"app", "./chart"}, verb: "upgrade"},
+		{name: "secrets upgrade", command: "secrets", args: []string{"upgrade", "app", "./chart"}, verb: "upgrade"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := newTestOptions(io.Discard)
+			opts.helmCommand = tt.command
+			opts.helmArgs = tt.args
+			opts.lockDiff = tt.lockDiff
+
+			if verb := opts.helmVerb(); verb != tt.verb {
+				t.Errorf("helmVerb() = %q, want %q", verb, tt.verb)
+			}
+
+			if readOnly := opts.isReadOnly(); readOnly != tt.readOnly {
+				t.Errorf("isReadOnly() = %v, want %v", readOnly, tt.readOnly)
+			}
+
+			if name, err := ResolveReleaseName(tt.command, tt.args); err != nil || name != "app" {
+				t.Errorf("ResolveReleaseName() = %q, %v, want app", name, err)
+			}
+		})
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	fixture := writeFixture(t, failedReleaseFixture)
+
+	tests := []struct {
+		name     string
+		args     []string
+		holder   string
+		rollback bool
+	}{
+		{name: "without the lock", args: []string{"diff", "upgrade", "app", "./chart"}},
+		{name: "with --lock-diff", args: []string{"diff", "upgrade", "app", "./chart", "--lock-diff"}, holder: "runner", rollback: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summaryPath := filepath.Join(t.TempDir(), "summary.json")
+
+			if err := run(context.Background(), append(tt.args, "--fixture", fixture, "--identity", "runner", "--summary-json", summaryPath)); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			summary := readSummary(t, summaryPath)
+			if summary.Holder != tt.holder || summary.Rollback != tt.rollback {
+				t.Errorf("summary holder=%q rollback=%v, want %q, %v", summary.Holder, summary.Rollback, tt.holder, tt.rollback)
+			}
+		})
+	}
+}
+
+// newTestAPIServer returns a server that answers the version request of a reachability check
+func newTestAPIServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"major": "1", "minor": "31", "gitVersion": "v1.31.0"}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestLockKubeContext(t *testing.T) {
+	release := newTestAPIServer(t)
+	lock := newTestAPIServer(t)
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []struct {
+		name     string
+		servers  []string
+		context  string
+		wantLock string
+		wantErr  string
+	}{
+		{name: "helm context", servers: []string{release.URL, lock.URL}, wantLock: release.URL},
+		{name: "lock context", servers: []string{release.URL, lock.URL}, context: "context-1", wantLock: lock.URL},
+		{name: "unknown lock context", servers: []string{release.URL, lock.URL}, context: "central", wantErr: "lock context 'central'"},
+		{name: "unreachable release cluster", servers: []string{down.URL, lock.URL}, context: "context-1", wantErr: "release cluster is not reachable"},
+		{name: "unreachable lock cluster", servers: []string{release.URL, down.URL}, context: "context-1", wantErr: "lock cluster is not reachable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := newTestOptions(io.Discard)
+			opts.helmSettings.KubeConfig = writeKubeconfig(t, t.TempDir(), "config", tt.servers...)
+			opts.lockKubeContext = tt.context
+
+			clientset, actionConfig, err := newClients(opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("newClients() error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("newClients() error = %v", err)
+			}
+
+			if host := clientset.(*kubernetes.Clientset).CoordinationV1().RESTClient().Get().URL().Host; "http://"+host != tt.wantLock {
+				t.Errorf("lock client host = %s, want %s", host, tt.wantLock)
+			}
+
+			config, err := actionConfig.RESTClientGetter.ToRESTConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if config.Host != release.URL {
+				t.Errorf("action config host = %s, want %s", config.Host, release.URL)
+			}
+		})
+	}
+}
+
+func TestOperationPhaseTimeout(t *testing.T) {
+	// the rollback webhook answers only when the run gives up
+	done := make(chan struct{})
+	webhook := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	t.Cleanup(webhook.Close)
+	t.Cleanup(func() { close(done) })
+
+	tests := []struct {
+		name    string
+		fixture string
+		held    bool
+		webhook string
+		want    string
+		wantErr error
+	}{
+		{name: "acquire", fixture: deployedReleaseFixture, held: true, want: "is held by 'other'", wantErr: ErrLockTimeout},
+		{name: "rollback", fixture: failedReleaseFixture, webhook: webhook.URL, want: "timed out during rollback", wantErr: context.DeadlineExceeded},
+		{name: "helm", fixture: deployedReleaseFixture, want: "timed out during helm execution", wantErr: context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, actionConfig, err := loadFixture(writeFixture(t, tt.fixture), "default")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			namespace := "phase-" + tt.name
+
+			if tt.held {
+				other := &memoryLocker{name: namespace + "-helm-lock-app", holder: "other", logger: func(string, ...any) {}}
+				if err := other.Lock(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+
+				t.Cleanup(func() { _ = other.Unlock() })
+			}
+
+			opts := newTestOptions(io.Discard)
+			opts.lockBackend = lockBackendMemory
+			opts.timeout = 300 * time.Millisecond
+			opts.rollbackWebhook = tt.webhook
+			opts.rollbackWebhookTimeout = time.Minute
+			opts.executor = func(ctx context.Context, _ *lockOptions, _ []string, _ io.Writer) error {
+				<-ctx.Done()
+
+				return ctx.Err()
+			}
+
+			err = acquireLockAndExecute(context.Background(), client, actionConfig, opts, "helm-lock-app", namespace, &lockReport{started: time.Now()})
+			if !errors.Is(err, tt.wantErr) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("acquireLockAndExecute() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReleaseNamespacePrecedence(t *testing.T) {
+	fixture := writeFixture(t, deployedReleaseFixture)
+
+	tests := []struct {
+		name  string
+		env   string
+		extra string
+		args  []string
+		want  string
+	}{
+		{name: "default", want: "default"},
+		{name: "HELM_NAMESPACE", env: "env", want: "env"},
+		{name: "namespace flag", env: "env", args: []string{"-n", "prod"}, want: "prod"},
+		{name: "namespace flag in the extra arguments", env: "env", extra: "-n extra", want: "env"},
+		{name: "release namespace", env: "env", args: []string{"--namespace", "prod", "--release-namespace", "release"}, want: "release"},
+		{name: "release namespace over the extra arguments", extra: "-n extra", args: []string{"--release-namespace", "release"}, want: "release"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HELM_NAMESPACE", tt.env)
+			t.Setenv(extraArgsEnv, tt.extra)
+
+			summaryPath := filepath.Join(t.TempDir(), "summary.json")
+			args := append([]string{"upgrade", "app", "./chart", "--fixture", fixture, "--summary-json", summaryPath}, tt.args...)
+
+			if err := run(context.Background(), args); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			if namespace := readSummary(t, summaryPath).Namespace; namespace != tt.want {
+				t.Errorf("release namespace = %q, want %q", namespace, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecHelmReleaseNamespace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake helm is a shell script")
+	}
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "namespace")
+
+	script := "#!/bin/sh\nprintf '%s' \"$HELM_NAMESPACE\" > " + out + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "helm"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		name             string
+		env              string
+		releaseNamespace string
+		want             string
+	}{
+		{name: "inherited", env: "env", want: "env"},
+		{name: "release namespace", env: "env", releaseNamespace: "release", want: "release"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HELM_NAMESPACE", tt.env)
+
+			opts := newTestOptions(io.Discard)
+			opts.releaseNamespace = tt.releaseNamespace
+
+			if err := execHelm(context.Background(), opts, []string{"upgrade", "app", "./chart"}, io.Discard, io.Discard); err != nil {
+				t.Fatalf("execHelm() error = %v", err)
+			}
+
+			got, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("HELM_NAMESPACE of helm = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecHelmAssumeYes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake helm is a shell script")
+	}
+
+	dir := t.TempDir()
+
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + filepath.Join(dir, "args") + "\ncat > " + filepath.Join(dir, "stdin") + "\nenv | sort > " + filepath.Join(dir, "env") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "helm"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// the answer on stdin reaches helm only without --assume-yes
+	stdin, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.WriteString("y\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	w.Close() //nolint:errcheck
+
+	orig := os.Stdin
+	os.Stdin = stdin
+
+	t.Cleanup(func() {
+		os.Stdin = orig
+		stdin.Close() //nolint:errcheck
+	})
+
+	run := func(assumeYes bool) map[string]string {
+		opts := newTestOptions(io.Discard)
+		opts.assumeYes = assumeYes
+
+		if err := execHelm(context.Background(), opts, []string{"upgrade", "app", "./chart", "--wait"}, io.Discard, io.Discard); err != nil {
+			t.Fatalf("execHelm() error = %v", err)
+		}
+
+		got := map[string]string{}
+
+		for _, name := range []string{"args", "stdin", "env"} {
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got[name] = string(data)
+		}
+
+		return got
+	}
+
+	// the pipe is read once, helm with --assume-yes runs first so it would get the answer
+	assumed, inherited := run(true), run(false)
+
+	if inherited["stdin"] != "y\n" {
+		t.Errorf("stdin of helm = %q, want %q", inherited["stdin"], "y\n")
+	}
+
+	if assumed["stdin"] != "" {
+		t.Errorf("stdin of helm with --assume-yes = %q, want end of file", assumed["stdin"])
+	}
+
+	if want := "upgrade\napp\n./chart\n--wait\n"; assumed["args"] != want {
+		t.Errorf("arguments of helm with --assume-yes = %q, want %q", assumed["args"], want)
+	}
+
+	if assumed["env"] != inherited["env"] {
+		t.Errorf("environment of helm with --assume-yes = %q, want %q", assumed["env"], inherited["env"])
+	}
+}
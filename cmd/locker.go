@@ -0,0 +1,331 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/tools/leaderelection"
+)
+
+// Lock backends
+const (
+	lockBackendKubernetes = "kubernetes"
+	lockBackendFile       = "file"
+	lockBackendHTTP       = "http"
+)
+
+// lockBackendMemory is not a --lock-backend value, the tests run the locked operation flow with it
+const lockBackendMemory = "memory"
+
+var lockBackends = []string{lockBackendKubernetes, lockBackendFile, lockBackendHTTP}
+
+const fileLockPollInterval = 100 * time.Millisecond
+
+// errFileLocked is returned when another process holds the lock file
+var errFileLocked = errors.New("lock file is held by another process")
+
+// locker serializes the helm runs of a release without the Kubernetes leader election
+type locker interface {
+	// Lock blocks until the lock is held or the context is done
+	Lock(ctx context.Context) error
+	// Unlock releases the held lock
+	Unlock() error
+	// Holder returns the holder the lock was last seen held by, empty when unknown
+	Holder() string
+}
+
+// expiringLocker is a locker whose lock can be lost while it is held
+type expiringLocker interface {
+	locker
+	// Lost returns a channel closed when the held lock is lost
+	Lost() <-chan struct{}
+}
+
+// fileLocker is a host local lock based on flock, or LockFileEx on Windows
+type fileLocker struct {
+	path   string
+	holder string
+	logger func(format string, v ...any)
+	file   *os.File
+}
+
+var _ locker = &fileLocker{}
+
+// Lock takes an exclusive lock on the lock file, a flock or a LockFileEx lock on Windows
+func (l *fileLocker) Lock(ctx context.Context) error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(fileLockPollInterval)
+	defer ticker.Stop()
+
+	for waiting := false; ; waiting = true {
+		err := tryLockFile(f)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, errFileLocked) {
+			f.Close() //nolint:errcheck
+
+			return err
+		}
+
+		if !waiting {
+			l.logger("Lock file '%s' is held by another process, waiting", l.path)
+		}
+
+		select {
+		case <-ctx.Done():
+			f.Close() //nolint:errcheck
+
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	// the holder is informational, the file lock itself is the lock
+	if err := f.Truncate(0); err == nil {
+		fmt.Fprintln(f, l.holder)
+	}
+
+	l.file = f
+
+	return nil
+}
+
+// Unlock releases the file lock, the file is kept so that waiting processes lock the same inode
+func (l *fileLocker) Unlock() error {
+	if l.file == nil {
+		return nil
+	}
+
+	defer func() {
+		l.file.Close() //nolint:errcheck
+		l.file = nil
+	}()
+
+	return unlockFile(l.file)
+}
+
+// Holder reads the holder the lock file was written by
+func (l *fileLocker) Holder() string {
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+// memoryLocks are the locks of the memory backend, shared by all lockers of the process
+var memoryLocks = struct {
+	sync.Mutex
+	locks map[string]*memoryLock
+}{locks: map[string]*memoryLock{}}
+
+// memoryLock is a lock of the memory backend, the channel holds a token while the lock is free
+type memoryLock struct {
+	free   chan struct{}
+	holder string
+}
+
+// memoryLocker is a process local lock for the tests, it needs no cluster and serializes only within the process
+type memoryLocker struct {
+	name   string
+	holder string
+	logger func(format string, v ...any)
+	lock   *memoryLock
+}
+
+var _ locker = &memoryLocker{}
+
+// getMemoryLock returns the memory lock of the name, it is created free on the first use
+func getMemoryLock(name string) *memoryLock {
+	memoryLocks.Lock()
+	defer memoryLocks.Unlock()
+
+	lock, ok := memoryLocks.locks[name]
+	if !ok {
+		lock = &memoryLock{free: make(chan struct{}, 1)}
+		lock.free <- struct{}{}
+		memoryLocks.locks[name] = lock
+	}
+
+	return lock
+}
+
+// Lock takes the token of the memory lock
+func (l *memoryLocker) Lock(ctx context.Context) error {
+	lock := getMemoryLock(l.name)
+
+	select {
+	case <-lock.free:
+	default:
+		memoryLocks.Lock()
+		holder := lock.holder
+		memoryLocks.Unlock()
+
+		l.logger("Lock '%s' is held by '%s', waiting", l.name, holder)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-lock.free:
+		}
+	}
+
+	memoryLocks.Lock()
+	lock.holder = l.holder
+	memoryLocks.Unlock()
+
+	l.lock = lock
+
+	return nil
+}
+
+// Unlock puts the token back
+func (l *memoryLocker) Unlock() error {
+	if l.lock == nil {
+		return nil
+	}
+
+	memoryLocks.Lock()
+	l.lock.holder = ""
+	memoryLocks.Unlock()
+
+	l.lock.free <- struct{}{}
+	l.lock = nil
+
+	return nil
+}
+
+// Holder returns the holder of the memory lock
+func (l *memoryLocker) Holder() string {
+	lock := getMemoryLock(l.name)
+
+	memoryLocks.Lock()
+	defer memoryLocks.Unlock()
+
+	return lock.holder
+}
+
+// newLocker returns the locker of the --lock-backend, the lock objects of the kubernetes backend
+// are created by newResourceLock
+func newLocker(opts *lockOptions, namespace, lockName, identity string) (locker, error) {
+	name := namespace + "-" + lockName
+
+	switch opts.lockBackend {
+	case lockBackendFile:
+		return &fileLocker{
+			path:   filepath.Join(opts.lockDir, name+".lock"),
+			holder: identity,
+			logger: opts.logger.Printf,
+		}, nil
+	case lockBackendMemory:
+		return &memoryLocker{
+			name:   name,
+			holder: identity,
+			logger: opts.logger.Printf,
+		}, nil
+	case lockBackendHTTP:
+		return &httpLocker{
+			endpoint: opts.lockEndpoint,
+			name:     name,
+			holder:   identity,
+			logger:   opts.logger.Printf,
+			client:   http.DefaultClient,
+		}, nil
+	default:
+		return nil, fmt.Errorf("lock backend '%s' has no locker", opts.lockBackend)
+	}
+}
+
+// lockElector runs the callbacks while the lock is held, the leader elector of the kubernetes backend
+// and lockerElector of the other backends implement it
+type lockElector interface {
+	Run(ctx context.Context)
+	GetLeader() string
+}
+
+var _ lockElector = &leaderelection.LeaderElector{}
+
+// lockerElector holds the lock of a locker like the leader elector holds a lease: OnStartedLeading runs
+// with a context that is cancelled when the lock is lost or Run's context is done, then the lock is
+// released and OnStoppedLeading runs
+type lockerElector struct {
+	locker    locker
+	callbacks leaderelection.LeaderCallbacks
+	logger    func(format string, v ...any)
+	// failed is called instead of OnStartedLeading when the lock cannot be acquired
+	failed func(err error)
+}
+
+// Run acquires the lock and blocks until the context is done or the lock is lost
+func (e *lockerElector) Run(ctx context.Context) {
+	if err := e.locker.Lock(ctx); err != nil {
+		if ctx.Err() == nil {
+			e.failed(err)
+		}
+
+		return
+	}
+
+	defer e.callbacks.OnStoppedLeading()
+
+	defer func() {
+		if err := e.locker.Unlock(); err != nil {
+			e.logger("Warning: failed to release lock: %v", err)
+		}
+	}()
+
+	var lost <-chan struct{}
+	if expiring, ok := e.locker.(expiringLocker); ok {
+		lost = expiring.Lost()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go e.callbacks.OnStartedLeading(ctx)
+
+	select {
+	case <-ctx.Done():
+	case <-lost:
+		e.logger("Warning: the lock was lost, stopping the operation")
+	}
+}
+
+// GetLeader returns the holder the lock was last seen held by
+func (e *lockerElector) GetLeader() string {
+	return e.locker.Holder()
+}
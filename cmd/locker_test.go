@@ -0,0 +1,530 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// failedReleaseFixture has a deployed revision 1 and a failed revision 2 of the release app
+const failedReleaseFixture = `releases:
+- name: app
+  revision: 1
+  status: deployed
+  chart: app
+  chartVersion: 1.0.0
+- name: app
+  revision: 2
+  status: failed
+  chart: app
+  chartVersion: 1.0.1
+`
+
+// writeFixture writes the fixture to a temporary file
+func writeFixture(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "fixture.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// readSummary reads the --summary-json artifact of a run
+func readSummary(t *testing.T, path string) runSummary {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read the summary: %v", err)
+	}
+
+	var summary runSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatalf("failed to parse the summary: %v", err)
+	}
+
+	return summary
+}
+
+func TestFileLockerContention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "default-helm-lock-app.lock")
+	logger := func(string, ...any) {}
+
+	first := &fileLocker{path: path, holder: "first", logger: logger}
+	second := &fileLocker{path: path, holder: "second", logger: logger}
+
+	if err := first.Lock(context.Background()); err != nil {
+		t.Fatalf("first Lock() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*fileLockPollInterval)
+	defer cancel()
+
+	if err := second.Lock(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second Lock() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if holder := second.Holder(); holder != "first" {
+		t.Errorf("Holder() = %q, want %q", holder, "first")
+	}
+
+	if err := first.Unlock(); err != nil {
+		t.Fatalf("first Unlock() error = %v", err)
+	}
+
+	if err := second.Lock(context.Background()); err != nil {
+		t.Fatalf("second Lock() after release error = %v", err)
+	}
+
+	if err := second.Unlock(); err != nil {
+		t.Fatalf("second Unlock() error = %v", err)
+	}
+}
+
+func TestFileBackendRunsLockedOperation(t *testing.T) {
+	fixture := writeFixture(t, failedReleaseFixture)
+
+	tests := []struct {
+		name     string
+		args     []string
+		lockFile string
+	}{
+		{
+			name:     "release name",
+			lockFile: "default-helm-lock-app.lock",
+		},
+		{
+			name:     "shared lock name",
+			args:     []string{"--lock-name", "shared"},
+			lockFile: "default-helm-lock-shared.lock",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			summaryPath := filepath.Join(dir, "summary.json")
+
+			args := append([]string{
+				"upgrade", "app", "./chart",
+				"--fixture", fixture,
+				"--lock-backend", lockBackendFile,
+				"--lock-dir", dir,
+				"--identity", "runner",
+				"--summary-json", summaryPath,
+			}, tt.args...)
+
+			if err := run(context.Background(), args); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(dir, tt.lockFile)); err != nil {
+				t.Errorf("lock file %s: %v", tt.lockFile, err)
+			}
+
+			summary := readSummary(t, summaryPath)
+			if summary.Holder != "runner" || !summary.Rollback || summary.Result != "ok" {
+				t.Errorf("summary holder=%q rollback=%v result=%q, want runner, true, ok", summary.Holder, summary.Rollback, summary.Result)
+			}
+
+			if d := summary.Decision; d == nil || d.Target != 1 || d.Policy != policyPreviousRevision {
+				t.Errorf("rollback decision = %+v, want a rollback to revision 1 by %s", d, policyPreviousRevision)
+			}
+		})
+	}
+}
+
+func TestFileBackendLockTimeout(t *testing.T) {
+	dir := t.TempDir()
+
+	holder := &fileLocker{path: filepath.Join(dir, "default-helm-lock-app.lock"), holder: "other", logger: func(string, ...any) {}}
+	if err := holder.Lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Unlock() //nolint:errcheck
+
+	err := run(context.Background(), []string{
+		"upgrade", "app", "./chart",
+		"--fixture", writeFixture(t, failedReleaseFixture),
+		"--lock-backend", lockBackendFile,
+		"--lock-dir", dir,
+		"--lock-timeout", "300ms",
+	})
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("run() error = %v, want %v", err, ErrLockTimeout)
+	}
+
+	if !strings.Contains(err.Error(), "'other'") {
+		t.Errorf("run() error = %v, want the holder 'other'", err)
+	}
+}
+
+func TestNonKubernetesBackendRejectsLockObjectFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "lock and exit", args: []string{"--lock-and-exit", "1m"}},
+		{name: "lock dependencies", args: []string{"--lock-dependencies"}},
+		{name: "owner reference", args: []string{"--owner-ref", "job/deploy"}},
+		{name: "break dead holder", args: []string{"--break-dead-holder"}},
+		{name: "watch lock", args: []string{"--watch-lock"}},
+		{name: "record last operation", args: []string{"--record-last-operation"}},
+		{name: "dump lease", args: []string{"--dump-lease"}},
+		{name: "strict serialize", args: []string{"--strict-serialize"}},
+		{name: "create lock namespace", args: []string{"--create-lock-namespace"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"upgrade", "app", "./chart", "--lock-backend", lockBackendFile}, tt.args...)
+
+			err := run(context.Background(), args)
+			if err == nil || !strings.Contains(err.Error(), "works with the kubernetes lock backend only") {
+				t.Errorf("run() error = %v, want a kubernetes backend only error", err)
+			}
+		})
+	}
+}
+
+// deployedReleaseFixture has the deployed revision 1 of the release app and of the release api
+const deployedReleaseFixture = `releases:
+- name: app
+  revision: 1
+  status: deployed
+  chart: app
+- name: api
+  revision: 1
+  status: deployed
+  chart: api
+`
+
+// waitForLog polls the log output until it has the text
+func waitForLog(t *testing.T, out *syncBuffer, text string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), text) {
+		if time.Now().After(deadline) {
+			t.Fatalf("log has no %q:\n%s", text, out.String())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMemoryLockerContention(t *testing.T) {
+	logger := func(string, ...any) {}
+
+	first := &memoryLocker{name: t.Name(), holder: "first", logger: logger}
+	second := &memoryLocker{name: t.Name(), holder: "second", logger: logger}
+
+	if err := first.Lock(context.Background()); err != nil {
+		t.Fatalf("first Lock() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := second.Lock(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("second Lock() error = %v, want %v", err, context.Canceled)
+	}
+
+	if holder := second.Holder(); holder != "first" {
+		t.Errorf("Holder() = %q, want %q", holder, "first")
+	}
+
+	acquired := make(chan error, 1)
+
+	go func() { acquired <- second.Lock(context.Background()) }()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("second Lock() returned %v while the lock is held", err)
+	default:
+	}
+
+	if err := first.Unlock(); err != nil {
+		t.Fatalf("first Unlock() error = %v", err)
+	}
+
+	if err := <-acquired; err != nil {
+		t.Fatalf("second Lock() after release error = %v", err)
+	}
+
+	if holder := first.Holder(); holder != "second" {
+		t.Errorf("Holder() = %q, want %q", holder, "second")
+	}
+
+	if err := second.Unlock(); err != nil {
+		t.Fatalf("second Unlock() error = %v", err)
+	}
+
+	if holder := first.Holder(); holder != "" {
+		t.Errorf("Holder() of a free lock = %q", holder)
+	}
+}
+
+func TestMemoryBackendRunOrdering(t *testing.T) {
+	tests := []struct {
+		name       string
+		releases   [2]string
+		lockName   string
+		serialized bool
+	}{
+		{name: "same release", releases: [2]string{"app", "app"}, serialized: true},
+		{name: "shared lock name", releases: [2]string{"app", "api"}, lockName: "shared", serialized: true},
+		{name: "different releases", releases: [2]string{"app", "api"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the memory locks are shared by the process, the lock namespace keeps the cases apart
+			namespace := strings.ReplaceAll(tt.name, " ", "-")
+
+			out := &syncBuffer{}
+			events := make(chan string, 4)
+			release := make(chan struct{})
+			done := make(chan error, 2)
+
+			start := func(holder, releaseName string) {
+				client, actionConfig, err := loadFixture(writeFixture(t, deployedReleaseFixture), "default")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				opts := newTestOptions(out)
+				opts.lockBackend = lockBackendMemory
+				opts.identity = holder
+				opts.releaseName = releaseName
+				opts.helmArgs = []string{releaseName, "./chart"}
+				opts.lockName = tt.lockName
+				opts.executor = func(context.Context, *lockOptions, []string, io.Writer) error {
+					events <- holder + " started"
+					<-release
+					events <- holder + " finished"
+
+					return nil
+				}
+
+				lockName, err := resolveLockName(opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				go func() {
+					done <- acquireLockAndExecute(context.Background(), client, actionConfig, opts, lockName, namespace, &lockReport{started: time.Now()})
+				}()
+			}
+
+			start("first", tt.releases[0])
+
+			if event := <-events; event != "first started" {
+				t.Fatalf("event = %q, want first started", event)
+			}
+
+			start("second", tt.releases[1])
+
+			if tt.serialized {
+				waitForLog(t, out, "is held by 'first', waiting")
+
+				select {
+				case event := <-events:
+					t.Fatalf("event %q while the first run holds the lock", event)
+				default:
+				}
+			} else if event := <-events; event != "second started" {
+				t.Fatalf("event = %q, want second started while the first run holds its lock", event)
+			}
+
+			close(release)
+
+			for range 2 {
+				if err := <-done; err != nil {
+					t.Fatalf("acquireLockAndExecute() error = %v", err)
+				}
+			}
+
+			close(events)
+
+			var got []string
+			for event := range events {
+				got = append(got, event)
+			}
+
+			if tt.serialized {
+				want := []string{"first finished", "second started", "second finished"}
+				if strings.Join(got, ", ") != strings.Join(want, ", ") {
+					t.Errorf("events = %v, want %v", got, want)
+				}
+			} else if len(got) != 2 {
+				t.Errorf("events = %v, want both runs finished", got)
+			}
+		})
+	}
+}
+
+func TestMemoryBackendRollsBackBeforeHelm(t *testing.T) {
+	tests := []struct {
+		name       string
+		fixture    string
+		rollback   bool
+		decision   rollbackDecision
+		helmStatus release.Status
+	}{
+		{
+			name:       "failed release",
+			fixture:    failedReleaseFixture,
+			rollback:   true,
+			decision:   rollbackDecision{Status: "failed", Revisions: 2, Rollback: true, Target: 1, Policy: policyPreviousRevision},
+			helmStatus: release.StatusDeployed,
+		},
+		{
+			name:       "deployed release",
+			fixture:    deployedReleaseFixture,
+			decision:   rollbackDecision{Status: "deployed", Policy: policyDeployed},
+			helmStatus: release.StatusDeployed,
+		},
+		{
+			name:       "missing release",
+			fixture:    "releases: []\n",
+			decision:   rollbackDecision{Status: statusMissing, Policy: policyMissing},
+			helmStatus: release.StatusUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, actionConfig, err := loadFixture(writeFixture(t, tt.fixture), "default")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			opts := newTestOptions(io.Discard)
+			opts.lockBackend = lockBackendMemory
+
+			var helmStatus release.Status
+
+			// the status helm runs against shows whether the rollback finished first
+			opts.executor = func(context.Context, *lockOptions, []string, io.Writer) error {
+				helmStatus, _ = getReleaseStatus(actionConfig, "app")
+
+				return nil
+			}
+
+			report := &lockReport{started: time.Now()}
+
+			if err := acquireLockAndExecute(context.Background(), client, actionConfig, opts, "helm-lock-app", strings.ReplaceAll(tt.name, " ", "-"), report); err != nil {
+				t.Fatalf("acquireLockAndExecute() error = %v", err)
+			}
+
+			if report.rollback != tt.rollback {
+				t.Errorf("rollback = %v, want %v", report.rollback, tt.rollback)
+			}
+
+			if report.decision == nil || *report.decision != tt.decision {
+				t.Errorf("decision = %+v, want %+v", report.decision, tt.decision)
+			}
+
+			if helmStatus != tt.helmStatus {
+				t.Errorf("release status when helm ran = %q, want %q", helmStatus, tt.helmStatus)
+			}
+		})
+	}
+}
+
+func TestMemoryBackendStatusUnderLock(t *testing.T) {
+	// both runs start on the failed release, the second one reads the status after the rollback of the first
+	client, actionConfig, err := loadFixture(writeFixture(t, failedReleaseFixture), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &syncBuffer{}
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	tests := []struct {
+		holder   string
+		rollback bool
+		status   string
+	}{
+		{holder: "first", rollback: true, status: "failed"},
+		{holder: "second", status: "deployed"},
+	}
+
+	reports := make([]*lockReport, len(tests))
+	done := make(chan error, len(tests))
+
+	for i, tt := range tests {
+		opts := newTestOptions(out)
+		opts.lockBackend = lockBackendMemory
+		opts.identity = tt.holder
+		opts.executor = func(context.Context, *lockOptions, []string, io.Writer) error {
+			if tt.holder == "first" {
+				close(started)
+				<-release
+			}
+
+			return nil
+		}
+
+		reports[i] = &lockReport{started: time.Now()}
+
+		go func() {
+			done <- acquireLockAndExecute(context.Background(), client, actionConfig, opts, "helm-lock-app", t.Name(), reports[i])
+		}()
+
+		if i == 0 {
+			<-started
+		}
+	}
+
+	waitForLog(t, out, "is held by 'first', waiting")
+	close(release)
+
+	for range tests {
+		if err := <-done; err != nil {
+			t.Fatalf("acquireLockAndExecute() error = %v", err)
+		}
+	}
+
+	for i, tt := range tests {
+		report := reports[i]
+
+		if report.rollback != tt.rollback {
+			t.Errorf("%s run rollback = %v, want %v", tt.holder, report.rollback, tt.rollback)
+		}
+
+		if report.decision == nil || report.decision.Status != tt.status {
+			t.Errorf("%s run decision = %+v, want the status %s", tt.holder, report.decision, tt.status)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "helm-lock"
+)
+
+// Annotations with the outcome of the last operation, kept on the released lock
+const (
+	lastCommandAnnotation  = "helm-lock/last-command"
+	lastResultAnnotation   = "helm-lock/last-result"
+	lastHolderAnnotation   = "helm-lock/last-holder"
+	lastFinishedAnnotation = "helm-lock/last-finished"
+
+	lastOperationValueLimit = 256
+)
+
+// maxLifetimeAnnotation holds the longest time in seconds a holder keeps the lock, for external reapers
+const maxLifetimeAnnotation = "helm-lock/max-lifetime"
+
+// setMaxLifetime queues the max lifetime annotation written when the lock is acquired
+func setMaxLifetime(lock resourcelock.Interface, lifetime time.Duration) {
+	setLockAnnotation(lock, maxLifetimeAnnotation, strconv.FormatInt(int64(math.Ceil(lifetime.Seconds())), 10))
+}
+
+// pendingAnnotations holds annotations written to the lock object on its next update
+type pendingAnnotations struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// set queues an annotation for the next update
+func (p *pendingAnnotations) set(key, value string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.values == nil {
+		p.values = map[string]string{}
+	}
+
+	p.values[key] = value
+}
+
+// take returns the queued annotations and clears the queue
+func (p *pendingAnnotations) take() map[string]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	values := p.values
+	p.values = nil
+
+	return values
+}
+
+// annotatedLeaseLock is a LeaseLock that also sets annotations on the lease it creates
+type annotatedLeaseLock struct {
+	*resourcelock.LeaseLock
+	Annotations map[string]string
+	Owners      []metav1.OwnerReference
+	pending     pendingAnnotations
+	ownersSet   bool
+}
+
+var _ resourcelock.Interface = &annotatedLeaseLock{}
+
+// Create creates the lease with the labels, the annotations and the queued annotations
+func (l *annotatedLeaseLock) Create(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	annotations := maps.Clone(l.Annotations)
+	if pending := l.pending.take(); len(pending) > 0 {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+
+		maps.Copy(annotations, pending)
+	}
+
+	_, err := l.Client.Leases(l.LeaseMeta.Namespace).Create(ctx, &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            l.LeaseMeta.Name,
+			Namespace:       l.LeaseMeta.Namespace,
+			Labels:          l.Labels,
+			Annotations:     annotations,
+			OwnerReferences: l.Owners,
+		},
+		Spec: resourcelock.LeaderElectionRecordToLeaseSpec(&ler),
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	l.ownersSet = true
+
+	// Get caches the created lease, the next Update needs it
+	_, _, err = l.LeaseLock.Get(ctx)
+
+	return err
+}
+
+// Update renews the lease and writes the queued annotations, the first update of a holder also replaces
+// the owner references of a reused lease with its own
+func (l *annotatedLeaseLock) Update(ctx context.Context, ler resourcelock.LeaderElectionRecord) error {
+	if err := l.LeaseLock.Update(ctx, ler); err != nil {
+		return err
+	}
+
+	held := ler.HolderIdentity != "" && ler.HolderIdentity == l.Identity()
+	if !held {
+		l.ownersSet = false
+	}
+
+	metadata := map[string]any{}
+	if annotations := l.pending.take(); len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+
+	if held && !l.ownersSet {
+		metadata["ownerReferences"] = ownerReferencesPatch(l.Owners)
+	}
+
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]any{"metadata": metadata})
+	if err != nil {
+		return err
+	}
+
+	if _, err := l.Client.Leases(l.LeaseMeta.Namespace).Patch(ctx, l.LeaseMeta.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+
+	if held {
+		l.ownersSet = true
+	}
+
+	_, _, err = l.LeaseLock.Get(ctx)
+
+	return err
+}
+
+// ownerReferencesPatch returns the merge patch value of the owner references, null drops the owners
+// a previous holder left on the lock object
+func ownerReferencesPatch(owners []metav1.OwnerReference) any {
+	if len(owners) == 0 {
+		return nil
+	}
+
+	return owners
+}
+
+// setLockAnnotation queues an annotation written to the lock objects on the next renewal
+func setLockAnnotation(lock resourcelock.Interface, key, value string) {
+	switch l := lock.(type) {
+	case *annotatedLeaseLock:
+		l.pending.set(key, value)
+	case *ConfigMapLock:
+		l.pending.set(key, value)
+	case *resourcelock.MultiLock:
+		setLockAnnotation(l.Primary, key, value)
+		setLockAnnotation(l.Secondary, key, value)
+	}
+}
+
+// truncateValue bounds an annotation value to the limit in bytes
+func truncateValue(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+
+	return strings.ToValidUTF8(value[:limit-3], "") + "..."
+}
+
+// recordLastOperation patches the outcome of the operation into the annotations of the released lock
+// objects, the election record is not touched so the lock is not renewed
+func recordLastOperation(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, lockName, identity string, opErr error) {
+	result := "ok"
+	if opErr != nil {
+		result = "fail: " + opErr.Error()
+	}
+
+	command := strings.Join(append([]string{"helm", opts.helmCommand}, opts.helmArgs...), " ")
+
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": map[string]string{
+		lastCommandAnnotation:  truncateValue(command, lastOperationValueLimit),
+		lastResultAnnotation:   truncateValue(result, lastOperationValueLimit),
+		lastHolderAnnotation:   truncateValue(identity, lastOperationValueLimit),
+		lastFinishedAnnotation: formatTime(time.Now()),
+	}}})
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditTimeout)
+	defer cancel()
+
+	for _, lockType := range opts.lockTypes {
+		if lockType == lockTypeConfigMap {
+			_, err = client.CoreV1().ConfigMaps(namespace).Patch(ctx, lockName, types.MergePatchType, patch, metav1.PatchOptions{})
+		} else {
+			_, err = client.CoordinationV1().Leases(namespace).Patch(ctx, lockName, types.MergePatchType, patch, metav1.PatchOptions{})
+		}
+
+		if err != nil {
+			opts.logger.Printf("Warning: failed to record the last operation on the %s lock: %v", lockType, err)
+		}
+	}
+}
+
+// lockLabels returns the labels of a created lock object
+func lockLabels(opts *lockOptions) map[string]string {
+	labels := maps.Clone(opts.lockLabels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	labels[managedByLabel] = managedByValue
+
+	return labels
+}
+
+// holderAnnotationData is the context of the --holder-annotation-template
+type holderAnnotationData struct {
+	Release   string
+	Namespace string
+	Command   string
+	Holder    string
+	Timestamp string
+	Unix      int64
+}
+
+// renderHolderAnnotations renders the --holder-annotation-template into key=value lines,
+// empty lines are skipped and every key must be a valid annotation key not managed by helm-lock
+func renderHolderAnnotations(opts *lockOptions, namespace, releaseName, identity string) (map[string]string, error) {
+	tmpl, err := template.New("holder").Option("missingkey=error").Parse(opts.holderAnnotationTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --holder-annotation-template: %w", err)
+	}
+
+	now := time.Now()
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, holderAnnotationData{
+		Release:   releaseName,
+		Namespace: namespace,
+		Command:   opts.helmCommand,
+		Holder:    identity,
+		Timestamp: now.UTC().Format(time.RFC3339),
+		Unix:      now.Unix(),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to render --holder-annotation-template: %w", err)
+	}
+
+	annotations := map[string]string{}
+
+	for line := range strings.Lines(b.String()) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid --holder-annotation-template line '%s', must be key=value", line)
+		}
+
+		key = strings.TrimSpace(key)
+
+		if key == resourcelock.LeaderElectionRecordAnnotationKey || strings.HasPrefix(key, "helm-lock/") {
+			return nil, fmt.Errorf("invalid --holder-annotation-template key '%s', the annotation is managed by helm-lock", key)
+		}
+
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid --holder-annotation-template key '%s': %s", key, errs[0])
+		}
+
+		annotations[key] = strings.TrimSpace(value)
+	}
+
+	return annotations, nil
+}
+
+// setHolderAnnotations queues the rendered holder annotations, they are written when the lock is acquired
+func setHolderAnnotations(lock resourcelock.Interface, opts *lockOptions, namespace, releaseName, identity string) error {
+	if opts.holderAnnotationTemplate == "" {
+		return nil
+	}
+
+	annotations, err := renderHolderAnnotations(opts, namespace, releaseName, identity)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range annotations {
+		setLockAnnotation(lock, key, value)
+	}
+
+	return nil
+}
+
+// validateLockMeta checks the --lock-label and --lock-annotation values
+func validateLockMeta(labels, annotations map[string]string) error {
+	for key, value := range labels {
+		if key == managedByLabel {
+			return fmt.Errorf("invalid --lock-label '%s', the label is managed by helm-lock", key)
+		}
+
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid --lock-label key '%s': %s", key, errs[0])
+		}
+
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid --lock-label value '%s': %s", value, errs[0])
+		}
+	}
+
+	for key := range annotations {
+		if key == resourcelock.LeaderElectionRecordAnnotationKey {
+			return fmt.Errorf("invalid --lock-annotation '%s', the annotation is managed by helm-lock", key)
+		}
+
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid --lock-annotation key '%s': %s", key, errs[0])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+func TestValidateLockMeta(t *testing.T) {
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		wantErr     bool
+	}{
+		{name: "no metadata"},
+		{name: "valid metadata", labels: map[string]string{"team": "platform", "example.com/tier": "infra"}, annotations: map[string]string{"example.com/owner": "any value, with spaces"}},
+		{name: "managed-by label", labels: map[string]string{managedByLabel: "other"}, wantErr: true},
+		{name: "invalid label key", labels: map[string]string{"team/": "platform"}, wantErr: true},
+		{name: "invalid label value", labels: map[string]string{"team": "platform team"}, wantErr: true},
+		{name: "leader election annotation", annotations: map[string]string{resourcelock.LeaderElectionRecordAnnotationKey: "{}"}, wantErr: true},
+		{name: "invalid annotation key", annotations: map[string]string{"-owner": "platform"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateLockMeta(tt.labels, tt.annotations); (err != nil) != tt.wantErr {
+				t.Errorf("validateLockMeta() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreatedLockMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		lockType string
+	}{
+		{name: "lease", lockType: lockTypeLease},
+		{name: "configmap", lockType: lockTypeConfigMap},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset()
+
+			opts := newTestOptions(io.Discard)
+			opts.lockTypes = []string{tt.lockType}
+			opts.lockLabels = map[string]string{"team": "platform"}
+			opts.lockAnnotations = map[string]string{"example.com/owner": "platform"}
+
+			lock, err := newResourceLock(client, opts, "default", "helm-lock-app", "runner")
+			if err != nil {
+				t.Fatalf("newResourceLock() error = %v", err)
+			}
+
+			if err := lock.Create(context.Background(), resourcelock.LeaderElectionRecord{
+				HolderIdentity:       "runner",
+				LeaseDurationSeconds: 15,
+				AcquireTime:          metav1.NewTime(time.Now()),
+				RenewTime:            metav1.NewTime(time.Now()),
+			}); err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+
+			meta, err := lockObjectMeta(context.Background(), client, tt.lockType, "default", "helm-lock-app")
+			if err != nil {
+				t.Fatalf("failed to get the lock: %v", err)
+			}
+
+			wantLabels := map[string]string{"team": "platform", managedByLabel: managedByValue}
+			for key, value := range wantLabels {
+				if meta.Labels[key] != value {
+					t.Errorf("label %s = %q, want %q", key, meta.Labels[key], value)
+				}
+			}
+
+			if got := meta.Annotations["example.com/owner"]; got != "platform" {
+				t.Errorf("annotation example.com/owner = %q, want platform", got)
+			}
+
+			if opts.lockLabels[managedByLabel] != "" {
+				t.Errorf("the --lock-label values were changed: %v", opts.lockLabels)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// leaseExpiry returns the time until the lease expires without a renewal
+func leaseExpiry(lease *coordinationv1.Lease) time.Duration {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return 0
+	}
+
+	return time.Until(lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+// waitForLockRelease blocks while another holder keeps the lease, so the leader election
+// starts as soon as the lease is released, deleted or expired instead of on the next retry.
+// It returns right away when the lease is free or the watch is not permitted.
+func waitForLockRelease(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, lockName, identity string) {
+	leases := client.CoordinationV1().Leases(namespace)
+
+	lease, err := leases.Get(ctx, lockName, metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+
+	info := leaseLockInfo(lease)
+	if info.State != lockStateHeld || info.Holder == identity {
+		return
+	}
+
+	watcher, err := leases.Watch(ctx, metav1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", lockName).String(),
+		ResourceVersion: lease.ResourceVersion,
+	})
+	if err != nil {
+		opts.logger.Printf("Warning: cannot watch lock '%s', falling back to polling: %v", lockName, err)
+
+		return
+	}
+	defer watcher.Stop()
+
+	opts.logger.Printf("Lock '%s' is held by '%s', watching for its release", lockName, info.Holder)
+
+	expired := time.NewTimer(leaseExpiry(lease))
+	defer expired.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-expired.C:
+			return
+		case event, ok := <-watcher.ResultChan():
+			if !ok || event.Type == watch.Deleted || event.Type == watch.Error {
+				return
+			}
+
+			lease, ok := event.Object.(*coordinationv1.Lease)
+			if !ok || lease.Name != lockName {
+				continue
+			}
+
+			if leaseLockInfo(lease).State != lockStateHeld {
+				return
+			}
+
+			expired.Reset(leaseExpiry(lease))
+		}
+	}
+}
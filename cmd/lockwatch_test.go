@@ -0,0 +1,151 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestWaitForLockRelease(t *testing.T) {
+	// the leader election retry period, the latency of polling a released lock
+	const retryPeriod = 2 * time.Second
+
+	released := testLease("helm-lock-app", "", 0)
+	released.Spec.HolderIdentity = nil
+
+	tests := []struct {
+		name      string
+		holder    string
+		renewed   time.Duration
+		forbidden bool
+		events    []watch.Event
+		timeout   time.Duration
+		minWait   time.Duration
+		maxWait   time.Duration
+		wantLog   string
+	}{
+		{
+			name:    "free lock",
+			maxWait: 100 * time.Millisecond,
+		},
+		{
+			name:    "lock held by this identity",
+			holder:  "runner",
+			maxWait: 100 * time.Millisecond,
+		},
+		{
+			name:      "watch not permitted",
+			holder:    "other",
+			forbidden: true,
+			maxWait:   100 * time.Millisecond,
+			wantLog:   "falling back to polling",
+		},
+		{
+			name:    "released lock",
+			holder:  "other",
+			events:  []watch.Event{{Type: watch.Modified, Object: testLease("helm-lock-app", "other", 0)}, {Type: watch.Modified, Object: released}},
+			minWait: 100 * time.Millisecond,
+			maxWait: retryPeriod / 2,
+			wantLog: "watching for its release",
+		},
+		{
+			name:    "deleted lock",
+			holder:  "other",
+			events:  []watch.Event{{Type: watch.Deleted, Object: testLease("helm-lock-app", "other", 0)}},
+			minWait: 100 * time.Millisecond,
+			maxWait: retryPeriod / 2,
+		},
+		{
+			name:    "expired lock",
+			holder:  "other",
+			renewed: 14800 * time.Millisecond,
+			minWait: 100 * time.Millisecond,
+			maxWait: retryPeriod / 2,
+		},
+		{
+			name:    "still held lock",
+			holder:  "other",
+			timeout: 200 * time.Millisecond,
+			minWait: 200 * time.Millisecond,
+			maxWait: retryPeriod / 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.holder != "" {
+				objects = append(objects, testLease("helm-lock-app", tt.holder, tt.renewed))
+			}
+
+			client := fake.NewClientset(objects...)
+			watcher := watch.NewRaceFreeFake()
+
+			client.PrependWatchReactor("leases", func(k8stesting.Action) (bool, watch.Interface, error) {
+				if tt.forbidden {
+					return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}, "", errors.New("watch"))
+				}
+
+				return true, watcher, nil
+			})
+
+			// the events arrive after the wait started
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+
+				for _, event := range tt.events {
+					watcher.Action(event.Type, event.Object)
+				}
+			}()
+
+			timeout := tt.timeout
+			if timeout == 0 {
+				timeout = 10 * time.Second
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			var out bytes.Buffer
+
+			opts := newTestOptions(&out)
+			started := time.Now()
+
+			waitForLockRelease(ctx, client, opts, "default", "helm-lock-app", "runner")
+
+			if waited := time.Since(started); waited < tt.minWait || waited > tt.maxWait {
+				t.Errorf("waitForLockRelease() returned after %s, want between %s and %s", waited, tt.minWait, tt.maxWait)
+			}
+
+			if !strings.Contains(out.String(), tt.wantLog) {
+				t.Errorf("log has no %q:\n%s", tt.wantLog, out.String())
+			}
+		})
+	}
+}
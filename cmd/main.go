@@ -18,13 +18,24 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"go.opentelemetry.io/otel/trace/noop"
 
 	"helm.sh/helm/v3/pkg/cli"
+
+	"k8s.io/klog/v2"
 )
 
 const globalUsage = `This plugin manages Helm release locks using Kubernetes leader election.
@@ -33,16 +44,28 @@ if there's an active lock preventing deployment. If the lock has timed out,
 it performs a rollback operation. After it runs the specified Helm command.`
 
 // Run the main command for the helm-lock CLI application.
+// It keeps no global state, so it can be called several times in the same process.
 func Run() error {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	return run(context.Background(), os.Args[1:])
+}
+
+func run(ctx context.Context, args []string) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	args = joinDashValues(args)
 
 	opts := &lockOptions{
 		timeout:      defaultLockTimeout,
 		helmSettings: cli.New(),
-		helmFlags:    getAllFlags(),
+		logger:       log.New(os.Stderr, "", 0),
+		klogger:      klog.Background(),
+		tracer:       noop.NewTracerProvider().Tracer(tracerName),
 	}
 
+	lf := pflag.NewFlagSet("lock", pflag.ContinueOnError)
+	hf := pflag.NewFlagSet("helm", pflag.ContinueOnError)
+
 	cmd := &cobra.Command{
 		Use:   "lock [HELM_COMMAND] [ARGS...] [flags]",
 		Short: "Execute Helm commands with distributed locking",
@@ -50,26 +73,75 @@ func Run() error {
 		Example: strings.Join([]string{
 			"  helm lock secrets upgrade my-release ./my-chart",
 			"  helm lock upgrade my-release ./my-chart --lock-timeout 5m",
+			"  helm lock --lock-timeout 5m -- upgrade my-release ./my-chart --set x=y",
 		}, "\n"),
-		Args: cobra.MinimumNArgs(3),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			opts.helmCommand = args[0]
-			opts.helmArgs = args[1:]
+		Args: func(cmd *cobra.Command, args []string) error {
+			if opts.planInput != "" {
+				return cobra.NoArgs(cmd, args)
+			}
 
-			// debug run
-			if opts.helmCommand == "lock" {
-				opts.helmCommand = args[1]
-				opts.helmArgs = args[2:]
+			return cobra.MinimumNArgs(3)(cmd, args)
+		},
+		PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+			if err := setupConfig(opts, lf); err != nil {
+				return err
 			}
 
-			if n := len(opts.helmArgs); n > 0 {
-				if n > 2 {
-					n--
+			return setupKlog(opts)
+		},
+		RunE: func(cmd *cobra.Command, cmdArgs []string) error {
+			if err := opts.validate(); err != nil {
+				return err
+			}
+
+			if opts.releaseNamespace != "" {
+				if namespace := opts.helmSettings.Namespace(); namespace != opts.releaseNamespace {
+					opts.logger.Printf("Release namespace '%s' from --release-namespace overrides '%s'", opts.releaseNamespace, namespace)
 				}
 
-				opts.releaseName = opts.helmArgs[n-1]
+				opts.helmSettings.SetNamespace(opts.releaseNamespace)
 			}
 
+			opts.lockFlags = lf
+			opts.timeoutSet = cmd.Flags().Changed("lock-timeout")
+
+			if opts.planInput != "" {
+				if err := loadPlan(opts); err != nil {
+					return err
+				}
+
+				return runLockCommand(cmd.Context(), opts)
+			}
+
+			if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+				if dash > 0 {
+					return fmt.Errorf("unexpected arguments before --: %s", strings.Join(cmdArgs[:dash], " "))
+				}
+
+				if err := splitHelmArgs(opts, cmdArgs, getAllFlags(args[:slices.Index(args, "--")], lf, hf)); err != nil {
+					return err
+				}
+
+				return runLockCommand(cmd.Context(), opts)
+			}
+
+			opts.helmFlags = getAllFlags(args, lf, hf)
+			opts.helmCommand = cmdArgs[0]
+			opts.helmArgs = cmdArgs[1:]
+
+			// debug run
+			if opts.helmCommand == "lock" {
+				opts.helmCommand = cmdArgs[1]
+				opts.helmArgs = cmdArgs[2:]
+			}
+
+			releaseName, err := ResolveReleaseName(opts.helmCommand, append(slices.Clone(opts.helmArgs), opts.helmFlags...))
+			if err != nil {
+				return err
+			}
+
+			opts.releaseName = releaseName
+
 			return runLockCommand(cmd.Context(), opts)
 		},
 		FParseErrWhitelist: cobra.FParseErrWhitelist{
@@ -80,11 +152,132 @@ func Run() error {
 	}
 
 	cmd.SetHelpCommand(&cobra.Command{}) // Disable the help command
+	cmd.CompletionOptions.DisableDefaultCmd = true
+	cmd.AddCommand(
+		newStatusCommand(opts),
+		newWaitCommand(opts),
+		newLocksCommand(opts),
+		newReleaseCommand(opts),
+		newObserveCommand(opts),
+		newMigrateCommand(opts),
+		newHoldCommand(opts),
+		newShellCommand(opts),
+		newConfigCommand(lf),
+	)
+
+	lf.DurationVar(&opts.timeout, "lock-timeout", defaultLockTimeout, "Lock timeout duration")
+	lf.StringVar(&opts.deadlineValue, "deadline", "", "Absolute RFC3339 time the run must finish by, the earlier of it and --lock-timeout applies")
+	lf.StringVar(&opts.onMissingRelease, "on-missing-release", missingReleaseProceed, "Policy when the release does not exist: proceed or fail, install and upgrade --install always proceed")
+	lf.StringVar(&opts.configFile, "config", "", "Config file with helm-lock options (default: "+defaultConfigFile+" when it exists)")
+	lf.StringVar(&opts.fixture, "fixture", "", "Read release and lock state from a YAML fixture and echo the helm command instead of running it")
+	lf.StringVar(&opts.planOutput, "plan-output", "", "Write the release status, the rollback decision and the helm command to this JSON file without locking or running helm")
+	lf.StringVar(&opts.planInput, "plan-input", "", "Run the helm command of a --plan-output file under the lock")
+	lf.BoolVar(&opts.allowPlanDrift, "allow-plan-drift", false, "Run a --plan-input plan even when the release changed since the plan was written")
+	lf.StringVar(&opts.auditConfigMap, "audit-configmap", "", "Append an audit record of the operation to this ConfigMap in the lock namespace")
+	lf.IntVar(&opts.auditMaxEntries, "audit-max-entries", defaultAuditMaxEntries, "Maximum number of records kept in the audit ConfigMap")
+	lf.StringVar(&opts.failedInstallAction, "failed-install-action", failedInstallSkip, "Action for a failed release without a previous revision: skip the rollback or fail")
+	lf.StringVar(&opts.timeoutSignalName, "timeout-signal", "SIGTERM", "Signal sent to the helm command when the operation times out")
+	lf.DurationVar(&opts.termGrace, "term-grace", defaultTermGrace, "Time to wait after the timeout signal before killing the helm command")
+	lf.StringVar(&opts.acquireWebhook, "acquire-webhook", "", "URL notified with a POST after the lock is acquired, the operation proceeds only on a 2xx response")
+	lf.DurationVar(&opts.acquireWebhookTimeout, "acquire-webhook-timeout", defaultWebhookTimeout, "Timeout for the acquire webhook response")
+	lf.StringVar(&opts.rollbackWebhook, "rollback-webhook", "", "URL asked with a POST before an automatic rollback, the rollback runs only on a 2xx response")
+	lf.DurationVar(&opts.rollbackWebhookTimeout, "rollback-webhook-timeout", defaultWebhookTimeout, "Timeout for the rollback webhook response")
+	lf.StringVar(&opts.onRelease, "on-release", "", "Shell command run after the lock is released or lost, with the HELM_LOCK_* context variables")
+	lf.BoolVar(&opts.noDowngrade, "no-downgrade", false, "Refuse to deploy a chart version lower than the deployed one")
+	lf.StringSliceVar(&opts.lockTypes, "lock-type", []string{lockTypeLease}, "Lock object types, lease and/or configmap, both are held together during a backend migration")
+	lf.StringVar(&opts.successMessage, "success-message", "", "Template printed to stdout when the operation succeeds")
+	lf.StringVar(&opts.failureMessage, "failure-message", "", "Template printed to stdout when the operation fails")
+	lf.BoolVar(&opts.recordLastOperation, "record-last-operation", false, "Keep the command, result, holder and finish time of the last operation on the released lock")
+	lf.DurationVar(&opts.renewJitter, "renew-jitter", 0, "Random offset up to this duration applied to the lock renew deadline and retry period, at most 3s")
+	lf.StringVar(&opts.releaseNamespace, "release-namespace", "", "Namespace of the release for the release checks and the helm command, overrides -n and HELM_NAMESPACE")
+	lf.BoolVar(&opts.verifyTarget, "verify-target", false, "Run helm status with the forwarded flags under the lock and warn when helm sees another release or namespace")
+	lf.BoolVar(&opts.strictHelmVersion, "strict-helm-version", false, "Fail when the helm binary is not a supported helm 3 version instead of warning")
+	lf.BoolVar(&opts.skipHelmVersionCheck, "skip-helm-version-check", false, "Do not check the version of the helm binary")
+	lf.BoolVar(&opts.dumpLease, "dump-lease", false, "Print the acquired lease object as YAML to stderr for debugging")
+	lf.BoolVar(&opts.sharedReads, "shared-reads", false, "Run read only commands as shared readers of the lock, a writer waits for the readers to finish")
+	lf.BoolVar(&opts.strictSerialize, "strict-serialize", false, "Record the operation state on the lock and refuse an uninstall while an upgrade has not settled, and the reverse")
+	lf.StringVar(&opts.summaryJSON, "summary-json", "", "Write a JSON summary of the run to the file, also on failure")
+	lf.BoolVar(&opts.emitSummaryLine, "emit-summary-line", false, "Print a final helm-lock: held=... waited=... rollback=... result=... line to stderr")
+	lf.IntVar(&opts.execRetries, "exec-retries", 0, "Number of helm command retries on a transient failure")
+	lf.BoolVar(&opts.lockDependencies, "lock-dependencies", false, "Also lock the releases of the chart dependencies from Chart.yaml")
+	lf.StringVar(&opts.dependencyReleaseName, "dependency-release-name", defaultDependencyReleaseName, "Template of the release name of a dependency, with .Release, .Name and .Chart")
+	lf.StringVar(&opts.injectHolderLabel, "inject-holder-label", "", "Chart value key set to the lock holder identity with --set-string on install and upgrade")
+	lf.BoolVar(&opts.preRenderCheck, "pre-render-check", false, "Render the chart with helm template and the same flags before requesting the lock")
+	lf.BoolVar(&opts.assumeYes, "assume-yes", false, "Run helm with stdin on the null device, so a prompt gets end of file instead of waiting while the lock is held, no helm flag or environment variable is added")
+	lf.DurationVar(&opts.promptTimeout, "prompt-timeout", 0, "Stop helm when its output ends with an unfinished line and stays silent this long, it looks like a prompt")
+	lf.BoolVar(&opts.dieWithParent, "die-with-parent", false, "Stop helm and release the lock when the parent process of helm-lock exits, helm runs in its own process group")
+	lf.StringVar(&opts.childOutput, "child-output", childOutputSeparate, "Output of the helm child: separate keeps stdout and stderr apart, combined sends both to stdout")
+	lf.BoolVar(&opts.mergeStderr, "merge-stderr", false, "Send the helm child stderr to stdout, same as --child-output combined")
+	lf.StringSliceVar(&opts.exitCodeMap, "exit-code-map", nil, "Exit with CODE when the helm error output matches, CATEGORY=CODE or SUBSTRING=CODE, can be repeated")
+	lf.StringSliceVar(&opts.execRetryOn, "exec-retry-on", nil, "Retry the helm command when its error output contains this substring, can be repeated")
+	lf.BoolVar(&opts.auditFlags, "audit-flags", false, "Log the forwarded helm flags with secret-looking --set values redacted")
+	lf.StringVar(&opts.identity, "identity", "", "Lock holder identity (default: POD_NAME/<command> in a pod, generated otherwise)")
+	lf.BoolVar(&opts.breakDeadHolder, "break-dead-holder", false, "Record the holder process on the lease and release a lease whose holder process on this host is gone")
+	lf.StringVar(&opts.ownerRef, "owner-ref", "", "Owner of the created lock objects as kind/name (pod, job or namespace), or auto for the pod of the downward API")
+	lf.BoolVar(&opts.allowIdentityReuse, "allow-identity-reuse", false, "Take over a held lock with the same --identity instead of failing")
+	lf.BoolVar(&opts.skipPermissionCheck, "skip-permission-check", false, "Skip the preflight check of the get, create and update permissions on the lock objects")
+	lf.BoolVar(&opts.silenceKlog, "silence-klog", false, "Discard the Kubernetes client log output")
+	lf.StringVar(&opts.klogFile, "klog-file", "", "Write the Kubernetes client log output to this file instead of stderr")
+	lf.DurationVar(&opts.lockAndExit, "lock-and-exit", 0, "Acquire the lock with this TTL and exit without running helm, the lock expires unless released")
+	lf.BoolVar(&opts.lockDiff, "lock-diff", false, "Hold the lock for helm diff commands, which run without the lock by default")
+	lf.BoolVar(&opts.skipNoOp, "skip-no-op", false, "Skip an upgrade when the values and chart version match the deployed release")
+	lf.StringVar(&opts.onlyIfChanged, "only-if-changed", "", "Skip an upgrade when the value at this dotted path, like image.tag, matches the deployed release")
+	lf.StringToStringVar(&opts.lockLabels, "lock-label", nil, "Label key=value set on the created lock object, can be repeated")
+	lf.StringVar(&opts.holderAnnotationTemplate, "holder-annotation-template", "", "Template of key=value lines written as annotations to the acquired lock, for tools reading the holder")
+	lf.StringToStringVar(&opts.lockAnnotations, "lock-annotation", nil, "Annotation key=value set on the created lock object, can be repeated")
+	lf.BoolVar(&opts.rollbackAsync, "rollback-async", false, "Submit the rollback without waiting and release the lock without running the helm command")
+	lf.StringSliceVar(&opts.noRollbackMatch, "no-rollback-match", nil, "Glob of release names never rolled back automatically, can be repeated")
+	lf.BoolVar(&opts.rollbackToLastGood, "rollback-to-last-good", false, "Roll back to the most recent deployed revision, skipping consecutive failed revisions")
+	lf.StringVar(&opts.rollbackToAnnotated, "rollback-to-annotated", "", "Roll back to the most recent revision with this key or key=value release label or chart annotation")
+	lf.BoolVar(&opts.rollbackProgress, "rollback-progress", false, "Log how many resources of the release are ready while a rollback waits")
+	lf.DurationVar(&opts.pollInterval, "poll-interval", defaultPollInterval, "Interval of the --rollback-progress checks")
+	lf.IntVar(&opts.rollbackMaxHistory, "rollback-max-history", 0, "Prune the release history down to this many revisions after a rollback (0 keeps the history)")
+	lf.DurationVar(&opts.postRollbackDelay, "post-rollback-delay", 0, "Time to wait after a rollback before running the helm command, under the lock")
+	lf.IntVar(&opts.rollbackLimit, "rollback-limit", 0, "Maximum number of automatic rollbacks within --rollback-limit-window, 0 means unlimited")
+	lf.DurationVar(&opts.rollbackLimitWindow, "rollback-limit-window", defaultRollbackLimitWindow, "Time window of --rollback-limit")
+	lf.StringVar(&opts.rollbackLimitNamespace, "rollback-limit-namespace", "", "Namespace of the shared rollback counter, kept in the lock cluster (default: the lock namespace with --lock-kube-context, the release namespace otherwise)")
+	lf.IntVar(&opts.namespaceConcurrency, "namespace-concurrency", 0, "Maximum number of concurrent helm-lock operations in the namespace, 0 means unlimited")
+	lf.BoolVar(&opts.strictStatus, "strict-status", false, "Fail when the status of an existing release cannot be determined instead of proceeding")
+	lf.IntVar(&opts.connectRetries, "connect-retries", 0, "Number of retries with exponential backoff when the cluster is not reachable at startup")
+	lf.Float32Var(&opts.kubeQPS, "kube-qps", 0, "Kubernetes API QPS of the helm-lock clients, not forwarded to helm (default: helm --qps)")
+	lf.IntVar(&opts.kubeBurst, "kube-burst", 0, "Kubernetes API burst of the helm-lock clients, not forwarded to helm (default: helm --burst-limit)")
+	lf.BoolVar(&opts.watchLock, "watch-lock", false, "Watch a held lease to acquire it as soon as it is released instead of polling")
+	lf.StringVar(&opts.lockBackend, "lock-backend", lockBackendKubernetes, "Lock backend: kubernetes, file for a host local lock without a cluster, or http for a remote lock service")
+	lf.StringVar(&opts.lockDir, "lock-dir", filepath.Join(os.TempDir(), "helm-lock"), "Directory of the file lock backend lock files")
+	lf.StringVar(&opts.lockEndpoint, "lock-endpoint", "", "Base URL of the remote lock service of the http lock backend")
+	lf.StringVar(&opts.lockName, "lock-name", "", "Lock name shared by several releases (default: the chart helm-lock/shared-lock annotation or the release name)")
+	lf.BoolVar(&opts.noLock, "no-lock", false, "Emergency bypass: run helm without the lock, the status check and the rollback, requires --reason")
+	lf.StringVar(&opts.reason, "reason", "", "Reason of a --no-lock run, recorded in an Event and the audit record")
+	lf.StringVar(&opts.window, "window", "", "Deploy window, a cron expression or [DAYS] HH:MM-HH:MM, helm waits under the lock until it opens")
+	lf.BoolVar(&opts.windowFailOutside, "window-fail-outside", false, "Fail right away outside of --window instead of waiting")
+	lf.StringVar(&opts.minKubeVersion, "min-kube-version", "", "Fail when the lock cluster is older than this kubernetes version, e.g. 1.27")
+	lf.StringVar(&opts.lockKubeContext, "lock-kube-context", "", "Kubeconfig context of the cluster holding the lock objects (default: the helm --kube-context)")
+	lf.StringVar(&opts.lockNamespace, "lock-namespace", "", "Namespace of the lock objects (default: the release namespace)")
+	lf.BoolVar(&opts.createLockNamespace, "create-lock-namespace", false, "Create the lock namespace when it does not exist")
+	lf.StringToStringVar(&opts.lockNamespaceLabels, "lock-namespace-label", nil, "Label key=value of a namespace created with --create-lock-namespace, can be repeated")
+	lf.StringToStringVar(&opts.lockNamespaceAnnotations, "lock-namespace-annotation", nil, "Annotation key=value of a namespace created with --create-lock-namespace, can be repeated")
+	lf.BoolVar(&opts.allowCrossNamespaceLock, "allow-cross-namespace-lock", false, "Allow a --lock-namespace different from the release namespace")
+	lf.StringSliceVar(&opts.assertStatus, "assert-status", nil, "Release statuses accepted under the lock before anything runs, comma separated, missing for a release that does not exist")
+	lf.BoolVar(&opts.requireDeployed, "require-deployed", false, "Fail an upgrade of a release that is not deployed instead of rolling it back")
+	lf.BoolVar(&opts.failAfterRollback, "fail-after-rollback", false, "Exit with code 3 when the command succeeded after an automatic rollback")
+
+	cmd.PersistentFlags().AddFlag(lf.Lookup("config"))
+	cmd.PersistentFlags().AddFlag(lf.Lookup("fixture"))
+	cmd.PersistentFlags().AddFlag(lf.Lookup("silence-klog"))
+	cmd.PersistentFlags().AddFlag(lf.Lookup("klog-file"))
+	cmd.PersistentFlags().AddFlag(lf.Lookup("lock-type"))
+	cmd.PersistentFlags().AddFlag(lf.Lookup("lock-namespace"))
+	cmd.PersistentFlags().AddFlag(lf.Lookup("lock-name"))
+	cmd.PersistentFlags().AddFlag(lf.Lookup("lock-kube-context"))
+	cmd.PersistentFlags().AddFlag(lf.Lookup("renew-jitter"))
 
 	f := cmd.Flags()
-	f.DurationVar(&opts.timeout, "lock-timeout", defaultLockTimeout, "Lock timeout duration")
+	f.AddFlagSet(lf)
+
+	opts.helmSettings.AddFlags(hf)
+	cmd.PersistentFlags().AddFlagSet(hf)
 
-	opts.helmSettings.AddFlags(f)
+	cmd.SetArgs(args)
 
 	err := cmd.ExecuteContext(ctx)
 	if err != nil {
@@ -93,6 +286,11 @@ func Run() error {
 			fmt.Fprintf(os.Stderr, "Error: %s\n\n", errorString)
 			fmt.Fprintln(os.Stderr, cmd.UsageString())
 		}
+
+		var codeError *Error
+		if errors.As(err, &codeError) && codeError.Code == ExitCodeReleaseCheck {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", errorString)
+		}
 	}
 
 	return err
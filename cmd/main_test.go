@@ -0,0 +1,128 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRunConcurrent(t *testing.T) {
+	runs := []struct {
+		release  string
+		fixture  string
+		rollback bool
+	}{
+		{release: "app", fixture: writeFixture(t, failedReleaseFixture), rollback: true},
+		{release: "api", fixture: writeFixture(t, deployedReleaseFixture)},
+	}
+
+	const copies = 4
+
+	flags, prefix := log.Flags(), log.Prefix()
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+
+	errs := make([]error, len(runs)*copies)
+
+	for i := range errs {
+		r := runs[i%len(runs)]
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			errs[i] = run(context.Background(), []string{
+				"upgrade", r.release, "./chart",
+				"--fixture", r.fixture,
+				"--identity", fmt.Sprintf("runner-%d", i),
+				"--summary-json", filepath.Join(dir, fmt.Sprintf("summary-%d.json", i)),
+				"--silence-klog",
+			})
+		}()
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		r := runs[i%len(runs)]
+
+		if err != nil {
+			t.Errorf("run %d of %s error = %v", i, r.release, err)
+
+			continue
+		}
+
+		summary := readSummary(t, filepath.Join(dir, fmt.Sprintf("summary-%d.json", i)))
+		if summary.Release != r.release || summary.Holder != fmt.Sprintf("runner-%d", i) || summary.Rollback != r.rollback {
+			t.Errorf("run %d summary release=%q holder=%q rollback=%v, want %s, runner-%d, %v", i, summary.Release, summary.Holder, summary.Rollback, r.release, i, r.rollback)
+		}
+	}
+
+	if log.Flags() != flags || log.Prefix() != prefix {
+		t.Errorf("run changed the standard logger flags=%d prefix=%q", log.Flags(), log.Prefix())
+	}
+}
+
+func TestRunReleaseCheckExitCode(t *testing.T) {
+	undetermined := `releases:
+- name: app
+  revision: 1
+  status: unknown
+`
+
+	tests := []struct {
+		name     string
+		fixture  string
+		args     []string
+		wantCode int
+	}{
+		{name: "missing release proceeds", fixture: "releases: []\n", args: []string{"rollback", "app", "1"}},
+		{name: "missing release with --on-missing-release fail", fixture: "releases: []\n", args: []string{"rollback", "app", "1", "--on-missing-release", "fail"}, wantCode: ExitCodeReleaseCheck},
+		{name: "missing release installed", fixture: "releases: []\n", args: []string{"upgrade", "app", "./chart", "--install", "--on-missing-release", "fail"}},
+		{name: "failed release with --require-deployed", fixture: failedReleaseFixture, args: []string{"upgrade", "app", "./chart", "--require-deployed"}, wantCode: ExitCodeReleaseCheck},
+		{name: "failed release with --assert-status", fixture: failedReleaseFixture, args: []string{"upgrade", "app", "./chart", "--assert-status", "deployed"}, wantCode: ExitCodeReleaseCheck},
+		{name: "failed release passes --assert-status", fixture: failedReleaseFixture, args: []string{"upgrade", "app", "./chart", "--assert-status", "failed"}},
+		{name: "undetermined status with --strict-status", fixture: undetermined, args: []string{"upgrade", "app", "./chart", "--strict-status"}, wantCode: ExitCodeReleaseCheck},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := run(context.Background(), append(tt.args, "--fixture", writeFixture(t, tt.fixture), "--silence-klog"))
+
+			if tt.wantCode == 0 {
+				if err != nil {
+					t.Fatalf("run() error = %v", err)
+				}
+
+				return
+			}
+
+			var codeError *Error
+			if !errors.As(err, &codeError) || codeError.Code != tt.wantCode {
+				t.Errorf("run() error = %v, want exit code %d", err, tt.wantCode)
+			}
+		})
+	}
+}
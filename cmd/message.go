@@ -0,0 +1,192 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// messageData is the context for the success and failure message templates
+type messageData struct {
+	Release   string
+	Namespace string
+	Command   string
+	Holder    string
+	Rollback  bool
+	Duration  time.Duration
+	Error     string
+}
+
+// parseMessage parses the message template, an empty template gives nil
+func parseMessage(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	return template.New("message").Option("missingkey=error").Parse(text)
+}
+
+// printMessage renders the success or failure message to stdout
+func printMessage(opts *lockOptions, report *lockReport) {
+	text := opts.successMessage
+	if report.err != nil {
+		text = opts.failureMessage
+	}
+
+	tmpl, err := parseMessage(text)
+	if err != nil || tmpl == nil {
+		return
+	}
+
+	data := messageData{
+		Release:   opts.releaseName,
+		Namespace: opts.helmSettings.Namespace(),
+		Command:   opts.helmCommand,
+		Holder:    report.holder,
+		Rollback:  report.rollback,
+		Duration:  time.Since(report.started).Round(time.Second),
+	}
+
+	if report.err != nil {
+		data.Error = report.err.Error()
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		opts.logger.Printf("Warning: failed to render message: %v", err)
+
+		return
+	}
+
+	fmt.Fprintln(os.Stdout, strings.TrimRight(b.String(), "\n"))
+}
+
+// durations returns how long the run waited for the lock and held it
+func (r *lockReport) durations() (waited, held time.Duration) {
+	switch {
+	case !r.acquired.IsZero():
+		waited = r.acquired.Sub(r.waitStarted)
+	case !r.waitStarted.IsZero():
+		waited = time.Since(r.waitStarted)
+	}
+
+	if !r.acquired.IsZero() {
+		finished := r.finished
+		if finished.IsZero() {
+			finished = time.Now()
+		}
+
+		held = finished.Sub(r.acquired)
+	}
+
+	return waited, held
+}
+
+// result returns ok or fail
+func (r *lockReport) result() string {
+	if r.err != nil {
+		return "fail"
+	}
+
+	return "ok"
+}
+
+// printSummaryLine prints the single line run summary for CI log parsing, the format is stable
+func printSummaryLine(opts *lockOptions, report *lockReport) {
+	waited, held := report.durations()
+	result := report.result()
+
+	opts.logger.Printf("helm-lock: held=%s waited=%s rollback=%t result=%s",
+		held.Round(time.Millisecond), waited.Round(time.Millisecond), report.rollback, result)
+}
+
+// printLockTimeout prints a single parseable line when the lock is not acquired in time
+func printLockTimeout(opts *lockOptions, lockName, namespace, holder string, waitStarted time.Time) {
+	if holder == "" {
+		holder = "-"
+	}
+
+	opts.logger.Printf("helm-lock: lock-timeout lock=%s namespace=%s holder=%s waited=%s timeout=%s",
+		lockName, namespace, holder, time.Since(waitStarted).Round(time.Millisecond), opts.timeout)
+}
+
+// runSummary is the --summary-json artifact of a run
+type runSummary struct {
+	Release   string  `json:"release"`
+	Namespace string  `json:"namespace"`
+	Command   string  `json:"command"`
+	Holder    string  `json:"holder,omitempty"`
+	Waited    float64 `json:"waitedSeconds"`
+	Held      float64 `json:"heldSeconds"`
+	Rollback  bool    `json:"rollback"`
+	HelmExit  *int    `json:"helmExitCode"`
+	Result    string  `json:"result"`
+	Error     string  `json:"error,omitempty"`
+
+	Decision *rollbackDecision `json:"rollbackDecision,omitempty"`
+}
+
+// writeSummaryJSON writes the run summary to the --summary-json file, the helm exit code is
+// null when helm did not run or its exit status is not known
+func writeSummaryJSON(opts *lockOptions, report *lockReport) {
+	waited, held := report.durations()
+
+	summary := runSummary{
+		Release:   opts.releaseName,
+		Namespace: opts.helmSettings.Namespace(),
+		Command:   opts.helmCommand,
+		Holder:    report.holder,
+		Waited:    waited.Seconds(),
+		Held:      held.Seconds(),
+		Rollback:  report.rollback,
+		Result:    report.result(),
+		Decision:  report.decision,
+	}
+
+	var exitErr *exec.ExitError
+
+	switch {
+	case errors.As(report.err, &exitErr):
+		code := exitErr.ExitCode()
+		summary.HelmExit = &code
+	case report.err == nil && report.currentPhase() == phaseHelm:
+		code := 0
+		summary.HelmExit = &code
+	}
+
+	if report.err != nil {
+		summary.Error = report.err.Error()
+	}
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		opts.logger.Printf("Warning: failed to encode the run summary: %v", err)
+
+		return
+	}
+
+	if err := os.WriteFile(opts.summaryJSON, append(data, '\n'), 0o644); err != nil {
+		opts.logger.Printf("Warning: failed to write the run summary: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// migrateOptions are the flags of the migrate subcommand
+type migrateOptions struct {
+	from         string
+	to           string
+	force        bool
+	deleteSource bool
+}
+
+// lockObjectMeta reads the labels and annotations of the lock object of the type
+func lockObjectMeta(ctx context.Context, client kubernetes.Interface, lockType, namespace, lockName string) (metav1.ObjectMeta, error) {
+	if lockType == lockTypeConfigMap {
+		cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, lockName, metav1.GetOptions{})
+		if err != nil {
+			return metav1.ObjectMeta{}, err
+		}
+
+		return cm.ObjectMeta, nil
+	}
+
+	lease, err := client.CoordinationV1().Leases(namespace).Get(ctx, lockName, metav1.GetOptions{})
+	if err != nil {
+		return metav1.ObjectMeta{}, err
+	}
+
+	return lease.ObjectMeta, nil
+}
+
+// deleteLockObject deletes the lock object of the type
+func deleteLockObject(ctx context.Context, client kubernetes.Interface, lockType, namespace, lockName string) error {
+	if lockType == lockTypeConfigMap {
+		return client.CoreV1().ConfigMaps(namespace).Delete(ctx, lockName, metav1.DeleteOptions{})
+	}
+
+	return client.CoordinationV1().Leases(namespace).Delete(ctx, lockName, metav1.DeleteOptions{})
+}
+
+// migrateLock copies the election record, labels and annotations of the lock to another lock type,
+// it returns false when there is no source lock
+func migrateLock(ctx context.Context, client kubernetes.Interface, mo *migrateOptions, namespace, lockName string) (bool, error) {
+	meta, err := lockObjectMeta(ctx, client, mo.from, namespace, lockName)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to get %s lock: %w", mo.from, err)
+	}
+
+	source := newTypedLock(client, mo.from, metav1.ObjectMeta{Namespace: namespace, Name: lockName}, "")
+
+	record, _, err := source.Get(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get %s lock: %w", mo.from, err)
+	}
+
+	expires := record.RenewTime.Add(time.Duration(record.LeaseDurationSeconds) * time.Second)
+	if record.HolderIdentity != "" && time.Now().Before(expires) && !mo.force {
+		return false, fmt.Errorf("lock '%s' is held by '%s', use --force to migrate it", lockName, record.HolderIdentity)
+	}
+
+	annotations := maps.Clone(meta.Annotations)
+	delete(annotations, resourcelock.LeaderElectionRecordAnnotationKey)
+
+	target := newTypedLock(client, mo.to, metav1.ObjectMeta{
+		Namespace:   namespace,
+		Name:        lockName,
+		Labels:      meta.Labels,
+		Annotations: annotations,
+	}, record.HolderIdentity)
+
+	_, _, err = target.Get(ctx)
+
+	switch {
+	case apierrors.IsNotFound(err):
+		err = target.Create(ctx, *record)
+	case err == nil:
+		for key, value := range annotations {
+			setLockAnnotation(target, key, value)
+		}
+
+		err = target.Update(ctx, *record)
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to write %s lock: %w", mo.to, err)
+	}
+
+	if mo.deleteSource {
+		if err := deleteLockObject(ctx, client, mo.from, namespace, lockName); err != nil && !apierrors.IsNotFound(err) {
+			return true, fmt.Errorf("failed to delete %s lock: %w", mo.from, err)
+		}
+	}
+
+	return true, nil
+}
+
+// migrateLocks migrates the locks of the releases, releases that share a lock migrate it once
+func migrateLocks(ctx context.Context, client kubernetes.Interface, opts *lockOptions, mo *migrateOptions, releaseNames []string, out io.Writer) error {
+	namespace := opts.lockNamespaceName()
+	migrated := map[string]bool{}
+
+	for _, releaseName := range releaseNames {
+		lockName, err := releaseLockName(opts, releaseName)
+		if err != nil {
+			return err
+		}
+
+		if migrated[lockName] {
+			continue
+		}
+
+		migrated[lockName] = true
+
+		ok, err := migrateLock(ctx, client, mo, namespace, lockName)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			fmt.Fprintf(out, "Lock '%s' has no %s, skipped\n", lockName, mo.from)
+
+			continue
+		}
+
+		fmt.Fprintf(out, "Migrated lock '%s' from %s to %s\n", lockName, mo.from, mo.to)
+	}
+
+	return nil
+}
+
+func newMigrateCommand(opts *lockOptions) *cobra.Command {
+	mo := &migrateOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "migrate RELEASE...",
+		Short: "Copy the locks of the releases to another lock type",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, lockType := range []string{mo.from, mo.to} {
+				if !slices.Contains(lockTypes, lockType) {
+					return fmt.Errorf("invalid lock type '%s', must be one of: %s", lockType, strings.Join(lockTypes, ", "))
+				}
+			}
+
+			if mo.from == mo.to {
+				return fmt.Errorf("--from and --to must be different lock types")
+			}
+
+			clientset, _, err := newClients(opts)
+			if err != nil {
+				return err
+			}
+
+			return migrateLocks(cmd.Context(), clientset, opts, mo, args, os.Stdout)
+		},
+	}
+
+	cmd.Flags().StringVar(&mo.from, "from", lockTypeLease, "Lock type to copy from")
+	cmd.Flags().StringVar(&mo.to, "to", lockTypeConfigMap, "Lock type to copy to")
+	cmd.Flags().BoolVar(&mo.force, "force", false, "Migrate a lock that is actively held")
+	cmd.Flags().BoolVar(&mo.deleteSource, "delete-source", false, "Delete the source lock object after the copy")
+
+	return cmd
+}
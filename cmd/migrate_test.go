@@ -0,0 +1,118 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+func TestMigrateLocks(t *testing.T) {
+	tests := []struct {
+		name         string
+		lockName     string
+		releases     []string
+		force        bool
+		deleteSource bool
+		want         map[string]string
+		wantSkipped  []string
+		wantErr      bool
+	}{
+		{
+			name:        "release locks",
+			releases:    []string{"app", "web"},
+			want:        map[string]string{"helm-lock-app": "other"},
+			wantSkipped: []string{"helm-lock-web"},
+		},
+		{
+			name:     "shared lock",
+			lockName: "platform",
+			releases: []string{"app", "api"},
+			want:     map[string]string{"helm-lock-platform": "runner"},
+		},
+		{
+			name:     "held lock",
+			releases: []string{"api"},
+			wantErr:  true,
+		},
+		{
+			name:         "held lock with force",
+			releases:     []string{"api"},
+			force:        true,
+			deleteSource: true,
+			want:         map[string]string{"helm-lock-api": "runner"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset(
+				testLease("helm-lock-app", "other", time.Minute),
+				testLease("helm-lock-api", "runner", 0),
+				testLease("helm-lock-platform", "runner", time.Minute),
+			)
+
+			opts := newTestOptions(io.Discard)
+			opts.lockNamespace = "default"
+			opts.lockName = tt.lockName
+
+			mo := &migrateOptions{from: lockTypeLease, to: lockTypeConfigMap, force: tt.force, deleteSource: tt.deleteSource}
+
+			var out bytes.Buffer
+
+			err := migrateLocks(context.Background(), client, opts, mo, tt.releases, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("migrateLocks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			for lockName, holder := range tt.want {
+				if n := strings.Count(out.String(), "Migrated lock '"+lockName+"'"); n != 1 {
+					t.Errorf("lock %s was migrated %d times:\n%s", lockName, n, out.String())
+				}
+
+				cm, err := client.CoreV1().ConfigMaps("default").Get(context.Background(), lockName, metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("failed to get the migrated lock: %v", err)
+				}
+
+				if record := cm.Annotations[resourcelock.LeaderElectionRecordAnnotationKey]; !strings.Contains(record, `"holderIdentity":"`+holder+`"`) {
+					t.Errorf("migrated lock %s record = %s, want the holder %s", lockName, record, holder)
+				}
+
+				_, err = client.CoordinationV1().Leases("default").Get(context.Background(), lockName, metav1.GetOptions{})
+				if tt.deleteSource != apierrors.IsNotFound(err) {
+					t.Errorf("source lock %s get error = %v, deleted %v", lockName, err, tt.deleteSource)
+				}
+			}
+
+			for _, lockName := range tt.wantSkipped {
+				if !strings.Contains(out.String(), "Lock '"+lockName+"' has no lease, skipped") {
+					t.Errorf("migrate output has no skipped %s:\n%s", lockName, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// recordBypass creates a warning Event on the lock for a run with --no-lock
+func recordBypass(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, lockName, holder string) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditTimeout)
+	defer cancel()
+
+	now := metav1.NewTime(time.Now())
+
+	_, err := client.CoreV1().Events(namespace).Create(ctx, &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: lockName + ".",
+			Namespace:    namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: coordinationv1.SchemeGroupVersion.String(),
+			Kind:       "Lease",
+			Namespace:  namespace,
+			Name:       lockName,
+		},
+		Type:           corev1.EventTypeWarning,
+		Reason:         "LockBypassed",
+		Message:        fmt.Sprintf("helm %s of release '%s' ran without the lock by '%s': %s", opts.helmCommand, opts.releaseName, holder, opts.reason),
+		Source:         corev1.EventSource{Component: managedByValue},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}, metav1.CreateOptions{})
+
+	return err
+}
+
+// runWithoutLock runs the helm command without the lock, the status check and the rollback,
+// the bypass is recorded as an Event and in the audit ConfigMap
+func runWithoutLock(ctx context.Context, client kubernetes.Interface, opts *lockOptions, lockName string, report *lockReport) error {
+	namespace := opts.lockNamespaceName()
+	report.holder = lockIdentity(opts, namespace)
+
+	opts.logger.Printf("WARNING: running helm %s for release '%s' WITHOUT the lock, reason: %s", opts.helmCommand, opts.releaseName, opts.reason)
+	opts.logger.Printf("WARNING: concurrent runs are not serialized and no rollback is performed")
+
+	if err := recordBypass(ctx, client, opts, namespace, lockName, report.holder); err != nil {
+		opts.logger.Printf("Warning: failed to record the lock bypass event: %v", err)
+	}
+
+	report.setPhase(phaseHelm)
+	report.err = executeHelmCommand(ctx, opts)
+
+	if opts.auditConfigMap != "" {
+		if err := auditOperation(ctx, client, opts, namespace, report); err != nil {
+			opts.logger.Printf("Warning: %v", err)
+		}
+	}
+
+	return report.err
+}
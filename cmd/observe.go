@@ -0,0 +1,139 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/pkg/action"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// observeLock watches the lease and prints holder changes, renewals and release status changes
+func observeLock(ctx context.Context, client kubernetes.Interface, actionConfig *action.Configuration, namespace, lockName, releaseName string, out io.Writer) error {
+	info, err := getLockInfo(ctx, client, lockTypeLease, namespace, lockName)
+	if err != nil {
+		return fmt.Errorf("failed to get lock: %w", err)
+	}
+
+	if info.State != lockStateHeld {
+		fmt.Fprintf(out, "Lock '%s' is %s\n", lockName, info.State)
+
+		return nil
+	}
+
+	releaseStatus, _ := getReleaseStatus(actionConfig, releaseName)
+
+	printObserved(out, "lock held by '%s', release %s", info.Holder, releaseStatus)
+
+	watcher, err := client.CoordinationV1().Leases(namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", lockName).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch lock: %w", err)
+	}
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("lock '%s' is still held by '%s': %w", lockName, info.Holder, ctx.Err())
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return fmt.Errorf("watch of lock '%s' closed", lockName)
+			}
+
+			if event.Type == watch.Deleted {
+				printObserved(out, "lock deleted")
+
+				return nil
+			}
+
+			lease, ok := event.Object.(*coordinationv1.Lease)
+			if !ok {
+				continue
+			}
+
+			current := leaseLockInfo(lease)
+
+			switch {
+			case current.State != lockStateHeld:
+				printObserved(out, "lock released by '%s'", info.Holder)
+
+				return nil
+			case current.Holder != info.Holder:
+				printObserved(out, "lock holder changed from '%s' to '%s'", info.Holder, current.Holder)
+			case !current.Renewed.Equal(info.Renewed):
+				printObserved(out, "lock renewed by '%s'", current.Holder)
+			}
+
+			info = current
+
+			if status, err := getReleaseStatus(actionConfig, releaseName); err == nil && status != releaseStatus {
+				printObserved(out, "release status changed from %s to %s", releaseStatus, status)
+
+				releaseStatus = status
+			}
+		}
+	}
+}
+
+// printObserved prints a timestamped observation line
+func printObserved(out io.Writer, format string, a ...any) {
+	fmt.Fprintf(out, "%s %s\n", time.Now().UTC().Format(time.RFC3339), fmt.Sprintf(format, a...))
+}
+
+func newObserveCommand(opts *lockOptions) *cobra.Command {
+	timeout := defaultLockTimeout
+
+	cmd := &cobra.Command{
+		Use:   "observe RELEASE",
+		Short: "Watch the lock of another run until it is released",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			clientset, actionConfig, err := newClients(opts)
+			if err != nil {
+				return err
+			}
+
+			lockName, err := releaseLockName(opts, args[0])
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+
+			return observeLock(ctx, clientset, actionConfig, opts.lockNamespaceName(), lockName, args[0], os.Stdout)
+		},
+	}
+
+	cmd.Flags().DurationVar(&timeout, "lock-timeout", defaultLockTimeout, "Maximum time to observe the lock")
+
+	return cmd
+}
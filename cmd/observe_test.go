@@ -0,0 +1,123 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestObserveLock(t *testing.T) {
+	_, actionConfig, err := loadFixture(writeFixture(t, failedReleaseFixture), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	released := testLease("helm-lock-app", "", 0)
+	released.Spec.HolderIdentity = nil
+
+	tests := []struct {
+		name     string
+		lockName string
+		lease    *coordinationv1.Lease
+		events   []watch.Event
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "free lock",
+			lockName: "helm-lock-app",
+			want:     []string{"Lock 'helm-lock-app' is free"},
+		},
+		{
+			name:     "released lock",
+			lockName: "helm-lock-app",
+			lease:    testLease("helm-lock-app", "runner", time.Second),
+			events: []watch.Event{
+				{Type: watch.Modified, Object: testLease("helm-lock-app", "runner", 0)},
+				{Type: watch.Modified, Object: testLease("helm-lock-app", "next", 0)},
+				{Type: watch.Modified, Object: released},
+			},
+			want: []string{
+				"lock held by 'runner', release failed",
+				"lock renewed by 'runner'",
+				"lock holder changed from 'runner' to 'next'",
+				"lock released by 'next'",
+			},
+		},
+		{
+			name:     "deleted shared lock",
+			lockName: "helm-lock-shared",
+			lease:    testLease("helm-lock-shared", "runner", 0),
+			events:   []watch.Event{{Type: watch.Deleted, Object: testLease("helm-lock-shared", "runner", 0)}},
+			want:     []string{"lock held by 'runner'", "lock deleted"},
+		},
+		{
+			name:     "still held lock",
+			lockName: "helm-lock-app",
+			lease:    testLease("helm-lock-app", "runner", 0),
+			want:     []string{"lock held by 'runner'"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.lease != nil {
+				objects = append(objects, tt.lease)
+			}
+
+			watcher := watch.NewFakeWithChanSize(len(tt.events), false)
+			for _, event := range tt.events {
+				watcher.Action(event.Type, event.Object)
+			}
+
+			client := readOnlyClientset(t, objects...)
+			client.PrependWatchReactor("leases", k8stesting.DefaultWatchReactor(watcher, nil))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			var out bytes.Buffer
+
+			err := observeLock(ctx, client, actionConfig, "default", tt.lockName, "app", &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("observeLock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("observeLock() error = %v, want %v", err, context.DeadlineExceeded)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("observe output has no %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
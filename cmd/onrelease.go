@@ -0,0 +1,65 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const onReleaseTimeout = 30 * time.Second
+
+// Reasons passed to the --on-release command
+const (
+	releaseReasonReleased = "released"
+	releaseReasonLost     = "lost"
+)
+
+// runOnRelease runs the --on-release command after the lock is released or lost,
+// a failure is only logged because the lock is already gone
+func runOnRelease(opts *lockOptions, namespace, lockName, identity, reason string) {
+	if reason == releaseReasonLost {
+		opts.logger.Printf("Warning: lost lock '%s' before the %s operation completed", lockName, opts.helmCommand)
+	} else {
+		opts.logger.Printf("Released lock '%s'", lockName)
+	}
+
+	if opts.onRelease == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), onReleaseTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", opts.onRelease)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"HELM_LOCK_RELEASE="+opts.releaseName,
+		"HELM_LOCK_NAMESPACE="+namespace,
+		"HELM_LOCK_NAME="+lockName,
+		"HELM_LOCK_HOLDER="+identity,
+		"HELM_LOCK_COMMAND="+opts.helmCommand,
+		"HELM_LOCK_REASON="+reason,
+	)
+
+	if err := cmd.Run(); err != nil {
+		opts.logger.Printf("Warning: --on-release command failed: %v", err)
+	}
+}
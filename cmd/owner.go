@@ -0,0 +1,85 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ownerRefAuto takes the pod of the downward API as the owner
+const ownerRefAuto = "auto"
+
+// resolveOwnerRef looks up the --owner-ref object, namespaced owners must live in the lock namespace
+// because Kubernetes ignores owner references across namespaces
+func resolveOwnerRef(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace string) (*metav1.OwnerReference, error) {
+	ref := opts.ownerRef
+	if ref == ownerRefAuto {
+		pod := os.Getenv("POD_NAME")
+		if pod == "" {
+			return nil, fmt.Errorf("--owner-ref auto needs the POD_NAME variable from the downward API")
+		}
+
+		if podNamespace := os.Getenv("POD_NAMESPACE"); podNamespace != "" && podNamespace != namespace {
+			return nil, fmt.Errorf("--owner-ref auto: pod namespace '%s' differs from the lock namespace '%s'", podNamespace, namespace)
+		}
+
+		ref = "pod/" + pod
+	}
+
+	kind, name, found := strings.Cut(ref, "/")
+	if !found || name == "" {
+		return nil, fmt.Errorf("invalid --owner-ref '%s', must be kind/name", opts.ownerRef)
+	}
+
+	var (
+		owner      metav1.Object
+		apiVersion string
+		err        error
+	)
+
+	switch strings.ToLower(kind) {
+	case "pod":
+		kind, apiVersion = "Pod", "v1"
+		owner, err = client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "job":
+		kind, apiVersion = "Job", "batch/v1"
+		owner, err = client.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "namespace":
+		// a cluster-scoped owner is valid for objects in any namespace
+		kind, apiVersion = "Namespace", "v1"
+		owner, err = client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	default:
+		return nil, fmt.Errorf("invalid --owner-ref kind '%s', must be one of: pod, job, namespace", kind)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get owner %s: %w", ref, err)
+	}
+
+	return &metav1.OwnerReference{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Name:       name,
+		UID:        owner.GetUID(),
+	}, nil
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+func TestResolveOwnerRef(t *testing.T) {
+	client := fake.NewClientset(
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "deploy", UID: "job-uid"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "runner", UID: "pod-uid"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps", UID: "ns-uid"}},
+	)
+
+	tests := []struct {
+		name    string
+		ref     string
+		podName string
+		want    *metav1.OwnerReference
+		wantErr bool
+	}{
+		{
+			name: "job",
+			ref:  "job/deploy",
+			want: &metav1.OwnerReference{APIVersion: "batch/v1", Kind: "Job", Name: "deploy", UID: "job-uid"},
+		},
+		{
+			name: "kind is case insensitive",
+			ref:  "Pod/runner",
+			want: &metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: "runner", UID: "pod-uid"},
+		},
+		{
+			name: "cluster-scoped namespace",
+			ref:  "namespace/apps",
+			want: &metav1.OwnerReference{APIVersion: "v1", Kind: "Namespace", Name: "apps", UID: "ns-uid"},
+		},
+		{
+			name:    "auto takes the pod",
+			ref:     ownerRefAuto,
+			podName: "runner",
+			want:    &metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: "runner", UID: "pod-uid"},
+		},
+		{
+			name:    "auto without POD_NAME",
+			ref:     ownerRefAuto,
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			ref:     "job/",
+			wantErr: true,
+		},
+		{
+			name:    "unknown kind",
+			ref:     "deployment/web",
+			wantErr: true,
+		},
+		{
+			name:    "missing owner",
+			ref:     "job/other",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POD_NAME", tt.podName)
+			t.Setenv("POD_NAMESPACE", "")
+
+			got, err := resolveOwnerRef(context.Background(), client, &lockOptions{ownerRef: tt.ref}, "default")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveOwnerRef() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveOwnerRef() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// lockOwners returns the owner references of the lock object of the type
+func lockOwners(t *testing.T, client kubernetes.Interface, lockType string) []metav1.OwnerReference {
+	t.Helper()
+
+	var (
+		obj metav1.Object
+		err error
+	)
+
+	if lockType == lockTypeConfigMap {
+		obj, err = client.CoreV1().ConfigMaps("default").Get(context.Background(), "helm-lock-app", metav1.GetOptions{})
+	} else {
+		obj, err = client.CoordinationV1().Leases("default").Get(context.Background(), "helm-lock-app", metav1.GetOptions{})
+	}
+
+	if err != nil {
+		t.Fatalf("failed to get the lock object: %v", err)
+	}
+
+	return obj.GetOwnerReferences()
+}
+
+func TestLockOwnerReferences(t *testing.T) {
+	stale := metav1.OwnerReference{APIVersion: "batch/v1", Kind: "Job", Name: "old", UID: "old-uid"}
+	owner := metav1.OwnerReference{APIVersion: "batch/v1", Kind: "Job", Name: "new", UID: "new-uid"}
+
+	released, _ := json.Marshal(resourcelock.LeaderElectionRecord{})
+	existing := metav1.ObjectMeta{
+		Namespace:       "default",
+		Name:            "helm-lock-app",
+		OwnerReferences: []metav1.OwnerReference{stale},
+		Annotations:     map[string]string{resourcelock.LeaderElectionRecordAnnotationKey: string(released)},
+	}
+
+	tests := []struct {
+		name     string
+		lockType string
+		existing bool
+		owners   []metav1.OwnerReference
+		want     []metav1.OwnerReference
+	}{
+		{name: "lease created with the owner", lockType: lockTypeLease, owners: []metav1.OwnerReference{owner}, want: []metav1.OwnerReference{owner}},
+		{name: "lease reused replaces the owner", lockType: lockTypeLease, existing: true, owners: []metav1.OwnerReference{owner}, want: []metav1.OwnerReference{owner}},
+		{name: "lease reused without an owner drops the owner", lockType: lockTypeLease, existing: true},
+		{name: "configmap created with the owner", lockType: lockTypeConfigMap, owners: []metav1.OwnerReference{owner}, want: []metav1.OwnerReference{owner}},
+		{name: "configmap reused replaces the owner", lockType: lockTypeConfigMap, existing: true, owners: []metav1.OwnerReference{owner}, want: []metav1.OwnerReference{owner}},
+		{name: "configmap reused without an owner drops the owner", lockType: lockTypeConfigMap, existing: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset()
+
+			if tt.existing {
+				if tt.lockType == lockTypeConfigMap {
+					_, _ = client.CoreV1().ConfigMaps("default").Create(context.Background(), &corev1.ConfigMap{ObjectMeta: existing}, metav1.CreateOptions{})
+				} else {
+					_, _ = client.CoordinationV1().Leases("default").Create(context.Background(), &coordinationv1.Lease{ObjectMeta: existing}, metav1.CreateOptions{})
+				}
+			}
+
+			lock := newTypedLock(client, tt.lockType, metav1.ObjectMeta{Namespace: "default", Name: "helm-lock-app", OwnerReferences: tt.owners}, "holder")
+			record := resourcelock.LeaderElectionRecord{
+				HolderIdentity:       "holder",
+				LeaseDurationSeconds: 15,
+				AcquireTime:          metav1.NewTime(time.Now()),
+				RenewTime:            metav1.NewTime(time.Now()),
+			}
+
+			ctx := context.Background()
+
+			if tt.existing {
+				if _, _, err := lock.Get(ctx); err != nil {
+					t.Fatalf("Get() error = %v", err)
+				}
+
+				if err := lock.Update(ctx, record); err != nil {
+					t.Fatalf("Update() error = %v", err)
+				}
+			} else if err := lock.Create(ctx, record); err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+
+			// a renewal keeps the owners
+			if err := lock.Update(ctx, record); err != nil {
+				t.Fatalf("Update() error = %v", err)
+			}
+
+			if got := lockOwners(t, client, tt.lockType); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("owner references = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+const parentPollInterval = time.Second
+
+// errParentExited is the cause of the canceled run when the parent of helm-lock is gone
+var errParentExited = errors.New("the parent process of helm-lock exited")
+
+// watchParent returns a context canceled with errParentExited when the parent process changes,
+// an orphaned process is adopted by init or a subreaper and gets a new parent
+func watchParent(ctx context.Context, opts *lockOptions) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	parent := os.Getppid()
+	if parent == 1 {
+		opts.logger.Printf("Warning: the parent of helm-lock is init, --die-with-parent cannot detect its exit")
+	}
+
+	go func() {
+		ticker := time.NewTicker(parentPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if os.Getppid() != parent {
+					opts.logger.Printf("Parent process %d exited, stopping the operation and releasing the lock", parent)
+					cancel(errParentExited)
+
+					return
+				}
+			}
+		}
+	}()
+
+	return ctx, func() { cancel(nil) }
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// lockPlan is the decision written by --plan-output and executed by --plan-input
+type lockPlan struct {
+	Release        string    `json:"release"`
+	Namespace      string    `json:"namespace"`
+	LockName       string    `json:"lockName"`
+	LockNamespace  string    `json:"lockNamespace"`
+	Status         string    `json:"status"`
+	RollbackNeeded bool      `json:"rollbackNeeded"`
+	Command        string    `json:"command"`
+	Args           []string  `json:"args"`
+	Flags          []string  `json:"flags,omitempty"`
+	StateHash      string    `json:"stateHash"`
+	Created        time.Time `json:"created"`
+}
+
+// releaseState is the part of the latest release revision a plan depends on
+type releaseState struct {
+	Revision     int    `json:"revision"`
+	Status       string `json:"status"`
+	Chart        string `json:"chart"`
+	ChartVersion string `json:"chartVersion"`
+}
+
+// releaseStateHash returns a hash of the latest release revision, a missing release has its own hash
+func releaseStateHash(actionConfig *action.Configuration, releaseName string) (string, error) {
+	var state releaseState
+
+	rel, err := actionConfig.Releases.Last(releaseName)
+
+	switch {
+	case errors.Is(err, driver.ErrReleaseNotFound):
+	case err != nil:
+		return "", fmt.Errorf("failed to get release: %w", err)
+	default:
+		state.Revision = rel.Version
+
+		if rel.Info != nil {
+			state.Status = rel.Info.Status.String()
+		}
+
+		if rel.Chart != nil && rel.Chart.Metadata != nil {
+			state.Chart = rel.Chart.Metadata.Name
+			state.ChartVersion = rel.Chart.Metadata.Version
+		}
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// checkPlanDrift refuses to run the plan when the release changed since the plan was written
+func checkPlanDrift(actionConfig *action.Configuration, opts *lockOptions) error {
+	hash, err := releaseStateHash(actionConfig, opts.releaseName)
+	if err != nil {
+		return err
+	}
+
+	if hash == opts.plan.StateHash {
+		return nil
+	}
+
+	if opts.allowPlanDrift {
+		opts.logger.Printf("Warning: release '%s' changed since the plan was written, proceeding with --allow-plan-drift", opts.releaseName)
+
+		return nil
+	}
+
+	return fmt.Errorf("release '%s' changed since the plan was written (status was '%s'), write a new plan or use --allow-plan-drift", opts.releaseName, opts.plan.Status)
+}
+
+// writePlan checks the release without the lock and writes the decision to the --plan-output file
+func writePlan(actionConfig *action.Configuration, opts *lockOptions, lockName string) error {
+	releaseStatus, err := checkReleaseStatus(actionConfig, opts)
+	if err != nil {
+		return err
+	}
+
+	hash, err := releaseStateHash(actionConfig, opts.releaseName)
+	if err != nil {
+		return err
+	}
+
+	plan := lockPlan{
+		Release:        opts.releaseName,
+		Namespace:      opts.helmSettings.Namespace(),
+		LockName:       lockName,
+		LockNamespace:  opts.lockNamespaceName(),
+		Status:         releaseStatus.String(),
+		RollbackNeeded: releaseStatus != release.StatusDeployed && releaseStatus != release.StatusUnknown,
+		Command:        opts.helmCommand,
+		Args:           opts.helmArgs,
+		Flags:          opts.helmFlags,
+		StateHash:      hash,
+		Created:        time.Now().UTC(),
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// the flags may carry --set secrets
+	if err := os.WriteFile(opts.planOutput, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+
+	opts.logger.Printf("Wrote plan for release '%s' to %s, release status is '%s', rollback needed: %t", plan.Release, opts.planOutput, plan.Status, plan.RollbackNeeded)
+
+	return nil
+}
+
+// loadPlan reads the --plan-input file and takes the helm command from it
+func loadPlan(opts *lockOptions) error {
+	data, err := os.ReadFile(opts.planInput)
+	if err != nil {
+		return fmt.Errorf("failed to read plan: %w", err)
+	}
+
+	var plan lockPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return fmt.Errorf("failed to parse plan %s: %w", opts.planInput, err)
+	}
+
+	if plan.Release == "" || plan.Command == "" {
+		return fmt.Errorf("plan %s has no release or helm command", opts.planInput)
+	}
+
+	if plan.Namespace != opts.helmSettings.Namespace() {
+		return fmt.Errorf("plan %s is for namespace '%s', not '%s'", opts.planInput, plan.Namespace, opts.helmSettings.Namespace())
+	}
+
+	opts.releaseName = plan.Release
+	opts.helmCommand = plan.Command
+	opts.helmArgs = plan.Args
+	opts.helmFlags = plan.Flags
+
+	opts.plan = &plan
+
+	opts.logger.Printf("Executing plan %s created at %s", opts.planInput, formatTime(plan.Created))
+
+	return nil
+}
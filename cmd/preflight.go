@@ -0,0 +1,130 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/kubernetes"
+)
+
+// lockVerbs are the verbs the leader election needs to create, renew and release the lock
+var lockVerbs = []string{"get", "create", "update"}
+
+// checkLockPermissions verifies that the lock objects can be created and also renewed, without the
+// update verb the lease would be created and then silently lost while helm runs.
+// A cluster that cannot answer the access review is only reported.
+func checkLockPermissions(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, lockName string) error {
+	var denied []string
+
+	for _, lockType := range opts.lockTypes {
+		group, resource := "coordination.k8s.io", "leases"
+		if lockType == lockTypeConfigMap {
+			group, resource = "", "configmaps"
+		}
+
+		for _, verb := range lockVerbs {
+			review, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Namespace: namespace,
+						Verb:      verb,
+						Group:     group,
+						Resource:  resource,
+						Name:      lockName,
+					},
+				},
+			}, metav1.CreateOptions{})
+			if err != nil {
+				opts.logger.Printf("Warning: cannot verify the lock permissions: %v", err)
+
+				return nil
+			}
+
+			if !review.Status.Allowed {
+				denied = append(denied, verb+" "+resource)
+			}
+		}
+	}
+
+	if len(denied) > 0 {
+		return fmt.Errorf("missing permissions for lock '%s' in namespace '%s': %s", lockName, namespace, strings.Join(denied, ", "))
+	}
+
+	return nil
+}
+
+// checkKubeVersion fails when the lock cluster is older than the minimum version
+func checkKubeVersion(client kubernetes.Interface, minVersion string) error {
+	minimum, err := version.ParseGeneric(minVersion)
+	if err != nil {
+		return fmt.Errorf("invalid --min-kube-version value '%s': %w", minVersion, err)
+	}
+
+	info, err := client.Discovery().ServerVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get the kubernetes version: %w", err)
+	}
+
+	current, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return fmt.Errorf("failed to parse the kubernetes version '%s': %w", info.GitVersion, err)
+	}
+
+	if current.LessThan(minimum) {
+		return fmt.Errorf("kubernetes version %s is older than --min-kube-version %s", info.GitVersion, minVersion)
+	}
+
+	return nil
+}
+
+// ensureLockNamespace creates the lock namespace with the labels and annotations when it does not exist
+func ensureLockNamespace(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace string) error {
+	if _, err := client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{}); err == nil {
+		return nil
+	} else if !apierrors.IsNotFound(err) && !apierrors.IsForbidden(err) {
+		return fmt.Errorf("failed to get lock namespace '%s': %w", namespace, err)
+	}
+
+	_, err := client.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        namespace,
+			Labels:      opts.lockNamespaceLabels,
+			Annotations: opts.lockNamespaceAnnotations,
+		},
+	}, metav1.CreateOptions{})
+
+	switch {
+	case err == nil:
+		opts.logger.Printf("Created lock namespace '%s'", namespace)
+
+		return nil
+	case apierrors.IsAlreadyExists(err):
+		return nil
+	case apierrors.IsForbidden(err):
+		return fmt.Errorf("cannot create lock namespace '%s', the create verb on namespaces is not granted: %w", namespace, err)
+	default:
+		return fmt.Errorf("failed to create lock namespace '%s': %w", namespace, err)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestEnsureLockNamespace(t *testing.T) {
+	namespaces := schema.GroupResource{Resource: "namespaces"}
+
+	tests := []struct {
+		name        string
+		existing    bool
+		getErr      error
+		createErr   error
+		wantCreated bool
+		wantLabels  map[string]string
+		wantErr     string
+	}{
+		{name: "existing namespace", existing: true, wantLabels: map[string]string{"owner": "infra"}},
+		{name: "missing namespace", wantCreated: true, wantLabels: map[string]string{"team": "platform"}},
+		{name: "get forbidden", getErr: apierrors.NewForbidden(namespaces, "locks", errors.New("get")), wantCreated: true, wantLabels: map[string]string{"team": "platform"}},
+		{name: "created by another run", createErr: apierrors.NewAlreadyExists(namespaces, "locks")},
+		{name: "create forbidden", createErr: apierrors.NewForbidden(namespaces, "locks", errors.New("create")), wantErr: "the create verb on namespaces is not granted"},
+		{name: "get error", getErr: apierrors.NewServiceUnavailable("down"), wantErr: "failed to get lock namespace 'locks'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.existing {
+				objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "locks", Labels: map[string]string{"owner": "infra"}}})
+			}
+
+			client := fake.NewClientset(objects...)
+			client.PrependReactor("get", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+				return tt.getErr != nil, nil, tt.getErr
+			})
+			client.PrependReactor("create", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+				return tt.createErr != nil, nil, tt.createErr
+			})
+
+			var out bytes.Buffer
+
+			opts := newTestOptions(&out)
+			opts.lockNamespaceLabels = map[string]string{"team": "platform"}
+			opts.lockNamespaceAnnotations = map[string]string{"example.com/owner": "platform"}
+
+			err := ensureLockNamespace(context.Background(), client, opts, "locks")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ensureLockNamespace() error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ensureLockNamespace() error = %v", err)
+			}
+
+			if created := strings.Contains(out.String(), "Created lock namespace 'locks'"); created != tt.wantCreated {
+				t.Errorf("namespace created = %v, want %v:\n%s", created, tt.wantCreated, out.String())
+			}
+
+			if tt.wantLabels == nil {
+				return
+			}
+
+			ns, err := client.Tracker().Get(corev1.SchemeGroupVersion.WithResource("namespaces"), "", "locks")
+			if err != nil {
+				t.Fatalf("failed to get the namespace: %v", err)
+			}
+
+			if labels := ns.(*corev1.Namespace).Labels; !maps.Equal(labels, tt.wantLabels) {
+				t.Errorf("namespace labels = %v, want %v", labels, tt.wantLabels)
+			}
+
+			if tt.wantCreated && ns.(*corev1.Namespace).Annotations["example.com/owner"] != "platform" {
+				t.Errorf("namespace annotations = %v, want the --lock-namespace-annotation", ns.(*corev1.Namespace).Annotations)
+			}
+		})
+	}
+}
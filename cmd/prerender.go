@@ -0,0 +1,105 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// templateSkipFlags are upgrade flags helm template does not accept, true when the flag takes a value
+var templateSkipFlags = map[string]bool{
+	"--install":         false,
+	"-i":                false,
+	"--cleanup-on-fail": false,
+	"--force":           false,
+	"--reset-values":    false,
+	"--history-max":     true,
+}
+
+// templateFlags returns the helm flags without the ones helm template does not accept
+func templateFlags(flags []string) []string {
+	result := make([]string, 0, len(flags))
+
+	for i := 0; i < len(flags); i++ {
+		name, _, found := strings.Cut(flags[i], "=")
+
+		withValue, skip := templateSkipFlags[name]
+		if !skip {
+			result = append(result, flags[i])
+
+			continue
+		}
+
+		if withValue && !found && i+1 < len(flags) && !strings.HasPrefix(flags[i+1], "-") {
+			i++
+		}
+	}
+
+	return result
+}
+
+// preRenderCheck renders the chart with helm template and the flags of the real command, so a chart
+// that does not render fails before the lock is requested
+func preRenderCheck(ctx context.Context, opts *lockOptions) error {
+	verb := opts.helmVerb()
+	if verb != "install" && verb != "upgrade" {
+		return nil
+	}
+
+	if hasFlag(opts.helmFlags, "--reuse-values", "--reset-then-reuse-values") {
+		opts.logger.Printf("Warning: skipping --pre-render-check, helm template cannot reuse the values of the deployed release")
+
+		return nil
+	}
+
+	args := []string{"template"}
+
+	if opts.helmCommand == verb {
+		args = append(args, opts.helmArgs...)
+	} else {
+		// a plugin prefix like secrets stays in front of the verb
+		args = append([]string{opts.helmCommand, "template"}, opts.helmArgs[slices.Index(opts.helmArgs, verb)+1:]...)
+	}
+
+	args = append(args, templateFlags(opts.helmFlags)...)
+
+	executor := renderHelm
+	if opts.fixture != "" {
+		executor = echoHelmCommand
+	}
+
+	opts.logger.Printf("Checking that the chart renders with helm template")
+
+	if err := executor(ctx, opts, args, os.Stderr); err != nil {
+		// the helm error is already on stderr, an exit error is not printed again
+		opts.logger.Printf("Chart does not render, the lock was not requested")
+
+		return fmt.Errorf("chart does not render: %w", err)
+	}
+
+	return nil
+}
+
+// renderHelm runs helm like runHelm with the rendered manifests discarded
+func renderHelm(ctx context.Context, opts *lockOptions, args []string, stderr io.Writer) error {
+	return execHelm(ctx, opts, args, io.Discard, stderr)
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// States of a --rollback-async rollback
+const (
+	asyncRollbackPending    = "pending"
+	asyncRollbackDeployed   = "deployed"
+	asyncRollbackFailed     = "failed"
+	asyncRollbackSuperseded = "superseded"
+)
+
+// asyncRollback is the progress of a --rollback-async rollback, kept in the rollback annotation of the lock
+type asyncRollback struct {
+	Target    int    `json:"targetRevision"`
+	Revision  int    `json:"revision"`
+	State     string `json:"state"`
+	Ready     int    `json:"ready"`
+	Resources int    `json:"resources"`
+	Submitted string `json:"submitted"`
+	Updated   string `json:"updated"`
+}
+
+// String describes the rollback for helm lock status
+func (r *asyncRollback) String() string {
+	return fmt.Sprintf("%s, revision %d rolls back to %d, %d of %d resources ready, submitted %s, updated %s",
+		r.State, r.Revision, r.Target, r.Ready, r.Resources, r.Submitted, r.Updated)
+}
+
+// parseAsyncRollback decodes the rollback annotation, nil when there is none
+func parseAsyncRollback(value string) (*asyncRollback, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	rollback := &asyncRollback{}
+	if err := json.Unmarshal([]byte(value), rollback); err != nil {
+		return nil, fmt.Errorf("invalid '%s' annotation: %w", rollbackAnnotation, err)
+	}
+
+	return rollback, nil
+}
+
+// checkAsyncRollback returns the rollback with the state of its release revision and the number of ready
+// resources, it is deployed once helm deployed the revision and all its resources are ready
+func checkAsyncRollback(ctx context.Context, client kubernetes.Interface, actionConfig *action.Configuration, releaseName string, rollback asyncRollback) asyncRollback {
+	rel, err := actionConfig.Releases.Get(releaseName, rollback.Revision)
+	if err != nil {
+		return rollback
+	}
+
+	rollback.Updated = formatTime(time.Now())
+
+	switch rel.Info.Status {
+	case release.StatusFailed:
+		rollback.State = asyncRollbackFailed
+
+		return rollback
+	case release.StatusSuperseded:
+		rollback.State = asyncRollbackSuperseded
+
+		return rollback
+	}
+
+	resources, err := actionConfig.KubeClient.Build(bytes.NewBufferString(rel.Manifest), false)
+	if err != nil {
+		return rollback
+	}
+
+	rollback.Ready = countReady(ctx, readyChecker(client, actionConfig), resources)
+	rollback.Resources = len(resources)
+
+	rollback.State = asyncRollbackPending
+	if rel.Info.Status == release.StatusDeployed && rollback.Ready == rollback.Resources {
+		rollback.State = asyncRollbackDeployed
+	}
+
+	return rollback
+}
+
+// updateAsyncRollback refreshes a pending rollback of an earlier --rollback-async run on the held lock,
+// the annotation is written with the next renewal
+func updateAsyncRollback(ctx context.Context, client kubernetes.Interface, actionConfig *action.Configuration, lock resourcelock.Interface, opts *lockOptions, namespace, lockName string) {
+	meta, err := lockObjectMeta(ctx, client, opts.lockTypes[0], namespace, lockName)
+	if err != nil {
+		return
+	}
+
+	rollback, err := parseAsyncRollback(meta.Annotations[rollbackAnnotation])
+	if err != nil {
+		opts.logger.Printf("Warning: %v", err)
+
+		return
+	}
+
+	if rollback == nil || rollback.State != asyncRollbackPending {
+		return
+	}
+
+	current := checkAsyncRollback(ctx, client, actionConfig, opts.releaseName, *rollback)
+	opts.logger.Printf("Asynchronous rollback of release '%s' to revision %d is %s, %d of %d resources ready",
+		opts.releaseName, current.Target, current.State, current.Ready, current.Resources)
+
+	setAsyncRollback(lock, current)
+}
+
+// setAsyncRollback queues the rollback annotation for the next renewal of the lock
+func setAsyncRollback(lock resourcelock.Interface, rollback asyncRollback) {
+	value, err := json.Marshal(rollback)
+	if err != nil {
+		return
+	}
+
+	setLockAnnotation(lock, rollbackAnnotation, string(value))
+}
+
+// describeAsyncRollback returns the rollback of the annotation for helm lock status, a pending rollback
+// is checked against the release, the annotation is shown as is when it cannot be decoded
+func describeAsyncRollback(ctx context.Context, client kubernetes.Interface, actionConfig *action.Configuration, releaseName, value string) string {
+	rollback, err := parseAsyncRollback(value)
+	if err != nil || rollback == nil {
+		return value
+	}
+
+	if rollback.State == asyncRollbackPending {
+		current := checkAsyncRollback(ctx, client, actionConfig, releaseName, *rollback)
+		rollback = &current
+	}
+
+	return rollback.String()
+}
+
+// readyChecker returns a ready checker that reads the resources with the helm client, client is only
+// used without one
+func readyChecker(client kubernetes.Interface, actionConfig *action.Configuration) *kube.ReadyChecker {
+	if kubeClient, ok := actionConfig.KubeClient.(*kube.Client); ok {
+		if clientset, err := kubeClient.Factory.KubernetesClientSet(); err == nil {
+			client = clientset
+		}
+	}
+
+	checker := kube.NewReadyChecker(client, func(_ string, _ ...any) {}, kube.PausedAsReady(true), kube.CheckJobs(true))
+
+	return &checker
+}
+
+// countReady returns the number of ready resources
+func countReady(ctx context.Context, checker *kube.ReadyChecker, resources kube.ResourceList) int {
+	ready := 0
+
+	for _, info := range resources {
+		if ok, err := checker.IsReady(ctx, info); err == nil && ok {
+			ready++
+		}
+	}
+
+	return ready
+}
+
+// rollbackProgress logs how many resources of the latest release revision are ready on every interval
+// until ctx is done, the resources are built again only when the revision changes.
+// The resources are read with the helm client, client is only used without one.
+func rollbackProgress(ctx context.Context, client kubernetes.Interface, actionConfig *action.Configuration, opts *lockOptions, interval time.Duration) {
+	checker := readyChecker(client, actionConfig)
+
+	var (
+		revision  int
+		resources kube.ResourceList
+	)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		rel, err := actionConfig.Releases.Last(opts.releaseName)
+		if err != nil {
+			continue
+		}
+
+		if rel.Version != revision {
+			resources, err = actionConfig.KubeClient.Build(bytes.NewBufferString(rel.Manifest), false)
+			if err != nil {
+				opts.logger.Printf("Rollback in progress, cannot read the resources of revision %d: %v", rel.Version, err)
+
+				continue
+			}
+
+			revision = rel.Version
+		}
+
+		ready := countReady(ctx, checker, resources)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		opts.logger.Printf("Rollback in progress to revision %d: %d of %d resources ready", revision, ready, len(resources))
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckAsyncRollback(t *testing.T) {
+	rolledBack := failedReleaseFixture + `- name: app
+  revision: 3
+  status: %s
+  chart: app
+  chartVersion: 1.0.0
+`
+
+	tests := []struct {
+		name     string
+		fixture  string
+		revision int
+		want     string
+	}{
+		{name: "deployed revision", fixture: strings.Replace(rolledBack, "%s", "deployed", 1), revision: 3, want: asyncRollbackDeployed},
+		{name: "revision in progress", fixture: strings.Replace(rolledBack, "%s", "pending-rollback", 1), revision: 3, want: asyncRollbackPending},
+		{name: "failed revision", fixture: strings.Replace(rolledBack, "%s", "failed", 1), revision: 3, want: asyncRollbackFailed},
+		{name: "superseded revision", fixture: strings.Replace(rolledBack, "%s", "superseded", 1), revision: 3, want: asyncRollbackSuperseded},
+		{name: "unknown revision", fixture: failedReleaseFixture, revision: 3, want: asyncRollbackPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, actionConfig, err := loadFixture(writeFixture(t, tt.fixture), "default")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			submitted := asyncRollback{Target: 1, Revision: tt.revision, State: asyncRollbackPending, Submitted: formatTime(time.Now())}
+
+			got := checkAsyncRollback(context.Background(), client, actionConfig, "app", submitted)
+			if got.State != tt.want || got.Target != 1 || got.Revision != tt.revision {
+				t.Errorf("checkAsyncRollback() = %+v, want the state %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAsyncRollbackStatus(t *testing.T) {
+	client, actionConfig, err := loadFixture(writeFixture(t, failedReleaseFixture), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readRollback := func() *asyncRollback {
+		t.Helper()
+
+		lease, err := client.CoordinationV1().Leases("default").Get(context.Background(), "helm-lock-app", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rollback, err := parseAsyncRollback(lease.Annotations[rollbackAnnotation])
+		if err != nil || rollback == nil {
+			t.Fatalf("rollback annotation = %q, error = %v", lease.Annotations[rollbackAnnotation], err)
+		}
+
+		return rollback
+	}
+
+	// the async run submits the rollback, records it on the lock and skips the command
+	opts := newTestOptions(io.Discard)
+	opts.rollbackAsync = true
+	opts.executor = func(context.Context, *lockOptions, []string, io.Writer) error {
+		t.Error("helm ran after an asynchronous rollback")
+
+		return nil
+	}
+
+	err = acquireLockAndExecute(context.Background(), client, actionConfig, opts, "helm-lock-app", "default", &lockReport{started: time.Now()})
+
+	var codeError *Error
+	if !errors.As(err, &codeError) || codeError.Code != ExitCodeRollbackSubmitted {
+		t.Fatalf("acquireLockAndExecute() error = %v, want exit code %d", err, ExitCodeRollbackSubmitted)
+	}
+
+	rollback := readRollback()
+	if rollback.Target != 1 || rollback.Revision != 3 || rollback.State != asyncRollbackDeployed {
+		t.Errorf("submitted rollback = %+v, want revision 3 to 1 deployed", rollback)
+	}
+
+	var out bytes.Buffer
+	if err := printStatus(context.Background(), client, actionConfig, lockTypeLease, "default", "helm-lock-app", "app", false, &out); err != nil {
+		t.Fatalf("printStatus() error = %v", err)
+	}
+
+	if want := "deployed, revision 3 rolls back to 1, 0 of 0 resources ready"; !strings.Contains(out.String(), want) {
+		t.Errorf("status output has no %q:\n%s", want, out.String())
+	}
+
+	// the next run settles a rollback that was still pending
+	rollback.State = asyncRollbackPending
+
+	value, err := json.Marshal(rollback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lease, err := client.CoordinationV1().Leases("default").Get(context.Background(), "helm-lock-app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lease.Annotations[rollbackAnnotation] = string(value)
+	if _, err := client.CoordinationV1().Leases("default").Update(context.Background(), lease, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var log bytes.Buffer
+
+	opts = newTestOptions(&log)
+	if err := acquireLockAndExecute(context.Background(), client, actionConfig, opts, "helm-lock-app", "default", &lockReport{started: time.Now()}); err != nil {
+		t.Fatalf("acquireLockAndExecute() error = %v", err)
+	}
+
+	if want := "Asynchronous rollback of release 'app' to revision 1 is deployed"; !strings.Contains(log.String(), want) {
+		t.Errorf("log has no %q:\n%s", want, log.String())
+	}
+
+	if rollback := readRollback(); rollback.State != asyncRollbackDeployed {
+		t.Errorf("rollback after the next run = %+v, want deployed", rollback)
+	}
+}
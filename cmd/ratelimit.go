@@ -0,0 +1,109 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	rollbackLimitConfigMap     = lockPrefix + "rollbacks"
+	rollbackLimitKey           = "rollbacks"
+	defaultRollbackLimitWindow = time.Hour
+)
+
+// rollbackRecord is a rollback counted against the rate limit
+type rollbackRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Release   string    `json:"release"`
+	Namespace string    `json:"namespace"`
+}
+
+// reserveRollback counts a rollback in the shared rate limit ConfigMap, it fails when
+// the limit of rollbacks within the window is reached
+func reserveRollback(ctx context.Context, client kubernetes.Interface, opts *lockOptions, record rollbackRecord) error {
+	namespace := opts.rollbackLimitNamespaceName()
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	configMaps := client.CoreV1().ConfigMaps(namespace)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, rollbackLimitConfigMap, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      rollbackLimitConfigMap,
+					Namespace: namespace,
+					Labels:    map[string]string{managedByLabel: managedByValue},
+				},
+				Data: map[string]string{
+					rollbackLimitKey: string(line),
+				},
+			}
+
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(corev1.Resource("configmaps"), rollbackLimitConfigMap, err)
+			}
+
+			return err
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// keep the rollbacks within the window only
+		since := record.Timestamp.Add(-opts.rollbackLimitWindow)
+		records := []string{}
+
+		for _, l := range strings.Split(cm.Data[rollbackLimitKey], "\n") {
+			var r rollbackRecord
+			if err := json.Unmarshal([]byte(l), &r); err == nil && r.Timestamp.After(since) {
+				records = append(records, l)
+			}
+		}
+
+		if len(records) >= opts.rollbackLimit {
+			return fmt.Errorf("rollback rate limit reached, %d rollbacks within %s recorded in configmap %s/%s", len(records), opts.rollbackLimitWindow, namespace, rollbackLimitConfigMap)
+		}
+
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+
+		cm.Data[rollbackLimitKey] = strings.Join(append(records, string(line)), "\n")
+
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+
+		return err
+	})
+}
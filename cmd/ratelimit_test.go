@@ -0,0 +1,76 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReserveRollbackNamespace(t *testing.T) {
+	tests := []struct {
+		name           string
+		lockContext    string
+		lockNamespace  string
+		limitNamespace string
+		want           string
+	}{
+		{name: "release namespace", want: "default"},
+		{name: "lock namespace without lock context", lockNamespace: "helm-locks", want: "default"},
+		{name: "lock context", lockContext: "central", want: "default"},
+		{name: "lock context and lock namespace", lockContext: "central", lockNamespace: "helm-locks", want: "helm-locks"},
+		{name: "explicit namespace", lockContext: "central", lockNamespace: "helm-locks", limitNamespace: "rollbacks", want: "rollbacks"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the lock cluster and the workload cluster are separate clientsets
+			lockClient, releaseClient := fake.NewSimpleClientset(), fake.NewSimpleClientset()
+
+			opts := newTestOptions(io.Discard)
+			opts.helmSettings.SetNamespace("default")
+			opts.lockKubeContext = tt.lockContext
+			opts.lockNamespace = tt.lockNamespace
+			opts.rollbackLimitNamespace = tt.limitNamespace
+			opts.rollbackLimit = 1
+			opts.rollbackLimitWindow = time.Hour
+
+			record := rollbackRecord{Timestamp: time.Now().UTC(), Release: "app", Namespace: "default"}
+			if err := reserveRollback(context.Background(), lockClient, opts, record); err != nil {
+				t.Fatalf("reserveRollback() error = %v", err)
+			}
+
+			if _, err := lockClient.CoreV1().ConfigMaps(tt.want).Get(context.Background(), rollbackLimitConfigMap, metav1.GetOptions{}); err != nil {
+				t.Errorf("counter in lock cluster namespace %s: %v", tt.want, err)
+			}
+
+			if _, err := releaseClient.CoreV1().ConfigMaps(tt.want).Get(context.Background(), rollbackLimitConfigMap, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+				t.Errorf("counter in workload cluster: error = %v, want not found", err)
+			}
+
+			if err := reserveRollback(context.Background(), lockClient, opts, record); err == nil {
+				t.Errorf("reserveRollback() over the limit error = nil")
+			}
+		})
+	}
+}
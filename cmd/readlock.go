@@ -0,0 +1,259 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// readersAnnotation holds the shared readers of a lease as a JSON map of identity to expiry time,
+// the exclusive writer is the lease holder
+const readersAnnotation = "helm-lock/readers"
+
+const (
+	readerTTL          = 15 * time.Second
+	readerRenewPeriod  = 5 * time.Second
+	readerPollInterval = 2 * time.Second
+)
+
+// activeReaders returns the readers of the lease that have not expired
+func activeReaders(lease *coordinationv1.Lease) map[string]time.Time {
+	readers := map[string]time.Time{}
+
+	if err := json.Unmarshal([]byte(lease.Annotations[readersAnnotation]), &readers); err != nil {
+		return map[string]time.Time{}
+	}
+
+	now := time.Now()
+	maps.DeleteFunc(readers, func(_ string, expires time.Time) bool {
+		return now.After(expires)
+	})
+
+	return readers
+}
+
+// leaseWriter returns the holder of the lease while it is held
+func leaseWriter(lease *coordinationv1.Lease) string {
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity == "" || spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return ""
+	}
+
+	if time.Now().After(spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)) {
+		return ""
+	}
+
+	return *spec.HolderIdentity
+}
+
+// tryAcquireRead adds or renews the reader on the lease, it returns the writer that blocks a new reader.
+// A renewal ignores the writer, the writer waits for the readers that were in before it
+func tryAcquireRead(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, lockName, identity string, renew bool) (string, error) {
+	leases := client.CoordinationV1().Leases(namespace)
+	writer := ""
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		writer = ""
+
+		lease, err := leases.Get(ctx, lockName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			value, err := json.Marshal(map[string]time.Time{identity: time.Now().Add(readerTTL)})
+			if err != nil {
+				return err
+			}
+
+			_, err = leases.Create(ctx, &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        lockName,
+					Namespace:   namespace,
+					Labels:      lockLabels(opts),
+					Annotations: map[string]string{readersAnnotation: string(value)},
+				},
+			}, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(coordinationv1.Resource("leases"), lockName, err)
+			}
+
+			return err
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !renew {
+			if writer = leaseWriter(lease); writer != "" {
+				return nil
+			}
+		}
+
+		readers := activeReaders(lease)
+		readers[identity] = time.Now().Add(readerTTL)
+
+		value, err := json.Marshal(readers)
+		if err != nil {
+			return err
+		}
+
+		if lease.Annotations == nil {
+			lease.Annotations = map[string]string{}
+		}
+
+		lease.Annotations[readersAnnotation] = string(value)
+
+		_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+
+		return err
+	})
+
+	return writer, err
+}
+
+// releaseRead removes the reader from the lease
+func releaseRead(ctx context.Context, client kubernetes.Interface, namespace, lockName, identity string) error {
+	leases := client.CoordinationV1().Leases(namespace)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		lease, err := leases.Get(ctx, lockName, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		readers := activeReaders(lease)
+		if _, found := readers[identity]; !found {
+			return nil
+		}
+
+		delete(readers, identity)
+
+		value, err := json.Marshal(readers)
+		if err != nil {
+			return err
+		}
+
+		lease.Annotations[readersAnnotation] = string(value)
+
+		_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+
+		return err
+	})
+}
+
+// withSharedLock runs the operation as a reader of the lock, readers run together and wait
+// while a writer holds the lock. The reader is renewed while the operation runs
+func withSharedLock(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, lockName, identity string, operation func(context.Context) error) error {
+	ticker := time.NewTicker(readerPollInterval)
+	defer ticker.Stop()
+
+	for waiting := false; ; waiting = true {
+		writer, err := tryAcquireRead(ctx, client, opts, namespace, lockName, identity, false)
+		if err != nil {
+			return fmt.Errorf("failed to acquire the shared lock: %w", err)
+		}
+
+		if writer == "" {
+			break
+		}
+
+		if !waiting {
+			opts.logger.Printf("Lock '%s' is held by writer '%s', waiting to read", lockName, writer)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("lock '%s' is held by '%s': %w", lockName, writer, ErrLockTimeout)
+		case <-ticker.C:
+		}
+	}
+
+	opts.logger.Printf("Acquired shared lock '%s' for %s operation", lockName, opts.helmCommand)
+
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditTimeout)
+		defer cancel()
+
+		if err := releaseRead(releaseCtx, client, namespace, lockName, identity); err != nil {
+			opts.logger.Printf("Warning: failed to release the shared lock: %v", err)
+		}
+	}()
+
+	renewCtx, stopRenew := context.WithCancel(ctx)
+	defer stopRenew()
+
+	go func() {
+		renew := time.NewTicker(readerRenewPeriod)
+		defer renew.Stop()
+
+		for {
+			select {
+			case <-renewCtx.Done():
+				return
+			case <-renew.C:
+				if _, err := tryAcquireRead(renewCtx, client, opts, namespace, lockName, identity, true); err != nil {
+					opts.logger.Printf("Warning: failed to renew the shared lock: %v", err)
+				}
+			}
+		}
+	}()
+
+	return operation(ctx)
+}
+
+// waitForReaders blocks the writer holding the lock until the readers that were in before it are done,
+// new readers do not enter while the writer holds the lock
+func waitForReaders(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, lockName string) error {
+	ticker := time.NewTicker(readerPollInterval)
+	defer ticker.Stop()
+
+	for waiting := false; ; waiting = true {
+		lease, err := client.CoordinationV1().Leases(namespace).Get(ctx, lockName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to read the readers of the lock: %w", err)
+		}
+
+		readers := activeReaders(lease)
+		if len(readers) == 0 {
+			return nil
+		}
+
+		if !waiting {
+			opts.logger.Printf("Waiting for %d reader(s) of lock '%s' to finish: %s", len(readers), lockName, strings.Join(slices.Sorted(maps.Keys(readers)), ", "))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
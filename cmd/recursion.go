@@ -0,0 +1,89 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// activeEnv lists the namespace/lock-name locks held by the helm-lock processes that started this one,
+// it is set for the helm child and the hold command
+const activeEnv = "HELM_LOCK_ACTIVE"
+
+// errRecursiveLock is returned when helm-lock runs under a helm-lock that holds the same lock
+var errRecursiveLock = errors.New("recursive helm-lock invocation detected")
+
+// activeLockKey returns the key of the lock in the marker
+func activeLockKey(namespace, lockName string) string {
+	return namespace + "/" + lockName
+}
+
+// activeLocks returns the locks of the marker inherited from the parent helm-lock processes
+func activeLocks() []string {
+	value := os.Getenv(activeEnv)
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
+
+// checkRecursiveLock fails when a parent helm-lock already holds the lock, for example when helm
+// resolves back to helm-lock, the run would wait on its own lock until the timeout.
+// A nested run for another lock is allowed, a run for another release under the same shared lock is not.
+func checkRecursiveLock(namespace, lockName string) error {
+	key := activeLockKey(namespace, lockName)
+
+	if slices.Contains(activeLocks(), key) {
+		return fmt.Errorf("%w: the lock '%s' in namespace '%s' is held by a parent helm-lock process (%s=%s)",
+			errRecursiveLock, lockName, namespace, activeEnv, os.Getenv(activeEnv))
+	}
+
+	return nil
+}
+
+// enterLocks checks the locks the run is about to take against the parent processes and
+// adds them to the locks passed on to helm
+func enterLocks(opts *lockOptions, namespace string, lockNames ...string) error {
+	for _, lockName := range lockNames {
+		if err := checkRecursiveLock(namespace, lockName); err != nil {
+			return err
+		}
+	}
+
+	opts.activeLocks = append(opts.activeLocks, lockNames...)
+
+	return nil
+}
+
+// activeLockEnv returns the marker for a child process, with the locks of this process added
+// to the inherited ones
+func activeLockEnv(namespace string, lockNames ...string) string {
+	locks := activeLocks()
+
+	for _, lockName := range lockNames {
+		if key := activeLockKey(namespace, lockName); !slices.Contains(locks, key) {
+			locks = append(locks, key)
+		}
+	}
+
+	return activeEnv + "=" + strings.Join(locks, ",")
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCheckRecursiveLock(t *testing.T) {
+	tests := []struct {
+		name     string
+		active   string
+		lockName string
+		wantErr  bool
+	}{
+		{name: "no parent", lockName: "helm-lock-app"},
+		{name: "parent holds the lock", active: "default/helm-lock-app", lockName: "helm-lock-app", wantErr: true},
+		{name: "parent holds another lock", active: "default/helm-lock-api", lockName: "helm-lock-app"},
+		{name: "parent holds the lock in another namespace", active: "apps/helm-lock-app", lockName: "helm-lock-app"},
+		{name: "one of the parent locks", active: "default/helm-lock-db,default/helm-lock-app", lockName: "helm-lock-app", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(activeEnv, tt.active)
+
+			err := checkRecursiveLock("default", tt.lockName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkRecursiveLock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil && !errors.Is(err, errRecursiveLock) {
+				t.Errorf("checkRecursiveLock() error = %v, want %v", err, errRecursiveLock)
+			}
+		})
+	}
+}
+
+func TestActiveLockEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		active    string
+		lockNames []string
+		want      string
+	}{
+		{name: "no locks", want: activeEnv + "="},
+		{name: "own lock", lockNames: []string{"helm-lock-app"}, want: activeEnv + "=default/helm-lock-app"},
+		{name: "inherited and own locks", active: "apps/helm-lock-db", lockNames: []string{"helm-lock-app", "helm-lock-api"}, want: activeEnv + "=apps/helm-lock-db,default/helm-lock-app,default/helm-lock-api"},
+		{name: "inherited lock is not repeated", active: "default/helm-lock-app", lockNames: []string{"helm-lock-app"}, want: activeEnv + "=default/helm-lock-app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(activeEnv, tt.active)
+
+			if got := activeLockEnv("default", tt.lockNames...); got != tt.want {
+				t.Errorf("activeLockEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRecursiveRun runs helm-lock nested under the marker of a parent run that holds the lock of
+// the release app under the shared lock name platform and the lock of its dependency db
+func TestRecursiveRun(t *testing.T) {
+	parent := newTestOptions(io.Discard)
+
+	t.Setenv(activeEnv, "")
+
+	if err := enterLocks(parent, "default", "helm-lock-platform", "helm-lock-db"); err != nil {
+		t.Fatal(err)
+	}
+
+	fixture := writeFixture(t, `releases:
+- name: app
+  revision: 1
+  status: deployed
+- name: api
+  revision: 1
+  status: deployed
+- name: db
+  revision: 1
+  status: deployed
+- name: web
+  revision: 1
+  status: deployed
+`)
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{name: "same release and lock", args: []string{"upgrade", "app", "./chart", "--lock-name", "platform"}, wantErr: true},
+		{name: "other release under the shared lock", args: []string{"upgrade", "api", "./chart", "--lock-name", "platform"}, wantErr: true},
+		{name: "dependency lock of the parent", args: []string{"upgrade", "db", "./chart"}, wantErr: true},
+		{name: "shared read of the held lock", args: []string{"template", "app", "./chart", "--lock-name", "platform", "--shared-reads"}, wantErr: true},
+		{name: "other lock", args: []string{"upgrade", "web", "./chart"}},
+		{name: "release of the shared lock with its own lock", args: []string{"upgrade", "app", "./chart"}},
+	}
+
+	// the helm child of the parent gets the marker
+	t.Setenv(activeEnv, strings.TrimPrefix(activeLockEnv("default", parent.activeLocks...), activeEnv+"="))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := run(context.Background(), append(tt.args, "--fixture", fixture, "--lock-timeout", "5s"))
+			if tt.wantErr != errors.Is(err, errRecursiveLock) {
+				t.Errorf("run() error = %v, want recursive %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExecHelmActiveLocks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake helm is a shell script")
+	}
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "active")
+
+	script := "#!/bin/sh\nprintf '%s' \"$" + activeEnv + "\" > " + out + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "helm"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv(activeEnv, "apps/helm-lock-parent")
+
+	opts := newTestOptions(io.Discard)
+	opts.activeLocks = []string{"helm-lock-platform", "helm-lock-db"}
+
+	if err := execHelm(context.Background(), opts, []string{"upgrade", "app", "./chart"}, io.Discard, io.Discard); err != nil {
+		t.Fatalf("execHelm() error = %v", err)
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "apps/helm-lock-parent,default/helm-lock-platform,default/helm-lock-db"; string(got) != want {
+		t.Errorf("%s of helm = %q, want %q", activeEnv, got, want)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const redactedValue = "***"
+
+var (
+	setFlags = []string{"--set", "--set-string", "--set-json", "--set-literal"}
+
+	secretKeyPattern = regexp.MustCompile(`(?i)(password|passwd|secret|token|api[-_]?key|private[-_]?key|credential|auth)`)
+)
+
+// redactFlags returns a copy of the helm flags with secret-looking --set values replaced
+func redactFlags(flags []string) []string {
+	redacted := make([]string, 0, len(flags))
+
+	for i := 0; i < len(flags); i++ {
+		flag := flags[i]
+
+		name, value, found := strings.Cut(flag, "=")
+		if !slices.Contains(setFlags, name) {
+			redacted = append(redacted, flag)
+
+			continue
+		}
+
+		if found {
+			redacted = append(redacted, name+"="+redactSetValue(value))
+
+			continue
+		}
+
+		redacted = append(redacted, flag)
+
+		if i+1 < len(flags) && !strings.HasPrefix(flags[i+1], "-") {
+			redacted = append(redacted, redactSetValue(flags[i+1]))
+			i++
+		}
+	}
+
+	return redacted
+}
+
+// redactSetValue redacts the values of secret-looking keys in a key1=val1,key2=val2 list
+func redactSetValue(value string) string {
+	pairs := strings.Split(value, ",")
+	for i, pair := range pairs {
+		key, _, found := strings.Cut(pair, "=")
+		if found && secretKeyPattern.MatchString(key) {
+			pairs[i] = key + "=" + redactedValue
+		}
+	}
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// releaseNameArg is the position of the release name among the positional arguments of a helm
+// command, and the number of positional arguments the command needs
+type releaseNameArg struct {
+	index    int
+	required int
+}
+
+// releaseNameArgs lists the helm commands that address a release
+var releaseNameArgs = map[string]releaseNameArg{
+	"install":   {index: 0, required: 2},
+	"upgrade":   {index: 0, required: 2},
+	"template":  {index: 0, required: 2},
+	"rollback":  {index: 0, required: 1},
+	"uninstall": {index: 0, required: 1},
+	"delete":    {index: 0, required: 1},
+	"status":    {index: 0, required: 1},
+	"history":   {index: 0, required: 1},
+	"test":      {index: 0, required: 1},
+	"get":       {index: 1, required: 2},
+}
+
+// unwrapPlugin returns the helm command wrapped by a plugin prefix such as secrets, and its arguments
+func unwrapPlugin(command string, args []string) (string, []string) {
+	if _, ok := releaseNameArgs[command]; ok || len(args) == 0 {
+		return command, args
+	}
+
+	if _, ok := releaseNameArgs[args[0]]; ok {
+		return args[0], args[1:]
+	}
+
+	return command, args
+}
+
+// ResolveReleaseName returns the release name of a helm command line. The args follow the command,
+// positional arguments first, flags are only checked for --generate-name. A plugin prefix like
+// secrets in "secrets upgrade NAME CHART" is unwrapped.
+func ResolveReleaseName(command string, args []string) (string, error) {
+	command, args = unwrapPlugin(command, args)
+
+	var positional []string
+
+	for i, arg := range args {
+		if arg == "--generate-name" || arg == "-g" || strings.HasPrefix(arg, "--generate-name=") {
+			return "", fmt.Errorf("cannot lock a release with --generate-name, the name is not known before helm runs")
+		}
+
+		if strings.HasPrefix(arg, "-") && positional == nil {
+			positional = args[:i]
+		}
+	}
+
+	if positional == nil {
+		positional = args
+	}
+
+	pos, ok := releaseNameArgs[command]
+	if !ok {
+		pos = releaseNameArg{index: 0, required: 1}
+	}
+
+	if len(positional) < pos.required {
+		return "", fmt.Errorf("missing release name in helm %s", command)
+	}
+
+	return positional[pos.index], nil
+}
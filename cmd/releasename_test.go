@@ -0,0 +1,61 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import "testing"
+
+func TestResolveReleaseName(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{name: "upgrade", command: "upgrade", args: []string{"app", "./chart"}, want: "app"},
+		{name: "upgrade with flags", command: "upgrade", args: []string{"app", "./chart", "--install", "-n", "prod"}, want: "app"},
+		{name: "install", command: "install", args: []string{"app", "repo/chart", "--wait"}, want: "app"},
+		{name: "rollback", command: "rollback", args: []string{"app", "3"}, want: "app"},
+		{name: "uninstall", command: "uninstall", args: []string{"app"}, want: "app"},
+		{name: "get subcommand", command: "get", args: []string{"values", "app", "-o", "yaml"}, want: "app"},
+		{name: "unknown command", command: "custom", args: []string{"app"}, want: "app"},
+		{name: "secrets plugin", command: "secrets", args: []string{"upgrade", "app", "./chart", "-f", "secrets.yaml"}, want: "app"},
+		{name: "diff plugin", command: "diff", args: []string{"upgrade", "app", "./chart"}, want: "app"},
+		{name: "plugin get", command: "secrets", args: []string{"get", "values", "app"}, want: "app"},
+		{name: "upgrade without a chart", command: "upgrade", args: []string{"app"}, wantErr: true},
+		{name: "upgrade without arguments", command: "upgrade", wantErr: true},
+		{name: "plugin without a name", command: "secrets", args: []string{"upgrade"}, wantErr: true},
+		{name: "get without a name", command: "get", args: []string{"values"}, wantErr: true},
+		{name: "generate name", command: "install", args: []string{"./chart", "--generate-name"}, wantErr: true},
+		{name: "short generate name", command: "install", args: []string{"./chart", "-g"}, wantErr: true},
+		{name: "generate name with a value", command: "install", args: []string{"./chart", "--generate-name=true"}, wantErr: true},
+		{name: "plugin generate name", command: "secrets", args: []string{"install", "./chart", "-g"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveReleaseName(tt.command, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveReleaseName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ResolveReleaseName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// operationAnnotation holds the persisted operationState of the last --strict-serialize run
+const operationAnnotation = "helm-lock/operation"
+
+// States of a --strict-serialize operation
+const (
+	operationRunning = "running"
+	operationPending = "pending"
+	operationDone    = "done"
+)
+
+// Kinds of commands that must not overlap
+const (
+	operationDeploy    = "deploy"
+	operationUninstall = "uninstall"
+)
+
+// operationState is the command and the state of the last operation, kept on the lock object
+type operationState struct {
+	Command string `json:"command"`
+	State   string `json:"state"`
+	Holder  string `json:"holder"`
+	Updated string `json:"updated"`
+}
+
+// operationKind returns the kind of the helm verb, empty for commands that overlap with any other
+func operationKind(verb string) string {
+	switch verb {
+	case "install", "upgrade", "rollback":
+		return operationDeploy
+	case "uninstall", "delete":
+		return operationUninstall
+	}
+
+	return ""
+}
+
+// inFlight reports whether helm has not finished the last change of the release
+func inFlight(status release.Status) bool {
+	return status.IsPending() || status == release.StatusUninstalling
+}
+
+// readOperationState returns the persisted operation state of the lock, nil when there is none
+func readOperationState(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, lockName string) (*operationState, error) {
+	var (
+		annotations map[string]string
+		err         error
+	)
+
+	if opts.lockTypes[0] == lockTypeConfigMap {
+		cm, getErr := client.CoreV1().ConfigMaps(namespace).Get(ctx, lockName, metav1.GetOptions{})
+		if getErr == nil {
+			annotations = cm.Annotations
+		}
+
+		err = getErr
+	} else {
+		lease, getErr := client.CoordinationV1().Leases(namespace).Get(ctx, lockName, metav1.GetOptions{})
+		if getErr == nil {
+			annotations = lease.Annotations
+		}
+
+		err = getErr
+	}
+
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	value := annotations[operationAnnotation]
+	if value == "" {
+		return nil, nil
+	}
+
+	state := &operationState{}
+	if err := json.Unmarshal([]byte(value), state); err != nil {
+		return nil, fmt.Errorf("invalid '%s' annotation: %w", operationAnnotation, err)
+	}
+
+	return state, nil
+}
+
+// writeOperationState patches the operation state into the annotations of the lock objects
+func writeOperationState(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, lockName string, state operationState) error {
+	state.Updated = formatTime(time.Now())
+
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": map[string]string{
+		operationAnnotation: string(value),
+	}}})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditTimeout)
+	defer cancel()
+
+	for _, lockType := range opts.lockTypes {
+		if lockType == lockTypeConfigMap {
+			_, err = client.CoreV1().ConfigMaps(namespace).Patch(ctx, lockName, types.MergePatchType, patch, metav1.PatchOptions{})
+		} else {
+			_, err = client.CoordinationV1().Leases(namespace).Patch(ctx, lockName, types.MergePatchType, patch, metav1.PatchOptions{})
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to record the operation state on the %s lock: %w", lockType, err)
+		}
+	}
+
+	return nil
+}
+
+// beginSerializedOperation rejects the run when the last operation of the other kind has not settled,
+// then records the run as running. It is called with the lock held, so the state cannot change meanwhile
+func beginSerializedOperation(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, lockName, identity string, releaseStatus release.Status) error {
+	last, err := readOperationState(ctx, client, opts, namespace, lockName)
+	if err != nil {
+		return fmt.Errorf("failed to read the operation state: %w", err)
+	}
+
+	verb := opts.helmVerb()
+
+	if last != nil && last.State != operationDone {
+		lastKind, kind := operationKind(last.Command), operationKind(verb)
+
+		switch {
+		case !inFlight(releaseStatus):
+			opts.logger.Printf("Last %s by '%s' is %s but release status is '%s', it has settled", last.Command, last.Holder, last.State, releaseStatus)
+		case lastKind != kind || kind == "":
+			return fmt.Errorf("release '%s' is '%s' after the %s by '%s' that is %s since %s, --strict-serialize does not start %s before it settles",
+				opts.releaseName, releaseStatus, last.Command, last.Holder, last.State, last.Updated, verb)
+		}
+	}
+
+	return writeOperationState(ctx, client, opts, namespace, lockName, operationState{
+		Command: verb,
+		State:   operationRunning,
+		Holder:  identity,
+	})
+}
+
+// finishSerializedOperation records the run as done, or as pending when the release is still changing,
+// for example after an asynchronous rollback or a helm command that was interrupted
+func finishSerializedOperation(ctx context.Context, client kubernetes.Interface, actionConfig *action.Configuration, opts *lockOptions, namespace, lockName, identity string) {
+	state := operationDone
+
+	if status, err := getReleaseStatus(actionConfig, opts.releaseName); err != nil || inFlight(status) {
+		state = operationPending
+	}
+
+	if err := writeOperationState(ctx, client, opts, namespace, lockName, operationState{
+		Command: opts.helmVerb(),
+		State:   state,
+		Holder:  identity,
+	}); err != nil {
+		opts.logger.Printf("Warning: %v", err)
+	}
+}
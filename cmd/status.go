@@ -0,0 +1,430 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/pkg/action"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultPollInterval = 2 * time.Second
+
+// Lock states reported by the read-only subcommands
+const (
+	lockStateFree    = "free"
+	lockStateHeld    = "held"
+	lockStateExpired = "expired"
+)
+
+// lockInfo is the lease state as seen by the read-only subcommands
+type lockInfo struct {
+	Name      string
+	Namespace string
+	Holder    string
+	State     string
+	Acquired  time.Time
+	Renewed   time.Time
+	Rollback  string
+
+	LastCommand  string
+	LastResult   string
+	LastHolder   string
+	LastFinished string
+}
+
+// getLockInfo reads the lock object of the type, it only uses the get verb
+func getLockInfo(ctx context.Context, client kubernetes.Interface, lockType, namespace, lockName string) (*lockInfo, error) {
+	meta, err := lockObjectMeta(ctx, client, lockType, namespace, lockName)
+	if err == nil {
+		var record *resourcelock.LeaderElectionRecord
+
+		record, _, err = newTypedLock(client, lockType, meta, "").Get(ctx)
+		if err == nil {
+			return recordLockInfo(meta, record), nil
+		}
+	}
+
+	if apierrors.IsNotFound(err) {
+		return &lockInfo{Name: lockName, Namespace: namespace, State: lockStateFree}, nil
+	}
+
+	return nil, err
+}
+
+// leaseLockInfo converts the lease to the lock state
+func leaseLockInfo(lease *coordinationv1.Lease) *lockInfo {
+	return recordLockInfo(lease.ObjectMeta, resourcelock.LeaseSpecToLeaderElectionRecord(&lease.Spec))
+}
+
+// recordLockInfo converts the election record and the annotations of a lock object to the lock state
+func recordLockInfo(meta metav1.ObjectMeta, record *resourcelock.LeaderElectionRecord) *lockInfo {
+	info := &lockInfo{
+		Name:      meta.Name,
+		Namespace: meta.Namespace,
+		State:     lockStateFree,
+		Acquired:  record.AcquireTime.Time,
+		Renewed:   record.RenewTime.Time,
+		Rollback:  meta.Annotations[rollbackAnnotation],
+
+		LastCommand:  meta.Annotations[lastCommandAnnotation],
+		LastResult:   meta.Annotations[lastResultAnnotation],
+		LastHolder:   meta.Annotations[lastHolderAnnotation],
+		LastFinished: meta.Annotations[lastFinishedAnnotation],
+	}
+
+	if record.HolderIdentity != "" {
+		info.Holder = record.HolderIdentity
+		info.State = lockStateHeld
+
+		if record.LeaseDurationSeconds > 0 {
+			expires := info.Renewed.Add(time.Duration(record.LeaseDurationSeconds) * time.Second)
+			if time.Now().After(expires) {
+				info.State = lockStateExpired
+			}
+		}
+	}
+
+	return info
+}
+
+// formatTime formats the lease timestamps, zero time is shown as a dash
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+// leaseYAML returns the lease object as YAML, like kubectl get lease -o yaml
+func leaseYAML(lease *coordinationv1.Lease) (string, error) {
+	lease = lease.DeepCopy()
+	lease.APIVersion = coordinationv1.SchemeGroupVersion.String()
+	lease.Kind = "Lease"
+	// kubectl hides the managed fields by default too
+	lease.ManagedFields = nil
+
+	data, err := yaml.Marshal(lease)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode lease: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// configMapYAML returns the lock ConfigMap as YAML, like kubectl get configmap -o yaml
+func configMapYAML(cm *corev1.ConfigMap) (string, error) {
+	cm = cm.DeepCopy()
+	cm.APIVersion = corev1.SchemeGroupVersion.String()
+	cm.Kind = "ConfigMap"
+	cm.ManagedFields = nil
+
+	data, err := yaml.Marshal(cm)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode configmap: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// releaseLockName returns the lock of the release argument of a subcommand, --lock-name names a shared lock
+func releaseLockName(opts *lockOptions, releaseName string) (string, error) {
+	opts.releaseName = releaseName
+
+	return resolveLockName(opts)
+}
+
+// printStatus prints the lock and release state, it only uses the get verb
+func printStatus(ctx context.Context, client kubernetes.Interface, actionConfig *action.Configuration, lockType, namespace, lockName, releaseName string, dumpLease bool, out io.Writer) error {
+	info, err := getLockInfo(ctx, client, lockType, namespace, lockName)
+	if err != nil {
+		return fmt.Errorf("failed to get lock: %w", err)
+	}
+
+	releaseStatus, err := getReleaseStatus(actionConfig, releaseName)
+	if err != nil && !errors.Is(err, errStatusUndetermined) {
+		return fmt.Errorf("failed to check release status: %w", err)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "Lock:\t%s\n", info.Name)
+	fmt.Fprintf(w, "Namespace:\t%s\n", info.Namespace)
+	fmt.Fprintf(w, "State:\t%s\n", info.State)
+	fmt.Fprintf(w, "Holder:\t%s\n", info.Holder)
+	fmt.Fprintf(w, "Acquired:\t%s\n", formatTime(info.Acquired))
+	fmt.Fprintf(w, "Renewed:\t%s\n", formatTime(info.Renewed))
+	fmt.Fprintf(w, "Release:\t%s\n", releaseStatus)
+
+	if info.Rollback != "" {
+		fmt.Fprintf(w, "Async rollback:\t%s\n", describeAsyncRollback(ctx, client, actionConfig, releaseName, info.Rollback))
+	}
+
+	if info.LastFinished != "" {
+		fmt.Fprintf(w, "Last command:\t%s\n", info.LastCommand)
+		fmt.Fprintf(w, "Last result:\t%s\n", info.LastResult)
+		fmt.Fprintf(w, "Last holder:\t%s\n", info.LastHolder)
+		fmt.Fprintf(w, "Last finished:\t%s\n", info.LastFinished)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if !dumpLease {
+		return nil
+	}
+
+	var data string
+
+	if lockType == lockTypeConfigMap {
+		var cm *corev1.ConfigMap
+
+		if cm, err = client.CoreV1().ConfigMaps(namespace).Get(ctx, lockName, metav1.GetOptions{}); err == nil {
+			data, err = configMapYAML(cm)
+		}
+	} else {
+		var lease *coordinationv1.Lease
+
+		if lease, err = client.CoordinationV1().Leases(namespace).Get(ctx, lockName, metav1.GetOptions{}); err == nil {
+			data, err = leaseYAML(lease)
+		}
+	}
+
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to get lock: %w", err)
+	}
+
+	fmt.Fprintf(out, "---\n%s", data)
+
+	return nil
+}
+
+func newStatusCommand(opts *lockOptions) *cobra.Command {
+	var dumpLease bool
+
+	cmd := &cobra.Command{
+		Use:   "status RELEASE",
+		Short: "Show the lock and release state",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			clientset, actionConfig, err := newClients(opts)
+			if err != nil {
+				return err
+			}
+
+			lockName, err := releaseLockName(opts, args[0])
+			if err != nil {
+				return err
+			}
+
+			return printStatus(cmd.Context(), clientset, actionConfig, opts.lockTypes[0], opts.lockNamespaceName(), lockName, args[0], dumpLease, os.Stdout)
+		},
+	}
+
+	cmd.Flags().BoolVar(&dumpLease, "dump-lease", false, "Also print the full lock object as YAML")
+
+	return cmd
+}
+
+// waitForFreeLock polls the lock until it is not held, it only uses the get verb
+func waitForFreeLock(ctx context.Context, client kubernetes.Interface, lockType, namespace, lockName string, interval time.Duration, out io.Writer) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		info, err := getLockInfo(ctx, client, lockType, namespace, lockName)
+		if err != nil {
+			return fmt.Errorf("failed to get lock: %w", err)
+		}
+
+		if info.State != lockStateHeld {
+			fmt.Fprintf(out, "Lock '%s' is %s\n", lockName, info.State)
+
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("lock '%s' is still held by '%s': %w", lockName, info.Holder, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func newWaitCommand(opts *lockOptions) *cobra.Command {
+	timeout := defaultLockTimeout
+	interval := defaultPollInterval
+
+	cmd := &cobra.Command{
+		Use:   "wait RELEASE",
+		Short: "Wait until the lock is free",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			clientset, _, err := newClients(opts)
+			if err != nil {
+				return err
+			}
+
+			lockName, err := releaseLockName(opts, args[0])
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+
+			return waitForFreeLock(ctx, clientset, opts.lockTypes[0], opts.lockNamespaceName(), lockName, interval, os.Stdout)
+		},
+	}
+
+	cmd.Flags().DurationVar(&timeout, "lock-timeout", defaultLockTimeout, "Maximum time to wait for the lock to be free")
+	cmd.Flags().DurationVar(&interval, "poll-interval", defaultPollInterval, "Interval between lock checks")
+
+	return cmd
+}
+
+// listLocks prints the helm-lock lock objects of the type in the namespace, it only uses the list verb
+func listLocks(ctx context.Context, client kubernetes.Interface, lockType, namespace string, dumpLease bool, out io.Writer) error {
+	var (
+		infos []*lockInfo
+		dumps []string
+	)
+
+	if lockType == lockTypeConfigMap {
+		cms, err := client.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list locks: %w", err)
+		}
+
+		for i := range cms.Items {
+			cm := &cms.Items[i]
+			if !strings.HasPrefix(cm.Name, lockPrefix) {
+				continue
+			}
+
+			if dumpLease {
+				data, err := configMapYAML(cm)
+				if err != nil {
+					return err
+				}
+
+				dumps = append(dumps, data)
+
+				continue
+			}
+
+			record, _, err := configMapRecord(cm)
+			if err != nil {
+				return fmt.Errorf("failed to decode lock '%s': %w", cm.Name, err)
+			}
+
+			infos = append(infos, recordLockInfo(cm.ObjectMeta, record))
+		}
+	} else {
+		leases, err := client.CoordinationV1().Leases(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list locks: %w", err)
+		}
+
+		for i := range leases.Items {
+			lease := &leases.Items[i]
+			if !strings.HasPrefix(lease.Name, lockPrefix) {
+				continue
+			}
+
+			if dumpLease {
+				data, err := leaseYAML(lease)
+				if err != nil {
+					return err
+				}
+
+				dumps = append(dumps, data)
+
+				continue
+			}
+
+			infos = append(infos, leaseLockInfo(lease))
+		}
+	}
+
+	if dumpLease {
+		for _, data := range dumps {
+			fmt.Fprintf(out, "---\n%s", data)
+		}
+
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATE\tHOLDER\tRENEWED")
+
+	for _, info := range infos {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", info.Name, info.State, info.Holder, formatTime(info.Renewed))
+	}
+
+	return w.Flush()
+}
+
+func newLocksCommand(opts *lockOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "locks",
+		Short: "Inspect helm-lock locks",
+	}
+
+	var dumpLease bool
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the locks in the namespace",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			clientset, _, err := newClients(opts)
+			if err != nil {
+				return err
+			}
+
+			return listLocks(cmd.Context(), clientset, opts.lockTypes[0], opts.lockNamespaceName(), dumpLease, os.Stdout)
+		},
+	}
+
+	list.Flags().BoolVar(&dumpLease, "dump-lease", false, "Print the full lock objects as YAML instead of the table")
+	cmd.AddCommand(list)
+
+	return cmd
+}
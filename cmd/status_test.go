@@ -0,0 +1,251 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// readOnlyClientset returns a fake clientset with the objects that forbids every verb but get, list and watch
+func readOnlyClientset(t *testing.T, objects ...runtime.Object) *fake.Clientset {
+	t.Helper()
+
+	client := fake.NewClientset(objects...)
+	client.PrependReactor("*", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		switch action.GetVerb() {
+		case "get", "list", "watch":
+			return false, nil, nil
+		}
+
+		t.Errorf("read-only path used the %s verb on %s", action.GetVerb(), action.GetResource().Resource)
+
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: action.GetResource().Resource}, "", errors.New("read-only"))
+	})
+
+	return client
+}
+
+// testLease returns a helm-lock lease held by the holder, renewed the given time ago
+func testLease(name, holder string, renewedAgo time.Duration) *coordinationv1.Lease {
+	duration := int32(15)
+	renewed := metav1.NewMicroTime(time.Now().Add(-renewedAgo))
+
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &renewed,
+			RenewTime:            &renewed,
+		},
+	}
+}
+
+// testLockObject returns a helm-lock lock object of the type held by the holder, renewed the given time ago
+func testLockObject(t *testing.T, lockType, name, holder string, renewedAgo time.Duration) runtime.Object {
+	t.Helper()
+
+	lease := testLease(name, holder, renewedAgo)
+	if lockType == lockTypeLease {
+		return lease
+	}
+
+	record, err := json.Marshal(resourcelock.LeaseSpecToLeaderElectionRecord(&lease.Spec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   lease.Namespace,
+			Name:        name,
+			Annotations: map[string]string{resourcelock.LeaderElectionRecordAnnotationKey: string(record)},
+		},
+	}
+}
+
+func TestPrintStatusReadOnly(t *testing.T) {
+	_, actionConfig, err := loadFixture(writeFixture(t, failedReleaseFixture), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		lockType  string
+		lockName  string
+		dumpLease bool
+		want      []string
+	}{
+		{name: "held lock", lockType: lockTypeLease, lockName: "helm-lock-app", want: []string{"helm-lock-app", "held", "runner", "failed"}},
+		{name: "shared lock", lockType: lockTypeLease, lockName: "helm-lock-shared", want: []string{"helm-lock-shared", "expired", "other"}},
+		{name: "missing lock", lockType: lockTypeLease, lockName: "helm-lock-web", want: []string{"helm-lock-web", "free"}},
+		{name: "dump lease", lockType: lockTypeLease, lockName: "helm-lock-app", dumpLease: true, want: []string{"kind: Lease", "holderIdentity: runner"}},
+		{name: "held configmap lock", lockType: lockTypeConfigMap, lockName: "helm-lock-app", want: []string{"helm-lock-app", "held", "runner", "failed"}},
+		{name: "expired configmap lock", lockType: lockTypeConfigMap, lockName: "helm-lock-shared", want: []string{"helm-lock-shared", "expired", "other"}},
+		{name: "missing configmap lock", lockType: lockTypeConfigMap, lockName: "helm-lock-web", want: []string{"helm-lock-web", "free"}},
+		{name: "dump configmap", lockType: lockTypeConfigMap, lockName: "helm-lock-app", dumpLease: true, want: []string{"kind: ConfigMap", `"holderIdentity":"runner"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := readOnlyClientset(t,
+				testLockObject(t, tt.lockType, "helm-lock-app", "runner", 0),
+				testLockObject(t, tt.lockType, "helm-lock-shared", "other", time.Minute),
+			)
+
+			var out bytes.Buffer
+			if err := printStatus(context.Background(), client, actionConfig, tt.lockType, "default", tt.lockName, "app", tt.dumpLease, &out); err != nil {
+				t.Fatalf("printStatus() error = %v", err)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("status output has no %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestWaitForFreeLockReadOnly(t *testing.T) {
+	tests := []struct {
+		name       string
+		holder     string
+		renewedAgo time.Duration
+		want       string
+		wantErr    bool
+	}{
+		{name: "missing lock", want: "is free"},
+		{name: "expired lock", holder: "other", renewedAgo: time.Minute, want: "is expired"},
+		{name: "held lock", holder: "other", wantErr: true},
+	}
+
+	for _, lockType := range lockTypes {
+		for _, tt := range tests {
+			t.Run(lockType+" "+tt.name, func(t *testing.T) {
+				var objects []runtime.Object
+				if tt.holder != "" {
+					objects = append(objects, testLockObject(t, lockType, "helm-lock-app", tt.holder, tt.renewedAgo))
+				}
+
+				client := readOnlyClientset(t, objects...)
+
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+
+				var out bytes.Buffer
+
+				err := waitForFreeLock(ctx, client, lockType, "default", "helm-lock-app", 10*time.Millisecond, &out)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("waitForFreeLock() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("waitForFreeLock() error = %v, want %v", err, context.DeadlineExceeded)
+				}
+
+				if !strings.Contains(out.String(), tt.want) {
+					t.Errorf("wait output = %q, want %q", out.String(), tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestListLocksReadOnly(t *testing.T) {
+	for _, lockType := range lockTypes {
+		t.Run(lockType, func(t *testing.T) {
+			client := readOnlyClientset(t,
+				testLockObject(t, lockType, "helm-lock-app", "runner", 0),
+				testLockObject(t, lockType, "helm-lock-api", "other", time.Minute),
+				testLockObject(t, lockType, "kube-scheduler", "node", 0),
+			)
+
+			var out bytes.Buffer
+			if err := listLocks(context.Background(), client, lockType, "default", false, &out); err != nil {
+				t.Fatalf("listLocks() error = %v", err)
+			}
+
+			for _, want := range []string{"helm-lock-app", "held", "runner", "helm-lock-api", "expired"} {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("list output has no %q:\n%s", want, out.String())
+				}
+			}
+
+			if strings.Contains(out.String(), "kube-scheduler") {
+				t.Errorf("list output has a lock of another owner:\n%s", out.String())
+			}
+
+			out.Reset()
+
+			if err := listLocks(context.Background(), client, lockType, "default", true, &out); err != nil {
+				t.Fatalf("listLocks() with the lock dump error = %v", err)
+			}
+
+			if strings.Count(out.String(), "---\n") != 2 {
+				t.Errorf("lock dump has %d objects, want 2:\n%s", strings.Count(out.String(), "---\n"), out.String())
+			}
+		})
+	}
+}
+
+func TestReleaseLockName(t *testing.T) {
+	tests := []struct {
+		name     string
+		lockName string
+		want     string
+		wantErr  bool
+	}{
+		{name: "release name", want: "helm-lock-app"},
+		{name: "shared lock name", lockName: "platform", want: "helm-lock-platform"},
+		{name: "invalid lock name", lockName: "Platform_1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := newTestOptions(io.Discard)
+			opts.lockName = tt.lockName
+
+			got, err := releaseLockName(opts, "app")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("releaseLockName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("releaseLockName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
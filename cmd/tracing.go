@@ -0,0 +1,92 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName          = "github.com/sergelogvinov/helm-lock"
+	tracingFlushTimeout = 5 * time.Second
+)
+
+// setupTracing exports spans over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is set,
+// otherwise the no-op tracer is kept. The returned context carries the TRACEPARENT parent span.
+func setupTracing(ctx context.Context, opts *lockOptions) (context.Context, func(), error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return ctx, func() {}, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return ctx, nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("helm-lock"))),
+	)
+
+	opts.tracer = provider.Tracer(tracerName)
+
+	if traceParent := os.Getenv("TRACEPARENT"); traceParent != "" {
+		ctx = propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{"traceparent": traceParent})
+	}
+
+	shutdown := func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tracingFlushTimeout)
+		defer cancel()
+
+		if err := provider.Shutdown(ctx); err != nil {
+			opts.logger.Printf("Warning: failed to export traces: %v", err)
+		}
+	}
+
+	return ctx, shutdown, nil
+}
+
+// startSpan starts a span with the release attributes
+func startSpan(ctx context.Context, opts *lockOptions, name string) (context.Context, trace.Span) {
+	return opts.tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("helm.release", opts.releaseName),
+		attribute.String("helm.namespace", opts.helmSettings.Namespace()),
+		attribute.String("helm.command", opts.helmCommand),
+	))
+}
+
+// endSpan records the error on the span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// releaseLock clears the holder of the lock, it returns the prior holder
+func releaseLock(ctx context.Context, client kubernetes.Interface, opts *lockOptions, namespace, lockName string) (string, error) {
+	lock, err := newResourceLock(client, opts, namespace, lockName, opts.identity)
+	if err != nil {
+		return "", err
+	}
+
+	record, _, err := lock.Get(ctx)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	holder := record.HolderIdentity
+	if holder == "" {
+		return "", nil
+	}
+
+	if opts.identity != "" && holder != opts.identity {
+		return holder, fmt.Errorf("lock '%s' is held by '%s', not by '%s'", lockName, holder, opts.identity)
+	}
+
+	record.HolderIdentity = ""
+	record.LeaseDurationSeconds = 1
+	record.RenewTime = metav1.NewTime(time.Now())
+
+	return holder, lock.Update(ctx, *record)
+}
+
+// releaseResult is the -o json output of the release subcommand
+type releaseResult struct {
+	Lock      string `json:"lock"`
+	Namespace string `json:"namespace"`
+	Held      bool   `json:"held"`
+	Holder    string `json:"holder,omitempty"`
+}
+
+// runRelease releases the lock of the release and reports the outcome, a lock that was not held
+// is reported with the exit code 5
+func runRelease(ctx context.Context, client kubernetes.Interface, opts *lockOptions, releaseName, output string, out io.Writer) error {
+	lockName, err := releaseLockName(opts, releaseName)
+	if err != nil {
+		return err
+	}
+
+	result := releaseResult{
+		Lock:      lockName,
+		Namespace: opts.lockNamespaceName(),
+	}
+
+	result.Holder, err = releaseLock(ctx, client, opts, result.Namespace, result.Lock)
+	if err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+
+	result.Held = result.Holder != ""
+
+	switch {
+	case output == "json":
+		if err := json.NewEncoder(out).Encode(result); err != nil {
+			return err
+		}
+	case result.Held:
+		fmt.Fprintf(out, "Released lock '%s' held by '%s'\n", result.Lock, result.Holder)
+	default:
+		fmt.Fprintf(out, "Lock '%s' is not held\n", result.Lock)
+	}
+
+	if !result.Held {
+		return &Error{error: fmt.Errorf("lock '%s' is not held", result.Lock), Code: ExitCodeNotHeld}
+	}
+
+	return nil
+}
+
+func newReleaseCommand(opts *lockOptions) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:     "release RELEASE",
+		Aliases: []string{"force-unlock"},
+		Short:   "Release a lock acquired with --lock-and-exit",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "" && output != "json" {
+				return fmt.Errorf("invalid --output value '%s', must be json", output)
+			}
+
+			clientset, _, err := newClients(opts)
+			if err != nil {
+				return err
+			}
+
+			return runRelease(cmd.Context(), clientset, opts, args[0], output, os.Stdout)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.identity, "identity", "", "Release the lock only if it is held by this identity")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output format, json for scripts")
+
+	return cmd
+}
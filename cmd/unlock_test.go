@@ -0,0 +1,182 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReleaseLock(t *testing.T) {
+	tests := []struct {
+		name       string
+		lease      *coordinationv1.Lease
+		identity   string
+		wantHolder string
+		wantErr    bool
+	}{
+		{name: "held lock", lease: testLease("helm-lock-app", "runner", 0), wantHolder: "runner"},
+		{name: "held by the identity", lease: testLease("helm-lock-app", "runner", 0), identity: "runner", wantHolder: "runner"},
+		{name: "held by another identity", lease: testLease("helm-lock-app", "other", 0), identity: "runner", wantHolder: "other", wantErr: true},
+		{name: "free lock", lease: testLease("helm-lock-app", "", 0)},
+		{name: "missing lock"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.lease != nil {
+				objects = append(objects, tt.lease)
+			}
+
+			client := fake.NewClientset(objects...)
+
+			opts := newTestOptions(io.Discard)
+			opts.identity = tt.identity
+
+			holder, err := releaseLock(context.Background(), client, opts, "default", "helm-lock-app")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("releaseLock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if holder != tt.wantHolder {
+				t.Errorf("releaseLock() holder = %q, want %q", holder, tt.wantHolder)
+			}
+
+			if tt.lease == nil {
+				return
+			}
+
+			lease, err := client.CoordinationV1().Leases("default").Get(context.Background(), "helm-lock-app", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := ""
+			if tt.wantErr {
+				want = *tt.lease.Spec.HolderIdentity
+			}
+
+			if holder := leaseLockInfo(lease).Holder; holder != want {
+				t.Errorf("lock holder after release = %q, want %q", holder, want)
+			}
+		})
+	}
+}
+
+func TestRunReleaseJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		lockName string
+		want     releaseResult
+		wantCode int
+	}{
+		{
+			name: "held lock",
+			want: releaseResult{Lock: "helm-lock-app", Namespace: "default", Held: true, Holder: "runner"},
+		},
+		{
+			name:     "held shared lock",
+			lockName: "platform",
+			want:     releaseResult{Lock: "helm-lock-platform", Namespace: "default", Held: true, Holder: "other"},
+		},
+		{
+			name:     "lock that is not held",
+			lockName: "web",
+			want:     releaseResult{Lock: "helm-lock-web", Namespace: "default"},
+			wantCode: ExitCodeNotHeld,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset(testLease("helm-lock-app", "runner", 0), testLease("helm-lock-platform", "other", 0))
+
+			opts := newTestOptions(io.Discard)
+			opts.lockName = tt.lockName
+
+			var out bytes.Buffer
+
+			err := runRelease(context.Background(), client, opts, "app", "json", &out)
+
+			var codeErr *Error
+			if errors.As(err, &codeErr) {
+				if codeErr.Code != tt.wantCode {
+					t.Errorf("runRelease() exit code = %d, want %d", codeErr.Code, tt.wantCode)
+				}
+			} else if err != nil || tt.wantCode != 0 {
+				t.Fatalf("runRelease() error = %v, want exit code %d", err, tt.wantCode)
+			}
+
+			var got releaseResult
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("output %q is not JSON: %v", out.String(), err)
+			}
+
+			if got != tt.want {
+				t.Errorf("runRelease() result = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunReleaseOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		lockName string
+		want     string
+		wantCode int
+	}{
+		{name: "held lock", want: "Released lock 'helm-lock-app' held by 'runner'\n"},
+		{name: "lock that is not held", lockName: "web", want: "Lock 'helm-lock-web' is not held\n", wantCode: ExitCodeNotHeld},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset(testLease("helm-lock-app", "runner", 0))
+
+			opts := newTestOptions(io.Discard)
+			opts.lockName = tt.lockName
+
+			var out bytes.Buffer
+
+			err := runRelease(context.Background(), client, opts, "app", "", &out)
+
+			var codeErr *Error
+			if errors.As(err, &codeErr) {
+				if codeErr.Code != tt.wantCode {
+					t.Errorf("runRelease() exit code = %d, want %d", codeErr.Code, tt.wantCode)
+				}
+			} else if err != nil || tt.wantCode != 0 {
+				t.Fatalf("runRelease() error = %v, want exit code %d", err, tt.wantCode)
+			}
+
+			if out.String() != tt.want {
+				t.Errorf("runRelease() output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+const diffSummaryLimit = 10
+
+// flagValues returns all values of the matching flags in the helm flags
+func flagValues(flags []string, names ...string) []string {
+	result := []string{}
+
+	for i := 0; i < len(flags); i++ {
+		name, value, found := strings.Cut(flags[i], "=")
+		if !slices.Contains(names, name) {
+			continue
+		}
+
+		if found {
+			result = append(result, value)
+		} else if i+1 < len(flags) && !strings.HasPrefix(flags[i+1], "-") {
+			result = append(result, flags[i+1])
+			i++
+		}
+	}
+
+	return result
+}
+
+// targetValues merges the user supplied values from the forwarded -f and --set flags
+func targetValues(opts *lockOptions) (map[string]any, error) {
+	valueOpts := &values.Options{
+		ValueFiles:    flagValues(opts.helmFlags, "-f", "--values"),
+		StringValues:  flagValues(opts.helmFlags, "--set-string"),
+		Values:        flagValues(opts.helmFlags, "--set"),
+		FileValues:    flagValues(opts.helmFlags, "--set-file"),
+		JSONValues:    flagValues(opts.helmFlags, "--set-json"),
+		LiteralValues: flagValues(opts.helmFlags, "--set-literal"),
+	}
+
+	return valueOpts.MergeValues(getter.All(opts.helmSettings))
+}
+
+// deployedValues returns the user supplied values of the latest release revision
+func deployedValues(actionConfig *action.Configuration, releaseName string) (map[string]any, error) {
+	getValues := action.NewGetValues(actionConfig)
+
+	return getValues.Run(releaseName)
+}
+
+// normalizeValues makes values comparable by a JSON round trip
+func normalizeValues(v map[string]any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := map[string]any{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+
+	return normalized, nil
+}
+
+// diffValues returns the dotted paths that differ between two value trees
+func diffValues(prefix string, a, b map[string]any) []string {
+	keys := map[string]struct{}{}
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+
+	diff := []string{}
+
+	for k := range keys {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+
+		am, aok := a[k].(map[string]any)
+		bm, bok := b[k].(map[string]any)
+
+		switch {
+		case aok && bok:
+			diff = append(diff, diffValues(path, am, bm)...)
+		case !reflect.DeepEqual(a[k], b[k]):
+			diff = append(diff, path)
+		}
+	}
+
+	sort.Strings(diff)
+
+	return diff
+}
+
+// summarizeDiff formats the changed paths for the log
+func summarizeDiff(diff []string) string {
+	if len(diff) > diffSummaryLimit {
+		return fmt.Sprintf("%s and %d more", strings.Join(diff[:diffSummaryLimit], ", "), len(diff)-diffSummaryLimit)
+	}
+
+	return strings.Join(diff, ", ")
+}
+
+// comparableValues returns the target values of the forwarded flags and the deployed values,
+// with --reuse-values the deployed values are merged under the target like helm does
+func comparableValues(actionConfig *action.Configuration, opts *lockOptions) (target, deployed map[string]any, err error) {
+	target, err = targetValues(opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to render target values: %w", err)
+	}
+
+	deployed, err = deployedValues(actionConfig, opts.releaseName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get deployed values: %w", err)
+	}
+
+	if hasFlag(opts.helmFlags, "--reuse-values", "--reset-then-reuse-values") {
+		target = chartutil.MergeTables(target, deployed)
+	}
+
+	if target, err = normalizeValues(target); err != nil {
+		return nil, nil, err
+	}
+
+	if deployed, err = normalizeValues(deployed); err != nil {
+		return nil, nil, err
+	}
+
+	return target, deployed, nil
+}
+
+// isNoOpUpgrade reports whether the upgrade would deploy the same chart version and values
+func isNoOpUpgrade(actionConfig *action.Configuration, opts *lockOptions) (bool, error) {
+	target, deployed, err := comparableValues(actionConfig, opts)
+	if err != nil {
+		return false, err
+	}
+
+	if diff := diffValues("", deployed, target); len(diff) > 0 {
+		opts.logger.Printf("Values differ from the deployed release: %s", summarizeDiff(diff))
+
+		return false, nil
+	}
+
+	deployedVersion, err := getDeployedChartVersion(actionConfig, opts.releaseName)
+	if err != nil {
+		return false, fmt.Errorf("failed to get deployed chart version: %w", err)
+	}
+
+	targetVersion := targetChartVersion(opts)
+	if targetVersion == "" || targetVersion != deployedVersion {
+		opts.logger.Printf("Chart version '%s' differs from the deployed version '%s' or cannot be determined", targetVersion, deployedVersion)
+
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// lookupValue returns the value at the dotted path, it reports false when a key is missing
+// or a parent is not a map
+func lookupValue(v map[string]any, path string) (any, bool) {
+	keys := strings.Split(path, ".")
+
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := v[key].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+
+		v = next
+	}
+
+	value, ok := v[keys[len(keys)-1]]
+
+	return value, ok
+}
+
+// valueChanged reports whether the value at the --only-if-changed path differs between the
+// deployed release and the forwarded -f and --set flags, a value the flags do not set counts as changed
+func valueChanged(actionConfig *action.Configuration, opts *lockOptions) (bool, error) {
+	path := opts.onlyIfChanged
+
+	target, deployed, err := comparableValues(actionConfig, opts)
+	if err != nil {
+		return false, err
+	}
+
+	targetValue, ok := lookupValue(target, path)
+	if !ok {
+		opts.logger.Printf("Warning: value '%s' is not set by the -f and --set flags, running helm %s", path, opts.helmCommand)
+
+		return true, nil
+	}
+
+	deployedValue, ok := lookupValue(deployed, path)
+	if !ok {
+		opts.logger.Printf("Value '%s' is not set in the deployed release", path)
+
+		return true, nil
+	}
+
+	if !reflect.DeepEqual(targetValue, deployedValue) {
+		opts.logger.Printf("Value '%s' changed from %v to %v", path, deployedValue, targetValue)
+
+		return true, nil
+	}
+
+	return false, nil
+}
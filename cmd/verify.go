@@ -0,0 +1,111 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// helmStatusOutput is the part of the helm status -o json output compared by --verify-target
+type helmStatusOutput struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Info      struct {
+		Status string `json:"status"`
+	} `json:"info"`
+}
+
+// targetFlags returns the helm flags that select the cluster and the namespace helm acts on
+func targetFlags(flags []string) []string {
+	result := []string{}
+
+	for i := 0; i < len(flags); i++ {
+		name, _, found := strings.Cut(flags[i], "=")
+
+		// -nNAMESPACE has the value attached
+		if len(name) > 2 && strings.HasPrefix(name, "-n") && !strings.HasPrefix(name, "--") {
+			result = append(result, flags[i])
+
+			continue
+		}
+
+		if name != "-n" && name != "--namespace" && name != "--kubeconfig" && !strings.HasPrefix(name, "--kube-") {
+			continue
+		}
+
+		result = append(result, flags[i])
+
+		if !found && name != "--kube-insecure-skip-tls-verify" && i+1 < len(flags) {
+			result = append(result, flags[i+1])
+			i++
+		}
+	}
+
+	return result
+}
+
+// verifyTarget asks helm status for the release with the forwarded namespace and cluster flags and
+// warns when helm sees a different release than the one that was locked and checked. It never fails the run
+func verifyTarget(ctx context.Context, opts *lockOptions, releaseStatus release.Status) {
+	args := append([]string{"status", opts.releaseName, "-o", "json"}, targetFlags(opts.helmFlags)...)
+
+	if opts.fixture != "" {
+		echoHelmCommand(ctx, opts, args, os.Stderr) //nolint:errcheck
+
+		return
+	}
+
+	namespace := opts.helmSettings.Namespace()
+
+	var stdout bytes.Buffer
+
+	stderr := &tailBuffer{limit: execOutputLimit}
+
+	if err := execHelm(ctx, opts, args, &stdout, stderr); err != nil {
+		if !strings.Contains(stderr.String(), "not found") {
+			opts.logger.Printf("Warning: cannot verify the helm target with helm status: %v: %s", err, strings.TrimSpace(stderr.String()))
+
+			return
+		}
+
+		if releaseStatus != release.StatusUnknown {
+			opts.logger.Printf("WARNING: release '%s' is '%s' in namespace '%s' for helm-lock, but helm does not find it with the forwarded flags", opts.releaseName, releaseStatus, namespace)
+		}
+
+		return
+	}
+
+	status := helmStatusOutput{}
+	if err := json.Unmarshal(stdout.Bytes(), &status); err != nil {
+		opts.logger.Printf("Warning: cannot verify the helm target, invalid helm status output: %v", err)
+
+		return
+	}
+
+	switch {
+	case status.Namespace != namespace:
+		opts.logger.Printf("WARNING: the lock is for release '%s' in namespace '%s', but helm acts on '%s' in namespace '%s'", opts.releaseName, namespace, status.Name, status.Namespace)
+	case releaseStatus == release.StatusUnknown:
+		opts.logger.Printf("WARNING: release '%s' is missing in namespace '%s' for helm-lock, but helm finds it with status '%s'", opts.releaseName, namespace, status.Info.Status)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestTargetFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags []string
+		want  []string
+	}{
+		{name: "no target flags", flags: []string{"--wait", "--set", "a=1"}, want: []string{}},
+		{name: "namespace", flags: []string{"--wait", "-n", "prod"}, want: []string{"-n", "prod"}},
+		{name: "joined namespace", flags: []string{"-nprod", "--namespace=stage"}, want: []string{"-nprod", "--namespace=stage"}},
+		{name: "cluster flags", flags: []string{"--kubeconfig", "/tmp/config", "--kube-context", "prod", "--set", "a=1"}, want: []string{"--kubeconfig", "/tmp/config", "--kube-context", "prod"}},
+		{name: "boolean cluster flag", flags: []string{"--kube-insecure-skip-tls-verify", "--namespace", "prod"}, want: []string{"--kube-insecure-skip-tls-verify", "--namespace", "prod"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := targetFlags(tt.flags); !slices.Equal(got, tt.want) {
+				t.Errorf("targetFlags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyTarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake helm is a shell script")
+	}
+
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+
+	// the fake helm status prints the test output and exits with the test code
+	script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\nprintf '%s' \"$FAKE_HELM_STDOUT\"\nprintf '%s' \"$FAKE_HELM_STDERR\" >&2\nexit \"${FAKE_HELM_EXIT:-0}\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "helm"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		name     string
+		status   release.Status
+		stdout   string
+		stderr   string
+		exit     string
+		wantLog  string
+		wantNone bool
+	}{
+		{name: "same release", status: release.StatusDeployed, stdout: `{"name": "app", "namespace": "default", "info": {"status": "deployed"}}`, wantNone: true},
+		{name: "namespace mismatch", status: release.StatusDeployed, stdout: `{"name": "app", "namespace": "prod", "info": {"status": "deployed"}}`, wantLog: "helm acts on 'app' in namespace 'prod'"},
+		{name: "missing for helm-lock", status: release.StatusUnknown, stdout: `{"name": "app", "namespace": "default", "info": {"status": "failed"}}`, wantLog: "helm finds it with status 'failed'"},
+		{name: "missing for helm", status: release.StatusFailed, stderr: "Error: release: not found", exit: "1", wantLog: "helm does not find it"},
+		{name: "missing for both", status: release.StatusUnknown, stderr: "Error: release: not found", exit: "1", wantNone: true},
+		{name: "helm error", status: release.StatusDeployed, stderr: "Error: Kubernetes cluster unreachable", exit: "1", wantLog: "cannot verify the helm target with helm status"},
+		{name: "invalid output", status: release.StatusDeployed, stdout: "deployed", wantLog: "invalid helm status output"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FAKE_HELM_STDOUT", tt.stdout)
+			t.Setenv("FAKE_HELM_STDERR", tt.stderr)
+			t.Setenv("FAKE_HELM_EXIT", tt.exit)
+
+			var out bytes.Buffer
+
+			opts := newTestOptions(&out)
+			opts.helmFlags = []string{"--wait", "-n", "default", "--set", "a=1"}
+
+			verifyTarget(context.Background(), opts, tt.status)
+
+			switch {
+			case tt.wantNone && out.Len() > 0:
+				t.Errorf("verifyTarget() logged:\n%s", out.String())
+			case !strings.Contains(out.String(), tt.wantLog):
+				t.Errorf("log has no %q:\n%s", tt.wantLog, out.String())
+			}
+
+			args, err := os.ReadFile(argsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := "status app -o json -n default"; strings.TrimSpace(string(args)) != want {
+				t.Errorf("helm arguments = %q, want %q", strings.TrimSpace(string(args)), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWebhookTimeout = 30 * time.Second
+	webhookMessageLimit   = 1024
+)
+
+// acquireWebhookPayload is sent to the acquire webhook once the lock is held
+type acquireWebhookPayload struct {
+	Release   string `json:"release"`
+	Command   string `json:"command"`
+	Holder    string `json:"holder"`
+	Namespace string `json:"namespace"`
+}
+
+// rollbackWebhookPayload is sent to the rollback webhook before an automatic rollback
+type rollbackWebhookPayload struct {
+	Release         string `json:"release"`
+	Namespace       string `json:"namespace"`
+	Holder          string `json:"holder"`
+	Status          string `json:"status"`
+	CurrentRevision int    `json:"currentRevision"`
+	TargetRevision  int    `json:"targetRevision"`
+}
+
+// postWebhook sends the payload as JSON and succeeds only on a 2xx response
+func postWebhook(ctx context.Context, url string, timeout time.Duration, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMessageLimit))
+		if m := strings.TrimSpace(string(msg)); m != "" {
+			return fmt.Errorf("webhook returned %s: %s", resp.Status, m)
+		}
+
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
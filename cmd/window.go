@@ -0,0 +1,264 @@
+/*
+Copyright 2026 Serge Logvinov.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// windowLookahead bounds the search for the next opening of a window
+const windowLookahead = 8 * 24 * time.Hour
+
+var weekdays = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// deployWindow reports whether helm may run at the given time
+type deployWindow func(t time.Time) bool
+
+// parseWindow parses a five field cron expression, where every matching minute is inside the window,
+// or a range like "Mon-Fri 09:00-17:00", the days are optional and the times wrap past midnight
+func parseWindow(spec string) (deployWindow, error) {
+	fields := strings.Fields(spec)
+
+	switch len(fields) {
+	case 5:
+		return parseCronWindow(fields)
+	case 1, 2:
+		return parseRangeWindow(fields)
+	default:
+		return nil, fmt.Errorf("invalid --window value '%s', must be a cron expression or [DAYS] HH:MM-HH:MM", spec)
+	}
+}
+
+// parseCronWindow parses minute, hour, day of month, month and day of week fields
+func parseCronWindow(fields []string) (deployWindow, error) {
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+	var sets [5][]bool
+
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid --window cron field '%s': %w", field, err)
+		}
+
+		sets[i] = set
+	}
+
+	// 7 is also Sunday
+	sets[4][0] = sets[4][0] || sets[4][7]
+
+	anyDay, anyWeekday := fields[2] == "*", fields[4] == "*"
+
+	return func(t time.Time) bool {
+		if !sets[0][t.Minute()] || !sets[1][t.Hour()] || !sets[3][int(t.Month())] {
+			return false
+		}
+
+		day, weekday := sets[2][t.Day()], sets[4][int(t.Weekday())]
+
+		// like cron, a restricted day of month and day of week match either
+		if !anyDay && !anyWeekday {
+			return day || weekday
+		}
+
+		return day && weekday
+	}, nil
+}
+
+// parseCronField parses a comma separated list of *, values, ranges and /steps
+func parseCronField(field string, low, high int) ([]bool, error) {
+	set := make([]bool, high+1)
+
+	for part := range strings.SplitSeq(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step '%s'", stepPart)
+			}
+		}
+
+		first, last := low, high
+
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+
+			var err error
+			if first, err = strconv.Atoi(from); err != nil {
+				return nil, fmt.Errorf("invalid value '%s'", from)
+			}
+
+			last = first
+			if isRange {
+				if last, err = strconv.Atoi(to); err != nil {
+					return nil, fmt.Errorf("invalid value '%s'", to)
+				}
+			} else if hasStep {
+				last = high
+			}
+		}
+
+		if first < low || last > high || first > last {
+			return nil, fmt.Errorf("'%s' is out of range %d-%d", part, low, high)
+		}
+
+		for v := first; v <= last; v += step {
+			set[v] = true
+		}
+	}
+
+	return set, nil
+}
+
+// parseRangeWindow parses an optional day list and a HH:MM-HH:MM time range
+func parseRangeWindow(fields []string) (deployWindow, error) {
+	days := [7]bool{true, true, true, true, true, true, true}
+
+	if len(fields) == 2 {
+		var err error
+		if days, err = parseWeekdays(fields[0]); err != nil {
+			return nil, err
+		}
+
+		fields = fields[1:]
+	}
+
+	from, to, found := strings.Cut(fields[0], "-")
+	if !found {
+		return nil, fmt.Errorf("invalid --window time range '%s', must be HH:MM-HH:MM", fields[0])
+	}
+
+	start, err := parseClock(from)
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := parseClock(to)
+	if err != nil {
+		return nil, err
+	}
+
+	if start == end {
+		return nil, fmt.Errorf("invalid --window time range '%s', it is empty", fields[0])
+	}
+
+	return func(t time.Time) bool {
+		minute := t.Hour()*60 + t.Minute()
+
+		if start <= end {
+			return days[t.Weekday()] && minute >= start && minute < end
+		}
+
+		// the part after midnight belongs to the window of the previous day
+		return (days[t.Weekday()] && minute >= start) || (days[(t.Weekday()+6)%7] && minute < end)
+	}, nil
+}
+
+// parseWeekdays parses a comma separated list of days and day ranges like Mon-Fri,Sun
+func parseWeekdays(spec string) ([7]bool, error) {
+	var days [7]bool
+
+	for part := range strings.SplitSeq(strings.ToLower(spec), ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+
+		first, firstFound := weekdays[from]
+		last, lastFound := weekdays[to]
+
+		if !firstFound || !lastFound {
+			return days, fmt.Errorf("invalid --window days '%s', must be like Mon-Fri or Sat,Sun", spec)
+		}
+
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+
+			if d == last {
+				break
+			}
+		}
+	}
+
+	return days, nil
+}
+
+// parseClock parses HH:MM into minutes of the day, 24:00 is the end of the day
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		if value == "24:00" {
+			return 24 * 60, nil
+		}
+
+		return 0, fmt.Errorf("invalid --window time '%s', must be HH:MM", value)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// nextWindowOpening returns the first minute inside the window after now and before the end
+func nextWindowOpening(window deployWindow, now, end time.Time) (time.Time, bool) {
+	t := now.Truncate(time.Minute)
+
+	for ; !t.After(end); t = t.Add(time.Minute) {
+		if t.After(now) && window(t) {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// waitForWindow blocks until the time is inside the --window, the lock is held meanwhile and the wait
+// is bounded by the deadline of the operation
+func waitForWindow(ctx context.Context, opts *lockOptions) error {
+	now := time.Now()
+	if opts.deployWindow(now) {
+		return nil
+	}
+
+	if opts.windowFailOutside {
+		return fmt.Errorf("current time %s is outside of the deploy window '%s'", now.Format(time.RFC3339), opts.window)
+	}
+
+	end := now.Add(windowLookahead)
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(end) {
+		end = deadline
+	}
+
+	opening, found := nextWindowOpening(opts.deployWindow, now, end)
+	if !found {
+		return fmt.Errorf("deploy window '%s' does not open before %s", opts.window, end.Format(time.RFC3339))
+	}
+
+	opts.logger.Printf("Outside of the deploy window '%s', holding the lock until %s", opts.window, opening.Format(time.RFC3339))
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("failed to wait for the deploy window: %w", ctx.Err())
+	case <-time.After(time.Until(opening)):
+	}
+
+	return nil
+}
@@ -32,6 +32,15 @@ import (
 
 func main() {
 	if err := cmd.Run(); err != nil {
+		var codeError *cmd.Error
+		if errors.As(err, &codeError) {
+			os.Exit(codeError.Code)
+		}
+
+		if errors.Is(err, cmd.ErrLockTimeout) {
+			os.Exit(cmd.ExitCodeLockTimeout)
+		}
+
 		var exitError *exec.ExitError
 		if errors.As(err, &exitError) {
 			os.Exit(exitError.ExitCode())